@@ -0,0 +1,74 @@
+package app
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/init-pkg/nova/errs"
+	nova_ctx "github.com/init-pkg/nova/shared/ctx"
+)
+
+// ParserCacheKind is the kind of model answer stored in the parser cache
+type ParserCacheKind string
+
+const (
+	ParserCacheKindHeaderAnalysis  ParserCacheKind = "header_analysis"  // header row and data start of a table head
+	ParserCacheKindTableValidation ParserCacheKind = "table_validation" // product table check of one table layout
+	ParserCacheKindLayoutIndex     ParserCacheKind = "layout_index"     // known table layouts with the same column count, to find similar ones
+)
+
+func (this ParserCacheKind) IsValid() bool {
+	switch this {
+	case ParserCacheKindHeaderAnalysis, ParserCacheKindTableValidation, ParserCacheKindLayoutIndex:
+		return true
+	default:
+		return false
+	}
+}
+
+// ParserCacheScope selects the entries removed by a bulk invalidation
+type ParserCacheScope string
+
+const (
+	ParserCacheScopeStale ParserCacheScope = "stale" // entries of previous versions and keys of the old unversioned schemes
+	ParserCacheScopeAll   ParserCacheScope = "all"   // every parser cache entry
+)
+
+func (this ParserCacheScope) IsValid() bool {
+	switch this {
+	case ParserCacheScopeStale, ParserCacheScopeAll:
+		return true
+	default:
+		return false
+	}
+}
+
+// ParserCacheEntry is a stored model answer. Entries of other versions are never read by the parser
+type ParserCacheEntry struct {
+	Key       string          `json:"key"`
+	Kind      ParserCacheKind `json:"kind"`
+	Version   string          `json:"version"`    // cache schema, prompt and model version the answer was made with
+	IsCurrent bool            `json:"is_current"` // made with the running version
+	Suppliers []uint64        `json:"suppliers"`  // suppliers whose files produced or used the answer
+	UpdatedAt time.Time       `json:"updated_at"`
+	Value     json.RawMessage `json:"value,omitempty"` // stored answer, filled for a single entry only
+}
+
+// ParserCacheFilter narrows the listed entries. Zero values match everything
+type ParserCacheFilter struct {
+	Kind       ParserCacheKind `query:"kind" json:"kind"`
+	SupplierID uint64          `query:"supplier_id" json:"supplier_id"`
+	Limit      int             `query:"limit" json:"limit"` // default 100
+}
+
+// ExcelParserCacheAdmin inspects and invalidates cached header analysis and table validation answers
+type ExcelParserCacheAdmin interface {
+	ListCacheEntries(ctx nova_ctx.Ctx, filter ParserCacheFilter) ([]*ParserCacheEntry, errs.Error)
+	// GetCacheEntry returns nil if the key is not found
+	GetCacheEntry(ctx nova_ctx.Ctx, key string) (*ParserCacheEntry, errs.Error)
+	PurgeCacheKey(ctx nova_ctx.Ctx, key string) errs.Error
+	// PurgeCacheSupplier removes all entries used by the supplier and returns their count
+	PurgeCacheSupplier(ctx nova_ctx.Ctx, supplierID uint64) (int, errs.Error)
+	// InvalidateCache removes the entries of the scope and returns their count
+	InvalidateCache(ctx nova_ctx.Ctx, scope ParserCacheScope) (int, errs.Error)
+}
@@ -0,0 +1,17 @@
+package app
+
+// LayoutFingerprint describes the layout of a table for recognizing files of the same format.
+// Layouts are compared by similarity, so a format with an added column or a renamed header is still recognized
+type LayoutFingerprint struct {
+	Columns int           `json:"columns"`          // columns with a header
+	Headers [][]string    `json:"headers"`          // normalized header tokens of every column, digits masked
+	Types   []ColumnType  `json:"types"`            // dominant data type of every column
+	Groups  []LayoutGroup `json:"groups,omitempty"` // merged header groups, left to right
+}
+
+// LayoutGroup is a merged header group over the columns Start to End
+type LayoutGroup struct {
+	Title string `json:"title"` // normalized group title
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
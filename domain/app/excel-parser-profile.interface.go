@@ -0,0 +1,28 @@
+package app
+
+// ColumnType is the data type inferred for a table column from its values
+type ColumnType string
+
+const (
+	ColumnTypeEmpty    ColumnType = "empty"    // no values
+	ColumnTypeNumeric  ColumnType = "numeric"  // numbers with fractions or mixed with integers
+	ColumnTypeInteger  ColumnType = "integer"  // whole numbers, e.g. quantities
+	ColumnTypeCurrency ColumnType = "currency" // amounts with a currency symbol, code or format
+	ColumnTypeCode     ColumnType = "code"     // short SKU-like tokens of letters and digits: "AB-1234", "00123"
+	ColumnTypeText     ColumnType = "text"     // free text or values of no dominant type
+	ColumnTypeURL      ColumnType = "url"
+	ColumnTypeBarcode  ColumnType = "barcode" // EAN-8, UPC-A, EAN-13 or GTIN-14 with a valid check digit
+	ColumnTypeDate     ColumnType = "date"
+	ColumnTypeBool     ColumnType = "bool"
+)
+
+// ColumnProfile summarizes the values of one table column
+type ColumnProfile struct {
+	Type      ColumnType `json:"type"`
+	TypeShare float64    `json:"type_share"`    // share of filled cells of the inferred type, 0-1
+	FillRate  float64    `json:"fill_rate"`     // share of rows with a value, 0-1
+	Distinct  int        `json:"distinct"`      // distinct values
+	Min       *float64   `json:"min,omitempty"` // min and max of numeric values
+	Max       *float64   `json:"max,omitempty"`
+	Samples   []string   `json:"samples,omitempty"` // first distinct values, shortened
+}
@@ -0,0 +1,65 @@
+package app
+
+// DecisionSource tells where a parser decision came from
+type DecisionSource string
+
+const (
+	DecisionSourceLLM       DecisionSource = "llm"       // model answer
+	DecisionSourceCache     DecisionSource = "cache"     // cached model answer
+	DecisionSourceHeuristic DecisionSource = "heuristic" // rule-based, by configuration or because the model failed
+	DecisionSourceMinimal   DecisionSource = "minimal"   // less than two rows to analyze, the first one is the header
+	DecisionSourceTemplate  DecisionSource = "template"  // stored decision of a supplier template with the same layout
+)
+
+// ParseReport explains why every sheet of a workbook was kept or dropped
+type ParseReport struct {
+	Sheets []*SheetReport `json:"sheets"`
+}
+
+// SheetReport is the diagnostics of one sheet. A sheet is kept when at least one of its tables is
+type SheetReport struct {
+	Sheet   string `json:"sheet"`
+	Skipped string `json:"skipped,omitempty"` // why the sheet was not analyzed at all
+	// text encoding of a delimited text file: by BOM, valid UTF-8 or UTF-16, otherwise guessed windows-1251
+	Encoding string         `json:"encoding,omitempty"`
+	Tables   []*TableReport `json:"tables"` // one per detected table region
+	Error    string         `json:"error,omitempty"`
+}
+
+// TableReport is the diagnostics of one table region. Rows are 1-based sheet row numbers
+type TableReport struct {
+	Range            string                `json:"range"`     // cell range of the region
+	StartRow         int                   `json:"start_row"` // first row with at least 3 filled cells, 0 if none
+	HeaderCandidates []HeaderCandidate     `json:"header_candidates,omitempty"`
+	HeaderAnalysis   *HeaderAnalysisReport `json:"header_analysis,omitempty"`
+	CacheHits        []ParserCacheKind     `json:"cache_hits,omitempty"` // cached answers used, in order
+	Validation       *ValidationReport     `json:"validation,omitempty"`
+	Kept             bool                  `json:"kept"`
+	Reason           string                `json:"reason"` // final reason for keeping or rejecting the table
+}
+
+// HeaderCandidate is a row considered as the header row with its rule-based score, higher is better
+type HeaderCandidate struct {
+	Row   int     `json:"row"`
+	Score float64 `json:"score"`
+	Text  string  `json:"text"` // row cells joined, shortened
+}
+
+// HeaderAnalysisReport is the chosen header row and data start
+type HeaderAnalysisReport struct {
+	Source DecisionSource `json:"source"`
+	// indices within the candidate rows sent to the model, -1 when not applicable
+	HeaderRowIndex int    `json:"header_row_index"`
+	DataStartIndex int    `json:"data_start_index"`
+	HeaderRow      int    `json:"header_row"` // 0 when the answer was out of range and the default header was used
+	DataStart      int    `json:"data_start"`
+	Reasoning      string `json:"reasoning,omitempty"`
+}
+
+// ValidationReport is the product table verdict
+type ValidationReport struct {
+	Source         DecisionSource `json:"source"`
+	IsProductTable bool           `json:"is_product_table"`
+	Confidence     int            `json:"confidence"` // 1-10, the table is kept from 7. 0 for template decisions
+	Reasoning      string         `json:"reasoning,omitempty"`
+}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"time"
+
+	"github.com/init-pkg/nova/errs"
+	nova_ctx "github.com/init-pkg/nova/shared/ctx"
+)
+
+// SupplierTemplate is the remembered layout of the files of a supplier. Tables of an upload whose layout
+// matches a template table are parsed and mapped with the stored decisions, without the model
+type SupplierTemplate struct {
+	SupplierID uint64           `json:"supplier_id"`
+	Version    int              `json:"version"` // template schema, templates of other versions are not applied
+	Sheets     []*SheetTemplate `json:"sheets"`
+	UpdatedAt  time.Time        `json:"updated_at"`
+}
+
+// Sheet returns the template of a sheet by name, nil if there is none
+func (this *SupplierTemplate) Sheet(name string) *SheetTemplate {
+	if this == nil {
+		return nil
+	}
+	for _, sheet := range this.Sheets {
+		if sheet.Sheet == name {
+			return sheet
+		}
+	}
+
+	return nil
+}
+
+// SheetTemplate is the layout of the tables of one sheet
+type SheetTemplate struct {
+	Sheet   string           `json:"sheet"`
+	Skipped bool             `json:"skipped"` // every table of the sheet was rejected, the sheet is skipped while they match
+	Tables  []*TableTemplate `json:"tables"`
+}
+
+// TableTemplate is the stored decision for one table region. Rows are offsets from the table start row
+type TableTemplate struct {
+	Layout         string             `json:"layout"` // exact key of the fingerprint
+	Fingerprint    *LayoutFingerprint `json:"fingerprint"`
+	HeaderRows     int                `json:"header_rows"` // header rows from the start row when the header row is unknown
+	HeaderRow      int                `json:"header_row"`  // -1 if unknown
+	DataStart      int                `json:"data_start"`  // -1 if unknown
+	IsProductTable bool               `json:"is_product_table"`
+	Mapping        map[string]string  `json:"mapping,omitempty"` // header title -> product field, empty until the table is mapped
+}
+
+// ExcelParserTemplates reads and updates the layout templates of suppliers.
+// Templates are learned by the parser from the decisions made for uploads of the supplier
+type ExcelParserTemplates interface {
+	// GetTemplate returns nil if the supplier has no template
+	GetTemplate(ctx nova_ctx.Ctx, supplierID uint64) (*SupplierTemplate, errs.Error)
+	// SaveTemplateMapping stores the column mapping of the template table with the layout.
+	// Nothing is saved if the supplier has no such table
+	SaveTemplateMapping(ctx nova_ctx.Ctx, supplierID uint64, sheet, layout string, mapping map[string]string) errs.Error
+	DeleteTemplate(ctx nova_ctx.Ctx, supplierID uint64) errs.Error
+}
@@ -1,16 +1,186 @@
 package app
 
 import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
 	"github.com/init-pkg/nova/errs"
 	nova_ctx "github.com/init-pkg/nova/shared/ctx"
 )
 
+// HeaderPathSeparator joins header path levels into a single column title
+const HeaderPathSeparator = " / "
+
+// CategoryColumnHeader is the title of the synthetic column built from category separator rows
+const CategoryColumnHeader = "Категория"
+
+// MergeKind tells whether and how a cell value came from a merged range
+type MergeKind string
+
+const (
+	MergeKindNone         MergeKind = ""              // regular cell
+	MergeKindOrigin       MergeKind = "origin"        // top-left cell of a merged range
+	MergeKindDuplicated   MergeKind = "duplicated"    // value copied from the merged range origin
+	MergeKindSpan         MergeKind = "span"          // covered by a header group, value kept in the origin only
+	MergeKindSectionTitle MergeKind = "section_title" // part of a merged section title
+)
+
+func (this MergeKind) IsMerged() bool {
+	return this != MergeKindNone
+}
+
+// CellType is the type of a typed cell value
+type CellType string
+
+const (
+	CellTypeEmpty    CellType = ""
+	CellTypeString   CellType = "string"
+	CellTypeNumber   CellType = "number"
+	CellTypeInteger  CellType = "integer"
+	CellTypeBool     CellType = "bool"
+	CellTypeDate     CellType = "date" // date, time or date with time
+	CellTypeCurrency CellType = "currency"
+)
+
+// CellValue is the typed value of a cell, the displayed text stays in Rows
+type CellValue struct {
+	Type     CellType   `json:"type,omitempty"`
+	Number   float64    `json:"number,omitempty"`   // number, integer and currency amount
+	Bool     bool       `json:"bool,omitempty"`     // bool value
+	Time     *time.Time `json:"time,omitempty"`     // date value
+	Currency string     `json:"currency,omitempty"` // ISO code or symbol of a currency amount, empty if unknown
+}
+
+// FormulaCell is a formula cell that was saved without a cached result and evaluated by the parser
+type FormulaCell struct {
+	Cell    string `json:"cell"` // A1 reference in the source sheet
+	Formula string `json:"formula"`
+	Error   string `json:"error,omitempty"` // why the evaluation failed, the cell is left empty
+}
+
 type ParseExcelResult struct {
-	Header    []string   `json:"header"`
-	Rows      [][]string `json:"rows"`
-	SheetName string     `json:"sheet_name"`
+	Header     []string      `json:"header"`
+	HeaderPath [][]string    `json:"header_path"` // all header levels per column, top to bottom: [[Цена, USD], [Цена, KZT]]
+	Rows       [][]string    `json:"rows"`
+	RowMerges  [][]MergeKind `json:"row_merges"` // merge origin of every cell in Rows
+	Values     [][]CellValue `json:"values"`     // typed value of every cell in Rows
+	// per column: hidden in the source and kept by ParseOptions.KeepHiddenColumns
+	HiddenColumns []bool `json:"hidden_columns"`
+	SheetName     string `json:"sheet_name"`
+	Range         string `json:"range"` // cell range of the table within the sheet, e.g. "A5:H120"
+	// category levels of every row in Rows from separator rows, top to bottom: [Компьютеры, Ноутбуки]
+	CategoryPath [][]string `json:"category_path,omitempty"`
+	// formula cells of the table without cached results: evaluated successfully and failed
+	ComputedCells  []FormulaCell `json:"computed_cells,omitempty"`
+	FailedFormulas []FormulaCell `json:"failed_formulas,omitempty"`
+	// source provenance: 1-based sheet row of every row in Rows, sheet column letter of every column
+	// and A1 range of the header cells of every column. Empty for the synthetic category column
+	SourceRows    []int           `json:"source_rows"`
+	SourceColumns []string        `json:"source_columns"`
+	HeaderCells   []string        `json:"header_cells"`
+	Profiles      []ColumnProfile `json:"profiles"` // per column: inferred type and value statistics
+	// layout fingerprint of the table head, empty when the layout decisions are not reusable.
+	// ColumnMapping is the header title -> product field mapping of a matched supplier template
+	Layout        string            `json:"layout,omitempty"`
+	ColumnMapping map[string]string `json:"column_mapping,omitempty"`
+}
+
+// HeaderTitles returns one title per column built from the full header path,
+// falling back to the collapsed header when no path is available
+func (this *ParseExcelResult) HeaderTitles() []string {
+	var titles = make([]string, len(this.Header))
+	for i := range this.Header {
+		titles[i] = this.Header[i]
+		if i < len(this.HeaderPath) && len(this.HeaderPath[i]) > 0 {
+			titles[i] = strings.Join(this.HeaderPath[i], HeaderPathSeparator)
+		}
+	}
+
+	return titles
+}
+
+// HasCategoryColumn reports whether the last column is the synthetic category column
+func (this *ParseExcelResult) HasCategoryColumn() bool {
+	return len(this.CategoryPath) > 0 && len(this.Header) > 0 && this.Header[len(this.Header)-1] == CategoryColumnHeader
+}
+
+// CellRef returns the source reference of a cell in Rows, e.g. "Sheet1!F233".
+// Empty if the cell has no source, like the synthetic category column
+func (this *ParseExcelResult) CellRef(row, col int) string {
+	if row < 0 || row >= len(this.SourceRows) {
+		return ""
+	}
+
+	return this.ColumnRef(col, this.SourceRows[row])
+}
+
+// ColumnRef returns the source reference of a column at a 1-based sheet row
+func (this *ParseExcelResult) ColumnRef(col, sheetRow int) string {
+	if col < 0 || col >= len(this.SourceColumns) || this.SourceColumns[col] == "" || sheetRow <= 0 {
+		return ""
+	}
+
+	return SheetRef(this.SheetName) + "!" + this.SourceColumns[col] + strconv.Itoa(sheetRow)
+}
+
+// HeaderRef returns the source reference of the header cells of a column, e.g. "Sheet1!F4:F5"
+func (this *ParseExcelResult) HeaderRef(col int) string {
+	if col < 0 || col >= len(this.HeaderCells) || this.HeaderCells[col] == "" {
+		return ""
+	}
+
+	return SheetRef(this.SheetName) + "!" + this.HeaderCells[col]
 }
 
+// SheetRef quotes a sheet name for a cell reference when it is not a plain word: 'Прайс лист'
+func SheetRef(sheet string) string {
+	for _, r := range sheet {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '.' {
+			return "'" + strings.ReplaceAll(sheet, "'", "''") + "'"
+		}
+	}
+
+	return sheet
+}
+
+// ParseStreamRow is one data row of a streamed table. Tables continuing below the sheet head grow while
+// their rows are streamed: Table.Range and the formula reports of the table cover the rows passed so far
+// and are final when ParseStream returns
+type ParseStreamRow struct {
+	Table        *ParseExcelResult `json:"table"`         // header part of the table, Rows are not filled
+	Cells        []string          `json:"cells"`         // one value per Table.Header column
+	Merges       []MergeKind       `json:"merges"`        // merge origin of every cell in Cells
+	Values       []CellValue       `json:"values"`        // typed value of every cell in Cells
+	CategoryPath []string          `json:"category_path"` // category levels from separator rows, top to bottom
+	SourceRow    int               `json:"source_row"`    // 1-based sheet row, cells are referenced with Table.ColumnRef
+}
+
+// ParseOptions are per-request parsing options. Hidden sheets, rows and columns are skipped by default
+type ParseOptions struct {
+	KeepHiddenSheets  bool   `json:"keep_hidden_sheets"`
+	KeepHiddenRows    bool   `json:"keep_hidden_rows"`
+	KeepHiddenColumns bool   `json:"keep_hidden_columns"`
+	SupplierID        uint64 `json:"supplier_id,omitempty"` // supplier of the file, cached model answers are attributed to it and its template is applied
+}
+
+// Errors of a parse stopped before completion, the request context error is wrapped into them
+var (
+	ErrParseCancelled = errors.New("parse cancelled")
+	ErrParseTimeout   = errors.New("parse deadline exceeded")
+)
+
 type ExcelParserService interface {
-	Parse(ctx nova_ctx.Ctx, file []byte) ([]*ParseExcelResult, errs.Error)
+	Parse(ctx nova_ctx.Ctx, file []byte, opts ParseOptions) ([]*ParseExcelResult, errs.Error)
+	// ParseWithReport parses like Parse and explains the decision made for every sheet.
+	// The report is returned with the error too, up to the point where parsing stopped
+	ParseWithReport(ctx nova_ctx.Ctx, file []byte, opts ParseOptions) ([]*ParseExcelResult, *ParseReport, errs.Error)
+	// ParseStream detects tables on the head of every sheet and passes data rows to consume one by one
+	// without building the whole sheet in memory. Only xlsx is read row by row: xls, ods and delimited text
+	// are read whole and their rows are streamed from memory. Formulas without cached values are not
+	// evaluated and are reported as failed. Supplier templates are applied but not learned, as only
+	// the sheet head is analyzed. An error returned by consume stops parsing
+	ParseStream(ctx nova_ctx.Ctx, file []byte, opts ParseOptions, consume func(row *ParseStreamRow) error) errs.Error
 }
@@ -0,0 +1,31 @@
+package app
+
+import "context"
+
+// LLMTask names what a completion is used for. The model is configured per task
+type LLMTask string
+
+const (
+	LLMTaskHeaderAnalysis  LLMTask = "header_analysis"  // header row and data start detection
+	LLMTaskTableValidation LLMTask = "table_validation" // product table check
+	LLMTaskHeaderMapping   LLMTask = "header_mapping"   // column headers to product fields
+)
+
+// CompletionRequest is a prompt with the JSON schema the answer must follow
+type CompletionRequest struct {
+	Task              LLMTask
+	System            string // optional system message
+	Prompt            string
+	SchemaName        string
+	SchemaDescription string
+	Schema            any   // JSON schema of the output
+	Seed              int64 // 0 leaves the seed to the provider
+}
+
+// StructuredCompleter asks a language model for a JSON answer that follows the request schema
+type StructuredCompleter interface {
+	// Complete decodes the model answer into out, which must be a pointer to the output type
+	Complete(ctx context.Context, req CompletionRequest, out any) error
+	// Model returns the model that answers the task, cached answers are versioned by it
+	Model(task LLMTask) string
+}
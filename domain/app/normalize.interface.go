@@ -0,0 +1,86 @@
+package app
+
+import "time"
+
+// PriceQualifier tells how a normalized price amount is meant
+type PriceQualifier string
+
+const (
+	PriceQualifierExact     PriceQualifier = "exact"
+	PriceQualifierFrom      PriceQualifier = "from"       // lower bound: "от 1500"
+	PriceQualifierRange     PriceQualifier = "range"      // Amount to MaxAmount: "1500-1800"
+	PriceQualifierOnRequest PriceQualifier = "on_request" // no amount: "по запросу"
+)
+
+// Price is a normalized price or discount cell
+type Price struct {
+	Amount    float64        `json:"amount"`
+	MaxAmount float64        `json:"max_amount,omitempty"` // upper bound of a range
+	Currency  string         `json:"currency,omitempty"`   // ISO code from the cell, a neighboring currency column or the header, empty if unknown
+	Qualifier PriceQualifier `json:"qualifier"`
+	Percent   bool           `json:"percent,omitempty"` // amount is a share, e.g. 0.15 for "15%"
+}
+
+// Availability is the stock status of a product
+type Availability string
+
+const (
+	AvailabilityInStock Availability = "in_stock"
+	AvailabilityLow     Availability = "low"
+	AvailabilityOut     Availability = "out"
+	AvailabilityOnOrder Availability = "on_order" // made to order or expected to arrive
+)
+
+func (this Availability) IsValid() bool {
+	switch this {
+	case AvailabilityInStock, AvailabilityLow, AvailabilityOut, AvailabilityOnOrder:
+		return true
+	default:
+		return false
+	}
+}
+
+// QuantityQualifier tells how a normalized quantity amount is meant
+type QuantityQualifier string
+
+const (
+	QuantityQualifierExact   QuantityQualifier = "exact"
+	QuantityQualifierRange   QuantityQualifier = "range"   // Amount to MaxAmount: "5-10", ">10" has no upper bound
+	QuantityQualifierUnknown QuantityQualifier = "unknown" // availability only: "есть", "под заказ"
+)
+
+// Quantity is a normalized stock cell
+type Quantity struct {
+	Amount       int               `json:"amount"`               // exact amount or the lower bound of a range
+	MaxAmount    int               `json:"max_amount,omitempty"` // upper bound of a range, 0 if open
+	Qualifier    QuantityQualifier `json:"qualifier"`
+	Availability Availability      `json:"availability"`
+	ExpectedAt   *time.Time        `json:"expected_at,omitempty"` // arrival date: "0 (ожидается 12.11)"
+}
+
+// IssueSeverity tells whether a row issue makes the row invalid
+type IssueSeverity string
+
+const (
+	IssueSeverityError   IssueSeverity = "error"   // the row is not imported
+	IssueSeverityWarning IssueSeverity = "warning" // the row is imported as is
+)
+
+// RowIssue is a problem of a cell or a row of a mapped table
+type RowIssue struct {
+	Row      int           `json:"row"`            // index in Rows
+	Cell     string        `json:"cell,omitempty"` // source reference, e.g. "Sheet1!F233", empty for row level issues
+	Field    string        `json:"field"`          // product field of the column
+	Value    string        `json:"value,omitempty"`
+	Rule     string        `json:"rule"` // failed check, e.g. "type", "required", "unique"
+	Severity IssueSeverity `json:"severity"`
+	Message  string        `json:"message"`
+}
+
+// NormalizedValues are typed product values of a mapped table.
+// Per field slices are aligned with Rows and hold nil where the cell is empty or invalid
+type NormalizedValues struct {
+	Prices     map[string][]*Price `json:"prices"`               // by product field: price, discount
+	Quantities []*Quantity         `json:"quantities,omitempty"` // quantity column
+	Issues     []RowIssue          `json:"issues"`
+}
@@ -0,0 +1,41 @@
+package app
+
+// RowCheck is the validation outcome of one row of a mapped table
+type RowCheck struct {
+	Row       int        `json:"row"`        // index in Rows
+	SourceRow int        `json:"source_row"` // 1-based sheet row, 0 if unknown
+	Errors    []RowIssue `json:"errors,omitempty"`
+	Warnings  []RowIssue `json:"warnings,omitempty"`
+}
+
+func (this *RowCheck) IsValid() bool {
+	return len(this.Errors) == 0
+}
+
+// ImportDecision tells what to do with a validated file
+type ImportDecision string
+
+const (
+	ImportDecisionAccept  ImportDecision = "accept"  // every row is valid
+	ImportDecisionPartial ImportDecision = "partial" // invalid rows are skipped
+	ImportDecisionReject  ImportDecision = "reject"  // too many invalid rows, nothing is imported
+)
+
+// ValidationSummary counts the validation outcome of a table or a whole job
+type ValidationSummary struct {
+	Tables        int            `json:"tables"`
+	Rows          int            `json:"rows"`
+	ValidRows     int            `json:"valid_rows"`
+	InvalidRows   int            `json:"invalid_rows"`
+	Errors        int            `json:"errors"`
+	Warnings      int            `json:"warnings"`
+	ByRule        map[string]int `json:"by_rule"`        // issues per rule
+	MissingFields []string       `json:"missing_fields"` // required product fields without a column
+	Decision      ImportDecision `json:"decision"`
+}
+
+// RowValidation is the validation of a mapped table. Rows are aligned with the table Rows
+type RowValidation struct {
+	Rows    []RowCheck        `json:"rows"`
+	Summary ValidationSummary `json:"summary"`
+}
@@ -1,11 +1,76 @@
 package dtos
 
+import "github.com/init-pkg/nova-template/domain/app"
+
 type ExcelParserManualUploadRequest struct {
-	JobId        uint64  `form:"job_id" json:"job_id" validate:"required"`
-	SupplierName string  `form:"supplier_name" json:"supplier_name"`
-	SupplierId   *uint64 `form:"supplier_id" json:"supplier_id"`
+	JobId             uint64  `form:"job_id" json:"job_id" validate:"required"`
+	SupplierName      string  `form:"supplier_name" json:"supplier_name"`
+	SupplierId        *uint64 `form:"supplier_id" json:"supplier_id"`
+	KeepHiddenSheets  bool    `form:"keep_hidden_sheets" json:"keep_hidden_sheets"`
+	KeepHiddenRows    bool    `form:"keep_hidden_rows" json:"keep_hidden_rows"`
+	KeepHiddenColumns bool    `form:"keep_hidden_columns" json:"keep_hidden_columns"`
 }
 
 func (this *ExcelParserManualUploadRequest) HasSupplier() bool {
 	return this.SupplierId != nil && *this.SupplierId > 0
 }
+
+func (this *ExcelParserManualUploadRequest) ParseOptions() app.ParseOptions {
+	var opts = app.ParseOptions{
+		KeepHiddenSheets:  this.KeepHiddenSheets,
+		KeepHiddenRows:    this.KeepHiddenRows,
+		KeepHiddenColumns: this.KeepHiddenColumns,
+	}
+	if this.HasSupplier() {
+		opts.SupplierID = *this.SupplierId
+	}
+
+	return opts
+}
+
+type ExcelParserManualUploadResponse struct {
+	Validation    app.ValidationSummary   `json:"validation"`
+	MappingErrors []ExcelParserTableError `json:"mapping_errors,omitempty"` // tables left out of the validation
+}
+
+// ExcelParserTableError is a parsed table that could not be processed
+type ExcelParserTableError struct {
+	SheetName string `json:"sheet_name"`
+	Range     string `json:"range"`
+	Error     string `json:"error"`
+}
+
+type ExcelParserDiagnoseRequest struct {
+	SupplierId        *uint64 `form:"supplier_id" json:"supplier_id"`
+	KeepHiddenSheets  bool    `form:"keep_hidden_sheets" json:"keep_hidden_sheets"`
+	KeepHiddenRows    bool    `form:"keep_hidden_rows" json:"keep_hidden_rows"`
+	KeepHiddenColumns bool    `form:"keep_hidden_columns" json:"keep_hidden_columns"`
+}
+
+func (this *ExcelParserDiagnoseRequest) ParseOptions() app.ParseOptions {
+	var opts = app.ParseOptions{
+		KeepHiddenSheets:  this.KeepHiddenSheets,
+		KeepHiddenRows:    this.KeepHiddenRows,
+		KeepHiddenColumns: this.KeepHiddenColumns,
+	}
+	if this.SupplierId != nil {
+		opts.SupplierID = *this.SupplierId
+	}
+
+	return opts
+}
+
+// ExcelParserDiagnoseResponse is the parse report with the headers of the kept tables
+type ExcelParserDiagnoseResponse struct {
+	Report *app.ParseReport          `json:"report"`
+	Tables []ExcelParserTableSummary `json:"tables"`
+	Error  string                    `json:"error,omitempty"` // parsing stopped, the report is partial
+}
+
+type ExcelParserTableSummary struct {
+	SheetName string              `json:"sheet_name"`
+	Range     string              `json:"range"`
+	Header    []string            `json:"header"`
+	RowCount  int                 `json:"row_count"`
+	Profiles  []app.ColumnProfile `json:"profiles"`
+}
@@ -21,7 +21,9 @@ require (
 	github.com/openai/openai-go/v2 v2.0.2
 	github.com/opensearch-project/opensearch-go/v4 v4.5.0
 	github.com/pressly/goose/v3 v3.24.3
+	github.com/richardlehane/mscfb v1.0.4
 	github.com/xuri/excelize/v2 v2.9.1
+	golang.org/x/text v0.25.0
 	google.golang.org/grpc v1.72.0
 )
 
@@ -72,7 +74,6 @@ require (
 	github.com/minio/md5-simd v1.1.2 // indirect
 	github.com/minio/minio-go/v7 v7.0.92 // indirect
 	github.com/philhofer/fwd v1.1.3-0.20240916144458-20a13a1f6b7c // indirect
-	github.com/richardlehane/mscfb v1.0.4 // indirect
 	github.com/richardlehane/msoleps v1.0.4 // indirect
 	github.com/rs/xid v1.6.0 // indirect
 	github.com/sethvargo/go-retry v0.3.0 // indirect
@@ -95,7 +96,6 @@ require (
 	golang.org/x/net v0.40.0 // indirect
 	golang.org/x/sync v0.14.0 // indirect
 	golang.org/x/sys v0.33.0 // indirect
-	golang.org/x/text v0.25.0 // indirect
 	golang.org/x/tools v0.33.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20250505200425-f936aa4a68b2 // indirect
 	google.golang.org/protobuf v1.36.6 // indirect
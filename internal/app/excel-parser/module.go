@@ -11,7 +11,7 @@ import (
 func Register() fx.Option {
 	return fx.Options(
 		fx.Provide(
-			fx.Annotate(excel_parser_service.New, fx.As(new(app.ExcelParserService))),
+			fx.Annotate(excel_parser_service.New, fx.As(new(app.ExcelParserService), new(app.ExcelParserCacheAdmin), new(app.ExcelParserTemplates))),
 			excel_parser_http_handler.New,
 		),
 
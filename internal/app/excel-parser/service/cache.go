@@ -0,0 +1,338 @@
+package excel_parser_service
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/init-pkg/nova-template/internal/config"
+	app_redis "github.com/init-pkg/nova-template/internal/infra/redis/client"
+	"github.com/redis/go-redis/v9"
+)
+
+// HeaderCache stores header analysis and table validation results as JSON by key.
+// A missing or expired key is a miss without error
+type HeaderCache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+	// Keys returns the stored keys that start with the prefix, in no particular order
+	Keys(ctx context.Context, prefix string) ([]string, error)
+	// AddMembers adds members to the set of the key and extends its lifetime to ttl
+	AddMembers(ctx context.Context, key string, ttl time.Duration, members ...string) error
+	// Members returns the members of the set of the key in no particular order, a missing key is an empty set
+	Members(ctx context.Context, key string) ([]string, error)
+}
+
+// Header cache backends
+const (
+	HeaderCacheBackendMemory  = "memory"
+	HeaderCacheBackendRedis   = "redis"
+	HeaderCacheBackendTwoTier = "two_tier"
+)
+
+const (
+	defaultMemoryCacheSize = 10000
+	defaultMemoryCacheTTL  = time.Hour
+)
+
+// headerCacheFromConfig builds the configured cache backend, Redis by default
+func headerCacheFromConfig(cfg config.HeaderCacheConfig, redisClient *app_redis.Client) HeaderCache {
+	var size = cfg.MemorySize
+	if size <= 0 {
+		size = defaultMemoryCacheSize
+	}
+	var ttl = defaultMemoryCacheTTL
+	if d, err := time.ParseDuration(cfg.MemoryTTL); err == nil && d > 0 {
+		ttl = d
+	}
+
+	switch cfg.Backend {
+	case HeaderCacheBackendMemory:
+		return NewMemHeaderCache(size, ttl)
+	case HeaderCacheBackendTwoTier:
+		return NewTieredHeaderCache(NewMemHeaderCache(size, ttl), NewRedisHeaderCache(redisClient))
+	default:
+		return NewRedisHeaderCache(redisClient)
+	}
+}
+
+// memHeaderCache is an in-process LRU cache with per-entry expiration.
+// maxTTL caps the entry lifetime, so entries shared with other instances do not get stale for long
+type memHeaderCache struct {
+	mu       sync.Mutex
+	capacity int
+	maxTTL   time.Duration
+	order    *list.List // front is the most recently used
+	entries  map[string]*list.Element
+}
+
+type memCacheEntry struct {
+	key       string
+	value     []byte
+	members   map[string]struct{}
+	expiresAt time.Time
+}
+
+func NewMemHeaderCache(capacity int, maxTTL time.Duration) HeaderCache {
+	return &memHeaderCache{
+		capacity: capacity,
+		maxTTL:   maxTTL,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (this *memHeaderCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	el, ok := this.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	entry := el.Value.(*memCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		this.order.Remove(el)
+		delete(this.entries, key)
+		return nil, false, nil
+	}
+
+	this.order.MoveToFront(el)
+	return entry.value, true, nil
+}
+
+func (this *memHeaderCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.put(&memCacheEntry{key: key, value: value, expiresAt: time.Now().Add(this.ttlOf(ttl))})
+	return nil
+}
+
+// ttlOf caps the entry lifetime by maxTTL
+func (this *memHeaderCache) ttlOf(ttl time.Duration) time.Duration {
+	if ttl <= 0 || ttl > this.maxTTL {
+		return this.maxTTL
+	}
+
+	return ttl
+}
+
+// put stores the entry as the most recently used one, evicting the least recently used.
+// The caller holds the mutex
+func (this *memHeaderCache) put(entry *memCacheEntry) {
+	if el, ok := this.entries[entry.key]; ok {
+		el.Value = entry
+		this.order.MoveToFront(el)
+		return
+	}
+
+	this.entries[entry.key] = this.order.PushFront(entry)
+	for this.order.Len() > this.capacity {
+		last := this.order.Back()
+		this.order.Remove(last)
+		delete(this.entries, last.Value.(*memCacheEntry).key)
+	}
+}
+
+func (this *memHeaderCache) AddMembers(ctx context.Context, key string, ttl time.Duration, members ...string) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	set := make(map[string]struct{}, len(members))
+	if el, ok := this.entries[key]; ok && !time.Now().After(el.Value.(*memCacheEntry).expiresAt) {
+		maps.Copy(set, el.Value.(*memCacheEntry).members)
+	}
+	for _, member := range members {
+		set[member] = struct{}{}
+	}
+
+	this.put(&memCacheEntry{key: key, members: set, expiresAt: time.Now().Add(this.ttlOf(ttl))})
+	return nil
+}
+
+func (this *memHeaderCache) Members(ctx context.Context, key string) ([]string, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	el, ok := this.entries[key]
+	if !ok || time.Now().After(el.Value.(*memCacheEntry).expiresAt) {
+		return nil, nil
+	}
+
+	return slices.Collect(maps.Keys(el.Value.(*memCacheEntry).members)), nil
+}
+
+func (this *memHeaderCache) Delete(ctx context.Context, keys ...string) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	for _, key := range keys {
+		if el, ok := this.entries[key]; ok {
+			this.order.Remove(el)
+			delete(this.entries, key)
+		}
+	}
+
+	return nil
+}
+
+func (this *memHeaderCache) Keys(ctx context.Context, prefix string) ([]string, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	now := time.Now()
+	var keys []string
+	for key, el := range this.entries {
+		if strings.HasPrefix(key, prefix) && !now.After(el.Value.(*memCacheEntry).expiresAt) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+// redisHeaderCache keeps entries in Redis, shared by all instances
+type redisHeaderCache struct {
+	client *app_redis.Client
+}
+
+func NewRedisHeaderCache(client *app_redis.Client) HeaderCache {
+	return &redisHeaderCache{client: client}
+}
+
+func (this *redisHeaderCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	data, err := this.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("redis get: %w", err)
+	}
+
+	return data, true, nil
+}
+
+func (this *redisHeaderCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := this.client.Set(ctx, key, value, ttl).Err(); err != nil {
+		return fmt.Errorf("redis set: %w", err)
+	}
+
+	return nil
+}
+
+func (this *redisHeaderCache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := this.client.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("redis del: %w", err)
+	}
+
+	return nil
+}
+
+func (this *redisHeaderCache) Keys(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	iter := this.client.Scan(ctx, 0, prefix+"*", 1000).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("redis scan: %w", err)
+	}
+
+	return keys, nil
+}
+
+// AddMembers adds the members and sets the expiration in one transaction, so a set never outlives ttl
+func (this *redisHeaderCache) AddMembers(ctx context.Context, key string, ttl time.Duration, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+
+	args := make([]any, len(members))
+	for i, member := range members {
+		args[i] = member
+	}
+
+	_, err := this.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, key, args...)
+		if ttl > 0 {
+			pipe.Expire(ctx, key, ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("redis sadd: %w", err)
+	}
+
+	return nil
+}
+
+func (this *redisHeaderCache) Members(ctx context.Context, key string) ([]string, error) {
+	members, err := this.client.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis smembers: %w", err)
+	}
+
+	return members, nil
+}
+
+// tieredHeaderCache reads through a local cache in front of a shared one.
+// Local misses are filled from the shared cache, writes and deletes go to both.
+// Sets are kept in the shared cache only, local copies would miss the members added by other instances
+type tieredHeaderCache struct {
+	local  HeaderCache
+	shared HeaderCache
+}
+
+func NewTieredHeaderCache(local, shared HeaderCache) HeaderCache {
+	return &tieredHeaderCache{local: local, shared: shared}
+}
+
+func (this *tieredHeaderCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if data, ok, err := this.local.Get(ctx, key); err == nil && ok {
+		return data, true, nil
+	}
+
+	data, ok, err := this.shared.Get(ctx, key)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	// Local TTL is capped by the local cache
+	_ = this.local.Set(ctx, key, data, 0)
+	return data, true, nil
+}
+
+func (this *tieredHeaderCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_ = this.local.Set(ctx, key, value, ttl)
+	return this.shared.Set(ctx, key, value, ttl)
+}
+
+func (this *tieredHeaderCache) Delete(ctx context.Context, keys ...string) error {
+	_ = this.local.Delete(ctx, keys...)
+	return this.shared.Delete(ctx, keys...)
+}
+
+// Keys returns the shared keys, local entries are copies of them
+func (this *tieredHeaderCache) Keys(ctx context.Context, prefix string) ([]string, error) {
+	return this.shared.Keys(ctx, prefix)
+}
+
+func (this *tieredHeaderCache) AddMembers(ctx context.Context, key string, ttl time.Duration, members ...string) error {
+	return this.shared.AddMembers(ctx, key, ttl, members...)
+}
+
+func (this *tieredHeaderCache) Members(ctx context.Context, key string) ([]string, error) {
+	return this.shared.Members(ctx, key)
+}
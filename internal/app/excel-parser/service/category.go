@@ -0,0 +1,295 @@
+package excel_parser_service
+
+import (
+	"strings"
+
+	"github.com/init-pkg/nova-template/domain/app"
+)
+
+// categoryMinLoneWidth is the min table width for a lone value row to be treated as a category.
+// Narrower tables often have rows with a single filled cell
+const categoryMinLoneWidth = 3
+
+// categorySignature is the layout of a separator row. Separators with different layouts
+// are different category levels: merged titles are above lone values, lone values are nested by indent
+type categorySignature struct {
+	isMerged bool
+	col      int
+}
+
+type categorySeparator struct {
+	value string
+	sig   categorySignature
+}
+
+// detectCategorySeparator reports whether the row is a category separator:
+// a single significant value that is either a merged title spanning the table or a lone text value.
+// A lone code is a product row with the SKU only
+func detectCategorySeparator(row []string, merges []app.MergeKind) (categorySeparator, bool) {
+	width := len(row)
+	value, firstCol, count, isSectionTitle := "", -1, 0, false
+
+	for c, cell := range row {
+		if c < len(merges) && merges[c] == app.MergeKindSectionTitle {
+			isSectionTitle = true
+		}
+		if cell == "" {
+			continue
+		}
+		if value != "" && cell != value {
+			return categorySeparator{}, false
+		}
+		if firstCol < 0 {
+			firstCol = c
+		}
+		value = cell
+		count++
+	}
+
+	if value == "" || isNumericOrCurrency(value) {
+		return categorySeparator{}, false
+	}
+
+	switch {
+	case isSectionTitle:
+		return categorySeparator{value: value, sig: categorySignature{isMerged: true}}, true
+	case count >= 2 && count*2 >= width && isMergedRun(merges, firstCol, count):
+		// Duplicated horizontal merge across most of the table
+		return categorySeparator{value: value, sig: categorySignature{isMerged: true}}, true
+	case count == 1 && width >= categoryMinLoneWidth && firstCol*2 < width && !isCodeLike(value):
+		return categorySeparator{value: value, sig: categorySignature{col: firstCol}}, true
+	default:
+		return categorySeparator{}, false
+	}
+}
+
+func isMergedRun(merges []app.MergeKind, start, count int) bool {
+	if start+count > len(merges) {
+		return false
+	}
+
+	for c := start; c < start+count; c++ {
+		if !merges[c].IsMerged() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isBelow reports whether separators of this layout are nested under separators of the other layout
+func (this categorySignature) isBelow(other categorySignature) bool {
+	if this.isMerged != other.isMerged {
+		return other.isMerged
+	}
+
+	return this.col > other.col
+}
+
+// categoryTracker follows separator rows of one table and tracks the current category path.
+//
+// Nesting is resolved by separator layout (merged titles, then lone values by indent)
+// and by runs of consecutive separators of the same layout: a run of two defines a parent and a child,
+// a single separator later under the same parent replaces the child only.
+//
+// A lone value off the first column of the table may be a product row with only the name filled.
+// It is a category only if a data row follows it, possibly after nested separators, so such rows
+// are held until the next row decides. R is the row reference returned with data rows
+type categoryTracker[R any] struct {
+	firstCol  int // first non-empty column of the table
+	path      []categorySeparator
+	run       []categorySeparator // consecutive separators not yet applied to the path
+	maxRun    map[categorySignature]int
+	tentative []heldSeparator[R] // lone values off the first column not yet decided
+}
+
+type heldSeparator[R any] struct {
+	sep categorySeparator
+	ref R
+}
+
+// categorizedRow is a data row with its category levels, top to bottom
+type categorizedRow[R any] struct {
+	ref    R
+	levels []string
+}
+
+func newCategoryTracker[R any](firstCol int) *categoryTracker[R] {
+	return &categoryTracker[R]{firstCol: firstCol, maxRun: make(map[categorySignature]int)}
+}
+
+// firstFilledCol returns the first column with a value in any of the rows, -1 if all rows are empty
+func firstFilledCol(rows [][]string) int {
+	first := -1
+	for _, row := range rows {
+		for c, cell := range row {
+			if cell != "" {
+				if first < 0 || c < first {
+					first = c
+				}
+				break
+			}
+		}
+	}
+
+	return first
+}
+
+// next consumes a table row and returns the data rows decided by it, in table order:
+// held rows that turned out to be products and the row itself if it is a data row
+func (this *categoryTracker[R]) next(row []string, merges []app.MergeKind, ref R) []categorizedRow[R] {
+	sep, isSep := detectCategorySeparator(row, merges)
+	switch {
+	case isSep && !sep.sig.isMerged && sep.sig.col != this.firstCol:
+		this.tentative = append(this.tentative, heldSeparator[R]{sep: sep, ref: ref})
+		return nil
+	case isSep:
+		rows := this.flush()
+		this.addSeparator(sep)
+		return rows
+	}
+
+	for _, held := range this.tentative {
+		this.addSeparator(held.sep)
+	}
+	this.tentative = nil
+	if len(this.run) > 0 {
+		this.applyRun()
+	}
+
+	return []categorizedRow[R]{{ref: ref, levels: this.levels()}}
+}
+
+// flush returns the held rows as data rows. It is called at the end of the table
+// and before a separator that ends the held rows
+func (this *categoryTracker[R]) flush() []categorizedRow[R] {
+	var rows []categorizedRow[R]
+	for _, held := range this.tentative {
+		if len(this.run) > 0 {
+			this.applyRun()
+		}
+		rows = append(rows, categorizedRow[R]{ref: held.ref, levels: this.levels()})
+	}
+	this.tentative = nil
+
+	return rows
+}
+
+func (this *categoryTracker[R]) addSeparator(sep categorySeparator) {
+	if len(this.run) > 0 && this.run[len(this.run)-1].sig != sep.sig {
+		this.applyRun()
+	}
+	this.run = append(this.run, sep)
+}
+
+func (this *categoryTracker[R]) levels() []string {
+	levels := make([]string, len(this.path))
+	for i, p := range this.path {
+		levels[i] = p.value
+	}
+
+	return levels
+}
+
+// applyRun places the run of consecutive same-layout separators into the current path
+func (this *categoryTracker[R]) applyRun() {
+	sig := this.run[0].sig
+
+	// Nesting of lower layouts starts over under a new parent
+	for other := range this.maxRun {
+		if other.isBelow(sig) {
+			delete(this.maxRun, other)
+		}
+	}
+	this.maxRun[sig] = max(this.maxRun[sig], len(this.run))
+	keepSame := this.maxRun[sig] - len(this.run)
+
+	var kept []categorySeparator
+	for _, p := range this.path {
+		if p.sig.isBelow(sig) {
+			break
+		}
+		if p.sig == sig {
+			if keepSame == 0 {
+				break
+			}
+			keepSame--
+		}
+		kept = append(kept, p)
+	}
+
+	this.path = append(kept, this.run...)
+	this.run = nil
+}
+
+// extractCategories removes category separator rows from the result and appends the synthetic
+// category column with the category path of every following row
+func extractCategories(result *app.ParseExcelResult) {
+	var rows [][]string
+	var rowMerges [][]app.MergeKind
+	var values [][]app.CellValue
+	var categoryPath [][]string
+	var sourceRows []int
+	tracker := newCategoryTracker[int](firstFilledCol(result.Rows))
+	hasCategory := false
+
+	var data []categorizedRow[int]
+	for i, row := range result.Rows {
+		var merges []app.MergeKind
+		if i < len(result.RowMerges) {
+			merges = result.RowMerges[i]
+		}
+		data = append(data, tracker.next(row, merges, i)...)
+	}
+	data = append(data, tracker.flush()...)
+
+	for _, d := range data {
+		i := d.ref
+		hasCategory = hasCategory || len(d.levels) > 0
+
+		rows = append(rows, result.Rows[i])
+		if i < len(result.RowMerges) && result.RowMerges[i] != nil {
+			rowMerges = append(rowMerges, result.RowMerges[i])
+		}
+		if i < len(result.Values) {
+			values = append(values, result.Values[i])
+		}
+		if i < len(result.SourceRows) {
+			sourceRows = append(sourceRows, result.SourceRows[i])
+		}
+		categoryPath = append(categoryPath, d.levels)
+	}
+
+	if len(rows) == len(result.Rows) {
+		return
+	}
+
+	result.Rows = rows
+	result.RowMerges = rowMerges
+	result.Values = values
+	result.SourceRows = sourceRows
+	if !hasCategory {
+		// Separators without products after them, e.g. notes at the end of the table
+		return
+	}
+
+	for i, levels := range categoryPath {
+		result.Rows[i] = append(result.Rows[i], strings.Join(levels, app.HeaderPathSeparator))
+	}
+	for i := range result.RowMerges {
+		result.RowMerges[i] = append(result.RowMerges[i], app.MergeKindNone)
+	}
+	for i := range result.Values {
+		result.Values[i] = append(result.Values[i], stringCellValue(result.Rows[i][len(result.Rows[i])-1]))
+	}
+	if result.HiddenColumns != nil {
+		result.HiddenColumns = append(result.HiddenColumns, false)
+	}
+	result.Header = append(result.Header, app.CategoryColumnHeader)
+	result.HeaderPath = append(result.HeaderPath, []string{app.CategoryColumnHeader})
+	if result.SourceColumns != nil {
+		result.SourceColumns = append(result.SourceColumns, "")
+		result.HeaderCells = append(result.HeaderCells, "")
+	}
+	result.CategoryPath = categoryPath
+}
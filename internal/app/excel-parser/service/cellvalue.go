@@ -0,0 +1,378 @@
+package excel_parser_service
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/init-pkg/nova-template/domain/app"
+	"github.com/xuri/excelize/v2"
+)
+
+// currencyMarkers maps currency symbols and codes found in number formats and texts to ISO codes.
+// Markers of letters match as whole words, isWordStart ones also as the start of a longer word: "рублей".
+// Symbols match anywhere
+var currencyMarkers = []struct {
+	marker      string
+	code        string
+	isWordStart bool
+}{
+	{"KZT", "KZT", false}, {"RUB", "RUB", false}, {"RUR", "RUB", false}, {"USD", "USD", false}, {"EUR", "EUR", false}, {"CNY", "CNY", false},
+	{"тенге", "KZT", true}, {"руб", "RUB", true}, {"тнг", "KZT", false}, {"тг", "KZT", false}, {"р.", "RUB", false},
+	{"₸", "KZT", false}, {"₽", "RUB", false}, {"$", "USD", false}, {"€", "EUR", false}, {"£", "GBP", false}, {"¥", "CNY", false},
+}
+
+// textDateLayouts are date layouts recognized in cells that have no type information
+var textDateLayouts = []string{
+	"02.01.2006", "02.01.2006 15:04", "02.01.2006 15:04:05",
+	"2006-01-02", "2006-01-02 15:04", "2006-01-02 15:04:05", "2006-01-02T15:04:05", time.RFC3339,
+	"02/01/2006",
+}
+
+// numberFormat is the number format of a cell: built-in format id or custom format code
+type numberFormat struct {
+	id   int
+	code string
+}
+
+func (this numberFormat) isDate() bool {
+	if this.code != "" {
+		return isDateFormatCode(this.code)
+	}
+
+	return (this.id >= 14 && this.id <= 22) || (this.id >= 27 && this.id <= 36) || (this.id >= 45 && this.id <= 47) || (this.id >= 50 && this.id <= 58)
+}
+
+// currency reports whether the format renders a currency amount and returns its code when known
+func (this numberFormat) currency() (string, bool) {
+	if this.code == "" {
+		// Built-in currency and accounting formats use the locale currency
+		return "", (this.id >= 5 && this.id <= 8) || this.id == 42 || this.id == 44
+	}
+
+	// [$₸-43F] or [$KZT] holds the currency symbol, [$-419] only sets the locale
+	code := this.code
+	for {
+		start := strings.Index(code, "[$")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(code[start:], "]")
+		if end < 0 {
+			break
+		}
+		symbol, _, _ := strings.Cut(code[start+2:start+end], "-")
+		if symbol != "" {
+			return DetectCurrency(symbol), true
+		}
+		code = code[start+end+1:]
+	}
+
+	if cur := DetectCurrency(strings.ReplaceAll(code, `"`, "")); cur != "" {
+		return cur, true
+	}
+
+	return "", false
+}
+
+// DetectCurrency finds a currency marker in the text and returns its ISO code, empty if none
+func DetectCurrency(text string) string {
+	lower := strings.ToLower(text)
+	for _, m := range currencyMarkers {
+		if start, _ := indexCurrencyMarker(lower, strings.ToLower(m.marker), m.isWordStart); start >= 0 {
+			return m.code
+		}
+	}
+
+	return ""
+}
+
+// indexCurrencyMarker finds the first occurrence of a lowercase marker in lowercase text that is not a part
+// of another word: "тг" is not in "бутгер", "руб" is not in "трубы". Returns the start and the end of the match,
+// which covers the rest of the word or the abbreviation dot for isWordStart markers, -1 if not found
+func indexCurrencyMarker(lower, marker string, isWordStart bool) (int, int) {
+	first, _ := utf8.DecodeRuneInString(marker)
+	for from := 0; ; {
+		i := strings.Index(lower[from:], marker)
+		if i < 0 {
+			return -1, -1
+		}
+		start, end := from+i, from+i+len(marker)
+		if !unicode.IsLetter(first) {
+			return start, end
+		}
+
+		before, _ := utf8.DecodeLastRuneInString(lower[:start])
+		after, _ := utf8.DecodeRuneInString(lower[end:])
+		switch {
+		case unicode.IsLetter(before):
+		case !unicode.IsLetter(after):
+			if isWordStart && after == '.' {
+				// abbreviation: "руб."
+				end++
+			}
+			return start, end
+		case isWordStart:
+			rest := strings.IndexFunc(lower[end:], func(r rune) bool { return !unicode.IsLetter(r) })
+			if rest < 0 {
+				return start, len(lower)
+			}
+			return start, end + rest
+		}
+		from = end
+	}
+}
+
+// stripCurrencyMarkers removes currency symbols and codes from the text, the result is lowercase
+func stripCurrencyMarkers(text string) string {
+	text = strings.ToLower(text)
+	for _, m := range currencyMarkers {
+		for {
+			start, end := indexCurrencyMarker(text, strings.ToLower(m.marker), m.isWordStart)
+			if start < 0 {
+				break
+			}
+			text = text[:start] + text[end:]
+		}
+	}
+
+	return text
+}
+
+// excelSerialToTime converts an Excel serial date to time in UTC
+func excelSerialToTime(value float64, isDate1904 bool) time.Time {
+	base := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if isDate1904 {
+		base = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	days := math.Floor(value)
+	seconds := math.Round((value - days) * 86400)
+
+	return base.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+}
+
+func stringCellValue(text string) app.CellValue {
+	if text == "" {
+		return app.CellValue{}
+	}
+
+	return app.CellValue{Type: app.CellTypeString}
+}
+
+func boolCellValue(value bool) app.CellValue {
+	return app.CellValue{Type: app.CellTypeBool, Bool: value}
+}
+
+func timeCellValue(t time.Time) app.CellValue {
+	return app.CellValue{Type: app.CellTypeDate, Time: &t}
+}
+
+// numericCellValue types a stored number by its number format: date, currency, integer or number.
+// The displayed text is a fallback source of the currency symbol for locale formats
+func numericCellValue(value float64, format numberFormat, text string, isDate1904 bool) app.CellValue {
+	if format.isDate() {
+		return timeCellValue(excelSerialToTime(value, isDate1904))
+	}
+
+	if cur, ok := format.currency(); ok {
+		if cur == "" {
+			cur = DetectCurrency(text)
+		}
+		return app.CellValue{Type: app.CellTypeCurrency, Number: value, Currency: cur}
+	}
+
+	if value == math.Trunc(value) && math.Abs(value) < 1<<53 {
+		return app.CellValue{Type: app.CellTypeInteger, Number: value}
+	}
+
+	return app.CellValue{Type: app.CellTypeNumber, Number: value}
+}
+
+// InferCellValue types a cell that has text only, e.g. in CSV files, streamed rows or mapped values
+func InferCellValue(text string) app.CellValue {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return app.CellValue{}
+	}
+
+	switch strings.ToUpper(text) {
+	case "TRUE", "ИСТИНА":
+		return boolCellValue(true)
+	case "FALSE", "ЛОЖЬ":
+		return boolCellValue(false)
+	}
+
+	for _, layout := range textDateLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			return timeCellValue(t)
+		}
+	}
+
+	if value, cur, isInteger, ok := parseNumberText(text); ok {
+		switch {
+		case cur != "":
+			return app.CellValue{Type: app.CellTypeCurrency, Number: value, Currency: cur}
+		case isInteger:
+			return app.CellValue{Type: app.CellTypeInteger, Number: value}
+		default:
+			return app.CellValue{Type: app.CellTypeNumber, Number: value}
+		}
+	}
+
+	return stringCellValue(text)
+}
+
+// parseNumberText parses formatted numbers like "1 299,00 ₸", "$1,299.00" or "-15%".
+// Codes with leading zeros such as "00123" are not numbers
+func parseNumberText(text string) (value float64, cur string, isInteger bool, ok bool) {
+	cur = DetectCurrency(text)
+	if cur != "" {
+		text = stripCurrencyMarkers(text)
+	}
+
+	var b strings.Builder
+	isPercent := false
+	for _, r := range text {
+		switch {
+		case r >= '0' && r <= '9', r == '.', r == ',', r == '-', r == '+':
+			b.WriteRune(r)
+		case r == '%':
+			isPercent = true
+		case unicode.IsSpace(r), r == '\'':
+			// thousands separators
+		default:
+			return 0, "", false, false
+		}
+	}
+
+	num := b.String()
+	if num == "" || strings.IndexAny(num, "0123456789") < 0 {
+		return 0, "", false, false
+	}
+	digits := strings.TrimLeft(num, "+-")
+	if len(digits) > 1 && digits[0] == '0' && digits[1] != '.' && digits[1] != ',' {
+		return 0, "", false, false
+	}
+
+	// The last separator is decimal if it is followed by other than three digits or both kinds are present
+	lastDot, lastComma := strings.LastIndex(num, "."), strings.LastIndex(num, ",")
+	decimal := -1
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		decimal = max(lastDot, lastComma)
+	case lastDot >= 0 && (strings.Count(num, ".") == 1 && len(num)-lastDot-1 != 3):
+		decimal = lastDot
+	case lastComma >= 0 && (strings.Count(num, ",") == 1 && len(num)-lastComma-1 != 3):
+		decimal = lastComma
+	}
+
+	var normalized strings.Builder
+	for i, r := range num {
+		switch {
+		case i == decimal:
+			normalized.WriteRune('.')
+		case r == '.' || r == ',':
+		default:
+			normalized.WriteRune(r)
+		}
+	}
+
+	value, err := strconv.ParseFloat(normalized.String(), 64)
+	if err != nil {
+		return 0, "", false, false
+	}
+	if isPercent {
+		value /= 100
+	}
+
+	return value, cur, decimal < 0 && !isPercent, true
+}
+
+// getCellValues types the cells of an xlsx sheet by the stored cell type and number format.
+// rows and raw are the formatted and unformatted values returned by GetRows, formulas are the evaluated cells
+func getCellValues(f *excelize.File, sheet string, rows, raw [][]string, formulas []*formulaCell) [][]app.CellValue {
+	computed := make(map[gridPos]bool, len(formulas))
+	for _, cell := range formulas {
+		if cell.err == nil {
+			computed[gridPos{cell.row, cell.col}] = true
+		}
+	}
+
+	var isDate1904 bool
+	if props, err := f.GetWorkbookProps(); err == nil && props.Date1904 != nil {
+		isDate1904 = *props.Date1904
+	}
+
+	formats := make(map[int]numberFormat)
+	getFormat := func(axis string) numberFormat {
+		styleID, err := f.GetCellStyle(sheet, axis)
+		if err != nil {
+			return numberFormat{}
+		}
+		if format, ok := formats[styleID]; ok {
+			return format
+		}
+
+		var format numberFormat
+		if style, err := f.GetStyle(styleID); err == nil {
+			format.id = style.NumFmt
+			if style.CustomNumFmt != nil {
+				format.code = *style.CustomNumFmt
+			}
+		}
+		formats[styleID] = format
+		return format
+	}
+
+	values := make([][]app.CellValue, len(rows))
+	for r, row := range rows {
+		values[r] = make([]app.CellValue, len(row))
+		for c, text := range row {
+			text = strings.TrimSpace(text)
+			if text == "" {
+				continue
+			}
+
+			rawValue := text
+			if r < len(raw) && c < len(raw[r]) {
+				rawValue = raw[r][c]
+			}
+
+			axis, err := excelize.CoordinatesToCellName(c+1, r+1)
+			if err != nil {
+				continue
+			}
+			cellType, err := f.GetCellType(sheet, axis)
+			if computed[gridPos{r, c}] {
+				// Formulas saved without a result may be marked as string formulas, the type comes from the result
+				cellType, err = excelize.CellTypeUnset, nil
+			}
+			if err != nil {
+				values[r][c] = stringCellValue(text)
+				continue
+			}
+
+			switch cellType {
+			case excelize.CellTypeBool:
+				values[r][c] = boolCellValue(rawValue == "1" || strings.EqualFold(rawValue, "true"))
+			case excelize.CellTypeDate:
+				values[r][c] = InferCellValue(rawValue)
+			case excelize.CellTypeUnset, excelize.CellTypeNumber:
+				// Numeric cells and formulas with a numeric result have no explicit type
+				if v, err := strconv.ParseFloat(rawValue, 64); err == nil {
+					values[r][c] = numericCellValue(v, getFormat(axis), text, isDate1904)
+				} else {
+					values[r][c] = stringCellValue(text)
+				}
+			default:
+				values[r][c] = stringCellValue(text)
+			}
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,56 @@
+package excel_parser_service
+
+import (
+	"testing"
+
+	"github.com/init-pkg/nova-template/domain/app"
+)
+
+func TestDetectCurrency(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "1 299,00 ₸", want: "KZT"},
+		{text: "$1,299.00", want: "USD"},
+		{text: "Цена, руб.", want: "RUB"},
+		{text: "100 рублей", want: "RUB"},
+		{text: "500 тг", want: "KZT"},
+		{text: "500тг", want: "KZT"},
+		{text: "10 р.", want: "RUB"},
+		{text: "Цена (USD)", want: "USD"},
+		{text: "Трубы стальные", want: ""},
+		{text: "Бутгер", want: ""},
+		{text: "пр. Абая", want: ""},
+		{text: "USDT", want: ""},
+		{text: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := DetectCurrency(tt.text); got != tt.want {
+				t.Errorf("DetectCurrency(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInferCellValueCurrency(t *testing.T) {
+	tests := []struct {
+		text string
+		want app.CellValue
+	}{
+		{text: "1 299,00 ₸", want: app.CellValue{Type: app.CellTypeCurrency, Number: 1299, Currency: "KZT"}},
+		{text: "100 рублей", want: app.CellValue{Type: app.CellTypeCurrency, Number: 100, Currency: "RUB"}},
+		{text: "12,5 руб.", want: app.CellValue{Type: app.CellTypeCurrency, Number: 12.5, Currency: "RUB"}},
+		{text: "Трубы 20", want: app.CellValue{Type: app.CellTypeString}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := InferCellValue(tt.text); got != tt.want {
+				t.Errorf("InferCellValue(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package excel_parser_service
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// csvSheetName is the sheet name reported for delimited text files that have no sheets
+const csvSheetName = "CSV"
+
+// csvDelimiterCandidates in order of preference: equally consistent delimiters are resolved by it.
+// Semicolon goes first as Russian exports use the comma as the decimal separator
+var csvDelimiterCandidates = []rune{';', ',', '\t', '|'}
+
+// csvDelimiterSampleLines is the number of non-blank lines used for delimiter detection
+const csvDelimiterSampleLines = 50
+
+// minCyrillicShare is the min share of Cyrillic characters among non-ASCII characters of a text decoded
+// as windows-1251. Binary content decodes to any characters, Russian text mostly to letters
+const minCyrillicShare = 0.8
+
+// csvSampleSize limits the amount of content used for format, delimiter and quote detection
+const csvSampleSize = 64 * 1024
+
+// decodeText detects the text encoding by BOM and content and decodes it to UTF-8
+func decodeText(file []byte) (string, string, error) {
+	var enc encoding.Encoding
+	var name string
+
+	switch {
+	case bytes.HasPrefix(file, []byte{0xEF, 0xBB, 0xBF}):
+		return string(file[3:]), "utf-8", nil
+	case bytes.HasPrefix(file, []byte{0xFF, 0xFE}):
+		enc, name = unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM), "utf-16le"
+	case bytes.HasPrefix(file, []byte{0xFE, 0xFF}):
+		enc, name = unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), "utf-16be"
+	default:
+		if order, ok := guessUTF16WithoutBOM(file); ok {
+			enc, name = unicode.UTF16(order, unicode.IgnoreBOM), "utf-16"
+		} else if utf8.Valid(file) {
+			return string(file), "utf-8", nil
+		} else {
+			enc, name = charmap.Windows1251, "windows-1251"
+		}
+	}
+
+	decoded, err := enc.NewDecoder().Bytes(file)
+	if err != nil {
+		return "", name, err
+	}
+	// Neither UTF-8 nor UTF-16 is guessed to be windows-1251, the only legacy encoding of supplier exports
+	if name == "windows-1251" && !looksCyrillic(string(decoded)) {
+		return "", name, errUnknownEncoding
+	}
+
+	return string(decoded), name, nil
+}
+
+var errUnknownEncoding = errors.New("csv: text is neither utf-8, utf-16 nor windows-1251")
+
+// looksCyrillic checks that the non-ASCII characters of the text are mostly from the Cyrillic block
+func looksCyrillic(text string) bool {
+	var nonASCII, cyrillic int
+	for _, r := range text[:min(len(text), csvSampleSize)] {
+		if r < utf8.RuneSelf {
+			continue
+		}
+		nonASCII++
+		if r >= 'Ѐ' && r <= 'ӿ' {
+			cyrillic++
+		}
+	}
+
+	return nonASCII > 0 && float64(cyrillic) >= float64(nonASCII)*minCyrillicShare
+}
+
+// guessUTF16WithoutBOM detects BOM-less UTF-16 by zero bytes on odd or even positions.
+// Both Latin and Cyrillic UTF-16 text have a predictable high byte (0x00 or 0x04)
+func guessUTF16WithoutBOM(file []byte) (unicode.Endianness, bool) {
+	sample := file[:min(len(file), csvSampleSize)]
+	if len(sample) < 4 {
+		return unicode.LittleEndian, false
+	}
+
+	var evenZeros, oddZeros int
+	for i := 0; i+1 < len(sample); i += 2 {
+		if sample[i] == 0 {
+			evenZeros++
+		}
+		if sample[i+1] == 0 {
+			oddZeros++
+		}
+	}
+
+	pairs := len(sample) / 2
+	switch {
+	case oddZeros*10 >= pairs*3 && evenZeros*10 < pairs:
+		return unicode.LittleEndian, true
+	case evenZeros*10 >= pairs*3 && oddZeros*10 < pairs:
+		return unicode.BigEndian, true
+	default:
+		return unicode.LittleEndian, false
+	}
+}
+
+// looksLikeDelimitedText checks whether decoded content is plain text with a consistent delimiter
+func looksLikeDelimitedText(file []byte) bool {
+	if len(file) == 0 {
+		return false
+	}
+
+	text, _, err := decodeText(file)
+	if err != nil {
+		return false
+	}
+
+	controlCount := 0
+	total := 0
+	for _, r := range text {
+		total++
+		if r == utf8.RuneError || (r < 0x20 && r != '\t' && r != '\r' && r != '\n') {
+			controlCount++
+		}
+	}
+	if total == 0 || controlCount*100 > total {
+		return false
+	}
+
+	_, ok := detectDelimiter(text, detectQuote(text))
+	return ok
+}
+
+// detectQuote picks the quote character that most often wraps whole fields
+func detectQuote(text string) rune {
+	sample := text[:min(len(text), csvSampleSize)]
+
+	countWrapped := func(quote rune) int {
+		count := 0
+		for _, delim := range csvDelimiterCandidates {
+			count += strings.Count(sample, string(delim)+string(quote))
+		}
+		count += strings.Count(sample, "\n"+string(quote))
+		return count
+	}
+
+	if countWrapped('\'') > countWrapped('"') {
+		return '\''
+	}
+
+	return '"'
+}
+
+// detectDelimiter picks the delimiter that splits the most lines into the same number of fields.
+// The score of a delimiter is the share of lines having its modal field count, which must be above one.
+// Ties go to the earlier candidate
+func detectDelimiter(text string, quote rune) (rune, bool) {
+	sample := text[:min(len(text), csvSampleSize)]
+
+	var best rune
+	bestScore := 0.0
+	for _, delim := range csvDelimiterCandidates {
+		records := splitDelimitedRecords(sample, delim, quote)
+		if len(text) > len(sample) && len(records) > 1 {
+			// Last record of the sample may be truncated
+			records = records[:len(records)-1]
+		}
+
+		fieldCounts := make(map[int]int)
+		lines := 0
+		for _, rec := range records {
+			if lines >= csvDelimiterSampleLines {
+				break
+			}
+			if len(rec) == 1 && strings.TrimSpace(rec[0]) == "" {
+				continue
+			}
+			fieldCounts[len(rec)]++
+			lines++
+		}
+
+		// Modal field count, the larger one of equally frequent counts
+		modal, modalLines := 0, 0
+		for fields, n := range fieldCounts {
+			if n > modalLines || (n == modalLines && fields > modal) {
+				modal, modalLines = fields, n
+			}
+		}
+		if modal < 2 {
+			continue
+		}
+
+		if score := float64(modalLines) / float64(lines); score > bestScore {
+			best = delim
+			bestScore = score
+		}
+	}
+
+	return best, bestScore > 0
+}
+
+// splitDelimitedRecords splits text into records honoring quoted fields with doubled quote escapes
+// and line breaks inside quotes
+func splitDelimitedRecords(text string, delim, quote rune) [][]string {
+	var records [][]string
+	var record []string
+	var field strings.Builder
+	isQuoted := false
+	isFieldStart := true
+
+	flushField := func() {
+		record = append(record, field.String())
+		field.Reset()
+		isFieldStart = true
+	}
+	flushRecord := func() {
+		flushField()
+		records = append(records, record)
+		record = nil
+	}
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		if isQuoted {
+			if r == quote {
+				if i+1 < len(runes) && runes[i+1] == quote {
+					field.WriteRune(quote)
+					i++
+				} else {
+					isQuoted = false
+				}
+				continue
+			}
+			field.WriteRune(r)
+			continue
+		}
+
+		switch {
+		case r == quote && isFieldStart:
+			isQuoted = true
+			isFieldStart = false
+		case r == delim:
+			flushField()
+		case r == '\r':
+			if i+1 < len(runes) && runes[i+1] == '\n' {
+				i++
+			}
+			flushRecord()
+		case r == '\n':
+			flushRecord()
+		default:
+			field.WriteRune(r)
+			isFieldStart = false
+		}
+	}
+
+	if field.Len() > 0 || len(record) > 0 {
+		flushRecord()
+	}
+
+	return records
+}
+
+// readCsvWorkbook reads delimited text into a single sheet grid. Cells have no types and are typed by their text
+func readCsvWorkbook(file []byte, policy MergePolicy) ([]*workbookSheet, string, error) {
+	text, encodingName, err := decodeText(file)
+	if err != nil {
+		return nil, encodingName, err
+	}
+
+	quote := detectQuote(text)
+	delim, ok := detectDelimiter(text, quote)
+	if !ok {
+		return nil, encodingName, errors.New("csv: delimiter not detected")
+	}
+
+	rows := splitDelimitedRecords(text, delim, quote)
+
+	return []*workbookSheet{{name: csvSheetName, grid: newSheetGrid(rows, nil, nil, policy), encoding: encodingName}}, encodingName, nil
+}
@@ -0,0 +1,82 @@
+package excel_parser_service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestDetectDelimiter(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want rune
+		ok   bool
+	}{
+		{name: "semicolon", text: "a;b;c\n1;2;3\n", want: ';', ok: true},
+		{name: "comma", text: "a,b,c\n1,2,3\n", want: ',', ok: true},
+		{name: "tab", text: "a\tb\tc\n1\t2\t3\n", want: '\t', ok: true},
+		{name: "pipe", text: "a|b|c\n1|2|3\n", want: '|', ok: true},
+		{name: "decimal commas", text: "Код;Цена\nA1;10,5\nA2;20,5\n", want: ';', ok: true},
+		{name: "tie goes to the earlier candidate", text: "a;b,c\n1;2,3\n", want: ';', ok: true},
+		{name: "quoted delimiters", text: "\"a,b\";c\n\"d,e\";f\n", want: ';', ok: true},
+		{name: "ragged lines", text: "a,b,c\nx,y\n1,2,3\n4,5,6\n", want: ',', ok: true},
+		{name: "share wins over field count", text: "a;b\n1;2\n3;4\nx,y,z,u,v,w\n", want: ';', ok: true},
+		{name: "blank lines ignored", text: "a;b\n\n1;2\n\n", want: ';', ok: true},
+		{name: "single column", text: "abc\ndef\n", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := detectDelimiter(tt.text, detectQuote(tt.text))
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("delimiter = %q, %v, want %q, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	const text = "Код;Цена\nБолт;10\n"
+
+	cp1251, err := charmap.Windows1251.NewEncoder().Bytes([]byte(text))
+	if err != nil {
+		t.Fatalf("encode windows-1251: %v", err)
+	}
+	utf16le, err := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewEncoder().Bytes([]byte(text))
+	if err != nil {
+		t.Fatalf("encode utf-16: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		file     []byte
+		encoding string
+		err      error
+	}{
+		{name: "utf-8", file: []byte(text), encoding: "utf-8"},
+		{name: "utf-8 with BOM", file: append([]byte{0xEF, 0xBB, 0xBF}, text...), encoding: "utf-8"},
+		{name: "utf-16le with BOM", file: append([]byte{0xFF, 0xFE}, utf16le...), encoding: "utf-16le"},
+		{name: "utf-16le without BOM", file: utf16le, encoding: "utf-16"},
+		{name: "windows-1251", file: cp1251, encoding: "windows-1251"},
+		{name: "binary", file: []byte(strings.Repeat("\x89\x95\x99\xA6;\x01\x02\n", 10)), encoding: "windows-1251", err: errUnknownEncoding},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, encoding, err := decodeText(tt.file)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if encoding != tt.encoding {
+				t.Errorf("encoding = %s, want %s", encoding, tt.encoding)
+			}
+			if tt.err == nil && got != text {
+				t.Errorf("text = %q, want %q", got, text)
+			}
+		})
+	}
+}
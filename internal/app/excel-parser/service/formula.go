@@ -0,0 +1,212 @@
+package excel_parser_service
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/init-pkg/nova-template/domain/app"
+	"github.com/xuri/excelize/v2"
+)
+
+// formulaErrorValues are Excel error results. A formula evaluated to one of them has failed
+var formulaErrorValues = map[string]bool{
+	"#NULL!": true, "#DIV/0!": true, "#VALUE!": true, "#REF!": true, "#NAME?": true,
+	"#NUM!": true, "#N/A": true, "#GETTING_DATA": true, "#SPILL!": true, "#CALC!": true,
+}
+
+// errFormulaNotStreamed fails formula cells of streamed sheets: the calculation engine loads the whole worksheet
+var errFormulaNotStreamed = errors.New("formula is not evaluated in stream mode")
+
+// formulaCell is a formula cell without a cached result, 0-based source coordinates
+type formulaCell struct {
+	row, col int
+	formula  string
+	text     string // formatted result
+	raw      string // unformatted result
+	err      error
+}
+
+// readXlsxFormulaCells finds formula cells that were saved without a cached result.
+// Generators often write formulas only and rely on Excel to recalculate on open,
+// such cells are empty in GetRows and in the row iterator
+func readXlsxFormulaCells(file []byte, sheet string) ([]*formulaCell, error) {
+	rc, err := openXlsxWorksheet(file, sheet)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var cells []*formulaCell
+	var inSheetData, inValue, inFormula, hasFormula, hasValue bool
+	var formula []byte
+	row, col := 0, 0
+
+	decoder := xml.NewDecoder(rc)
+	for {
+		tok, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch el.Name.Local {
+			case "sheetData":
+				inSheetData = true
+			case "row":
+				// r is optional, rows without it follow the previous one
+				row = odsAttrInt(el, "r", row+1)
+				col = 0
+			case "c":
+				col++
+				if ref := odsAttr(el, "r"); ref != "" {
+					if c, r, err := excelize.CellNameToCoordinates(ref); err == nil {
+						col, row = c, r
+					}
+				}
+				hasFormula, hasValue = false, false
+				formula = formula[:0]
+			case "f":
+				hasFormula, inFormula = inSheetData, inSheetData
+			case "v":
+				inValue = true
+			}
+		case xml.CharData:
+			// An empty <v/> is written by generators for formulas that were never calculated
+			if inValue && len(el) > 0 {
+				hasValue = true
+			}
+			// Formula text, empty for cells sharing the formula of another cell
+			if inFormula {
+				formula = append(formula, el...)
+			}
+		case xml.EndElement:
+			switch el.Name.Local {
+			case "v":
+				inValue = false
+			case "f":
+				inFormula = false
+			case "sheetData":
+				return cells, nil
+			case "c":
+				if hasFormula && !hasValue {
+					cells = append(cells, &formulaCell{row: row - 1, col: col - 1, formula: string(formula)})
+				}
+			}
+		}
+	}
+
+	return cells, nil
+}
+
+func (this *formulaCell) axis() string {
+	axis, _ := excelize.CoordinatesToCellName(this.col+1, this.row+1)
+	return axis
+}
+
+// evaluate computes the formula with the excelize calculation engine.
+// The worksheet is loaded into memory on the first call
+func (this *formulaCell) evaluate(f *excelize.File, sheet string) {
+	axis := this.axis()
+	this.formula, _ = f.GetCellFormula(sheet, axis)
+
+	raw, err := f.CalcCellValue(sheet, axis, excelize.Options{RawCellValue: true})
+	switch {
+	case err != nil:
+		this.err = err
+		return
+	case formulaErrorValues[raw]:
+		this.err = errors.New(raw)
+		return
+	}
+
+	this.raw, this.text = raw, raw
+	if _, err := strconv.ParseFloat(raw, 64); err == nil {
+		// Numbers are displayed by the cell number format
+		if text, err := f.CalcCellValue(sheet, axis); err == nil {
+			this.text = text
+		}
+	}
+}
+
+func (this *formulaCell) report() app.FormulaCell {
+	res := app.FormulaCell{Cell: this.axis(), Formula: this.formula}
+	if this.err != nil {
+		res.Error = this.err.Error()
+	}
+
+	return res
+}
+
+// evaluateFormulas evaluates formula cells of an xlsx sheet and puts the results into the text
+// and raw rows of GetRows, extending them as needed. Failed cells are left empty
+func evaluateFormulas(f *excelize.File, sheet string, cells []*formulaCell, rows, raw [][]string) ([][]string, [][]string) {
+	set := func(grid [][]string, row, col int, value string) [][]string {
+		for len(grid) <= row {
+			grid = append(grid, nil)
+		}
+		for len(grid[row]) <= col {
+			grid[row] = append(grid[row], "")
+		}
+		grid[row][col] = value
+		return grid
+	}
+
+	for _, cell := range cells {
+		cell.evaluate(f, sheet)
+		if cell.err != nil {
+			continue
+		}
+		rows = set(rows, cell.row, cell.col, cell.text)
+		raw = set(raw, cell.row, cell.col, cell.raw)
+	}
+
+	return rows, raw
+}
+
+// formulaReport returns the evaluated and failed formula cells that made it into the region
+func (this *sheetGrid) formulaReport(region tableRegion) (computed, failed []app.FormulaCell) {
+	if len(this.formulas) == 0 {
+		return nil, nil
+	}
+
+	rows := make(map[int]bool, region.endRow-region.startRow+1)
+	for r := region.startRow; r <= region.endRow; r++ {
+		rows[this.sourceRow(r)] = true
+	}
+	cols := make(map[int]bool, region.endCol-region.startCol+1)
+	for c := region.startCol; c <= region.endCol; c++ {
+		cols[this.sourceCol(c)] = true
+	}
+
+	for _, cell := range this.formulas {
+		if !rows[cell.row] || !cols[cell.col] {
+			continue
+		}
+		if cell.err != nil {
+			failed = append(failed, cell.report())
+		} else {
+			computed = append(computed, cell.report())
+		}
+	}
+
+	return computed, failed
+}
+
+// formulaSummary is a log friendly count of evaluated formula cells
+func formulaSummary(cells []*formulaCell) (computed, failed int) {
+	for _, cell := range cells {
+		if cell.err != nil {
+			failed++
+		} else {
+			computed++
+		}
+	}
+
+	return computed, failed
+}
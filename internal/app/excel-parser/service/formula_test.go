@@ -0,0 +1,103 @@
+package excel_parser_service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/init-pkg/nova-template/domain/app"
+	"github.com/xuri/excelize/v2"
+)
+
+// withEmptyCachedValues rewrites the worksheets of an xlsx file so that formulas have an empty cached value,
+// as openpyxl writes formulas it never calculated
+func withEmptyCachedValues(t *testing.T, file []byte) []byte {
+	t.Helper()
+
+	zr, err := zip.NewReader(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatalf("open xlsx: %v", err)
+	}
+
+	var out bytes.Buffer
+	zw := zip.NewWriter(&out)
+	for _, entry := range zr.File {
+		rc, err := entry.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", entry.Name, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", entry.Name, err)
+		}
+		if strings.HasPrefix(entry.Name, "xl/worksheets/") {
+			data = []byte(strings.ReplaceAll(string(data), "</f>", "</f><v/>"))
+		}
+
+		w, err := zw.Create(entry.Name)
+		if err != nil {
+			t.Fatalf("create %s: %v", entry.Name, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatalf("write %s: %v", entry.Name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("close xlsx: %v", err)
+	}
+
+	return out.Bytes()
+}
+
+func TestParseEvaluatesFormulasWithEmptyCachedValue(t *testing.T) {
+	f := excelize.NewFile()
+	defer f.Close()
+	rows := [][]any{
+		{"Код", "Наименование", "Цена", "Количество", "Сумма"},
+		{"A1", "Болт", 10, 3},
+		{"A2", "Гайка", 20, 2},
+	}
+	for r, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, r+1)
+		if err := f.SetSheetRow("Sheet1", cell, &row); err != nil {
+			t.Fatalf("set row: %v", err)
+		}
+	}
+	for r := 2; r <= len(rows); r++ {
+		if err := f.SetCellFormula("Sheet1", fmt.Sprintf("E%d", r), fmt.Sprintf("C%d*D%d", r, r)); err != nil {
+			t.Fatalf("set formula: %v", err)
+		}
+	}
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		t.Fatalf("write xlsx: %v", err)
+	}
+	file := withEmptyCachedValues(t, buf.Bytes())
+
+	cells, err := readXlsxFormulaCells(file, "Sheet1")
+	if err != nil {
+		t.Fatalf("read formula cells: %v", err)
+	}
+	if len(cells) != 2 {
+		t.Fatalf("got %d formula cells without a result, want 2", len(cells))
+	}
+
+	s, _ := newTestService(t)
+	results, err := s.parse(context.Background(), file, app.ParseOptions{}, nil)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(results) != 1 || len(results[0].Rows) != 2 {
+		t.Fatalf("got %d tables, want 1 with 2 rows", len(results))
+	}
+	for i, want := range []string{"30", "40"} {
+		if got := results[0].Rows[i][4]; got != want {
+			t.Errorf("row %d sum = %q, want %q", i, got, want)
+		}
+	}
+}
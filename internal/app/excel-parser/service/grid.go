@@ -0,0 +1,268 @@
+package excel_parser_service
+
+import (
+	"strings"
+
+	"github.com/init-pkg/nova-template/domain/app"
+	"github.com/init-pkg/nova-template/internal/config"
+)
+
+// MergeExpansion defines how a merged range is expanded into grid cells
+type MergeExpansion string
+
+const (
+	MergeExpansionDuplicate MergeExpansion = "duplicate" // copy value into every covered cell
+	MergeExpansionSpan      MergeExpansion = "span"      // keep value in the first cell, covered cells reference the group
+	MergeExpansionMark      MergeExpansion = "mark"      // keep value in the first cell and mark the range as a section title
+)
+
+func (this MergeExpansion) IsValid() bool {
+	switch this {
+	case MergeExpansionDuplicate, MergeExpansionSpan, MergeExpansionMark:
+		return true
+	default:
+		return false
+	}
+}
+
+// MergePolicy defines merge expansion per region of the sheet
+type MergePolicy struct {
+	Vertical     MergeExpansion // single-column merges, e.g. a brand shared by several body rows
+	Horizontal   MergeExpansion // multi-column merges inside the body
+	HeaderGroup  MergeExpansion // multi-column merges with sub-headers below, e.g. "Цена" over "USD | KZT"
+	SectionTitle MergeExpansion // multi-column merges that are the only value in their row, e.g. "Ноутбуки"
+}
+
+func DefaultMergePolicy() MergePolicy {
+	return MergePolicy{
+		Vertical:     MergeExpansionDuplicate,
+		Horizontal:   MergeExpansionDuplicate,
+		HeaderGroup:  MergeExpansionSpan,
+		SectionTitle: MergeExpansionMark,
+	}
+}
+
+// mergePolicyFromConfig overrides default policy with valid configured values
+func mergePolicyFromConfig(cfg config.MergePolicyConfig) MergePolicy {
+	var policy = DefaultMergePolicy()
+
+	var override = func(dst *MergeExpansion, value string) {
+		if v := MergeExpansion(value); v.IsValid() {
+			*dst = v
+		}
+	}
+
+	override(&policy.Vertical, cfg.Vertical)
+	override(&policy.Horizontal, cfg.Horizontal)
+	override(&policy.HeaderGroup, cfg.HeaderGroup)
+	override(&policy.SectionTitle, cfg.SectionTitle)
+
+	return policy
+}
+
+// mergeRange is a merged cell range with 0-based inclusive coordinates
+type mergeRange struct {
+	startRow, startCol int
+	endRow, endCol     int
+	value              string
+}
+
+type gridPos struct {
+	row, col int
+}
+
+// sheetGrid is a rectangular cell matrix of one sheet with merge metadata.
+// It is the common model produced by all workbook readers
+type sheetGrid struct {
+	cells  [][]string
+	merges [][]app.MergeKind
+	values [][]app.CellValue
+	groups map[gridPos]string // covered cell -> value of the header group span it belongs to
+	maxCol int
+
+	hiddenRows []bool // rows hidden in the source, nil if the format has no visibility
+	hiddenCols []bool // columns hidden in the source, nil if the format has no visibility
+
+	srcRows []int // source sheet row of every grid row, nil if they match
+	srcCols []int // source sheet column of every grid column, nil if they match
+
+	formulas []*formulaCell // evaluated formula cells without cached results, source coordinates
+}
+
+func (this *sheetGrid) sourceRow(row int) int {
+	if row >= 0 && row < len(this.srcRows) {
+		return this.srcRows[row]
+	}
+
+	return row
+}
+
+func (this *sheetGrid) sourceCol(col int) int {
+	if col >= 0 && col < len(this.srcCols) {
+		return this.srcCols[col]
+	}
+
+	return col
+}
+
+// newSheetGrid builds a rectangular grid from raw rows and expands merged ranges according to policy.
+// Typed values come from the reader, cells without one are typed by their text
+func newSheetGrid(rows [][]string, values [][]app.CellValue, merges []mergeRange, policy MergePolicy) *sheetGrid {
+	maxCol := 0
+	for _, row := range rows {
+		if len(row) > maxCol {
+			maxCol = len(row)
+		}
+	}
+
+	sg := &sheetGrid{
+		cells:  make([][]string, len(rows)),
+		merges: make([][]app.MergeKind, len(rows)),
+		values: make([][]app.CellValue, len(rows)),
+		groups: make(map[gridPos]string),
+		maxCol: maxCol,
+	}
+
+	for i := range rows {
+		sg.cells[i] = make([]string, maxCol)
+		sg.merges[i] = make([]app.MergeKind, maxCol)
+		sg.values[i] = make([]app.CellValue, maxCol)
+		// Apply trim to all cell values
+		for j, cell := range rows[i] {
+			sg.cells[i][j] = strings.TrimSpace(cell)
+			if i < len(values) && j < len(values[i]) {
+				sg.values[i][j] = values[i][j]
+			} else {
+				sg.values[i][j] = InferCellValue(sg.cells[i][j])
+			}
+		}
+	}
+
+	// Classify on raw values so that one expanded range does not affect another
+	expansions := make([]MergeExpansion, len(merges))
+	for i, m := range merges {
+		expansions[i] = sg.classifyMerge(m, policy)
+	}
+
+	for i, m := range merges {
+		sg.expandMerge(m, expansions[i])
+	}
+
+	return sg
+}
+
+// classifyMerge detects the region of a merged range and returns the expansion to apply
+func (this *sheetGrid) classifyMerge(m mergeRange, policy MergePolicy) MergeExpansion {
+	if m.startCol == m.endCol {
+		return policy.Vertical
+	}
+
+	if this.isSectionTitleMerge(m) {
+		return policy.SectionTitle
+	}
+
+	if this.hasSubHeadersBelow(m) {
+		return policy.HeaderGroup
+	}
+
+	return policy.Horizontal
+}
+
+// isSectionTitleMerge reports whether the range is the only value in its rows and spans most of the table
+func (this *sheetGrid) isSectionTitleMerge(m mergeRange) bool {
+	width := m.endCol - m.startCol + 1
+	if width < 2 || width*2 < this.maxCol {
+		return false
+	}
+
+	for r := m.startRow; r <= m.endRow && r < len(this.cells); r++ {
+		for c := 0; c < this.maxCol; c++ {
+			if c >= m.startCol && c <= m.endCol {
+				continue
+			}
+			if this.cells[r][c] != "" {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// hasSubHeadersBelow reports whether the row below the range has several values inside the covered columns
+func (this *sheetGrid) hasSubHeadersBelow(m mergeRange) bool {
+	below := m.endRow + 1
+	if below >= len(this.cells) {
+		return false
+	}
+
+	nonEmpty := 0
+	for c := m.startCol; c <= m.endCol && c < this.maxCol; c++ {
+		if this.cells[below][c] != "" {
+			nonEmpty++
+		}
+	}
+
+	return nonEmpty >= 2
+}
+
+func (this *sheetGrid) expandMerge(m mergeRange, expansion MergeExpansion) {
+	val := strings.TrimSpace(m.value) // Apply trim to merged cell values too
+	var typed app.CellValue
+	if m.startRow < len(this.values) && m.startCol < this.maxCol {
+		typed = this.values[m.startRow][m.startCol]
+	}
+	if typed.Type == app.CellTypeEmpty {
+		typed = InferCellValue(val)
+	}
+
+	for r := m.startRow; r <= m.endRow && r < len(this.cells); r++ {
+		for c := m.startCol; c <= m.endCol && c < this.maxCol; c++ {
+			isOrigin := r == m.startRow && c == m.startCol
+			if isOrigin || expansion == MergeExpansionDuplicate {
+				this.values[r][c] = typed
+			} else {
+				this.values[r][c] = app.CellValue{}
+			}
+
+			switch expansion {
+			case MergeExpansionSpan:
+				if isOrigin {
+					this.cells[r][c] = val
+					this.merges[r][c] = app.MergeKindOrigin
+				} else {
+					this.cells[r][c] = ""
+					this.merges[r][c] = app.MergeKindSpan
+					this.groups[gridPos{r, c}] = val
+				}
+			case MergeExpansionMark:
+				if isOrigin {
+					this.cells[r][c] = val
+				} else {
+					this.cells[r][c] = ""
+				}
+				this.merges[r][c] = app.MergeKindSectionTitle
+			default:
+				this.cells[r][c] = val
+				if isOrigin {
+					this.merges[r][c] = app.MergeKindOrigin
+				} else {
+					this.merges[r][c] = app.MergeKindDuplicated
+				}
+			}
+		}
+	}
+}
+
+// headerValue returns the cell value, resolving header group spans to the group value
+func (this *sheetGrid) headerValue(row, col int) string {
+	if row < 0 || row >= len(this.cells) || col < 0 || col >= len(this.cells[row]) {
+		return ""
+	}
+
+	if val := this.cells[row][col]; val != "" {
+		return val
+	}
+
+	return this.groups[gridPos{row, col}]
+}
@@ -0,0 +1,380 @@
+package excel_parser_service
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/init-pkg/nova-template/domain/app"
+)
+
+// DetectionMode defines how header rows and product tables are detected
+type DetectionMode string
+
+const (
+	DetectionModeLLM       DetectionMode = "llm"       // language model, rule-based detection when it is unavailable
+	DetectionModeHeuristic DetectionMode = "heuristic" // rule-based detection only, no network calls
+)
+
+func (this DetectionMode) IsValid() bool {
+	switch this {
+	case DetectionModeLLM, DetectionModeHeuristic:
+		return true
+	default:
+		return false
+	}
+}
+
+func detectionModeFromConfig(value string) DetectionMode {
+	if mode := DetectionMode(value); mode.IsValid() {
+		return mode
+	}
+
+	return DetectionModeLLM
+}
+
+// Heuristic detection limits
+const (
+	heuristicHeaderCandidates = 10 // rows from the table start checked as the header row
+	heuristicMaxSubHeaders    = 3  // header-like rows between the header row and data
+	heuristicDataSampleRows   = 10 // rows below a candidate used for type consistency
+	heuristicMinConfidence    = 7  // same threshold as model answers
+)
+
+// productKeywordGroup is a kind of product column recognized by header keywords
+type productKeywordGroup struct {
+	name       string
+	isIdentity bool // identifies the product: name or code
+	keywords   []string
+}
+
+// productKeywordGroups are header keywords of product catalog columns.
+// Keywords match at the start of a header word, so stems cover word forms.
+// Keywords with a trailing space match whole words only
+var productKeywordGroups = []productKeywordGroup{
+	{name: "code", isIdentity: true, keywords: []string{
+		"артикул", "арт ", "код", "sku", "art ", "article", "code", "part number", "partnumber", "p n", "штрихкод", "штрих код", "ean", "barcode",
+	}},
+	{name: "name", isIdentity: true, keywords: []string{
+		"наименован", "название", "товар", "номенклатур", "продукц", "модель", "name", "product", "item", "model", "description", "описан",
+	}},
+	{name: "price", keywords: []string{
+		"цена", "цены", "стоимост", "прайс", "опт ", "оптов", "розн", "ррц", "мрц", "price", "cost", "rrp", "msrp", "wholesale", "retail",
+	}},
+	{name: "quantity", keywords: []string{
+		"остат", "наличи", "кол во", "колич", "склад", "резерв", "stock", "qty", "quantity", "availab", "inventory",
+	}},
+	{name: "brand", keywords: []string{
+		"бренд", "производител", "марка", "торговая марка", "brand", "manufacturer", "vendor", "maker",
+	}},
+	{name: "unit", keywords: []string{
+		"ед изм", "единиц", "упаков", "unit", "uom ", "pack",
+	}},
+}
+
+// genericHeaderKeywords are common column titles of any table. They help to find the header row
+// of tables that are not product catalogs, such tables are then rejected by product keywords
+var genericHeaderKeywords = []string{
+	"n ", "no ", "номер", "дата", "сумма", "итого", "всего", "примечан", "комментар", "тип ", "вид ", "статус",
+	"группа", "категор", "раздел", "размер", "цвет ", "вес ", "объем", "страна", "гарант", "срок",
+	"фио ", "имя ", "менеджер", "телефон", "тел ", "email", "e mail", "адрес", "город ", "контакт",
+	"number", "date", "amount", "total", "note", "comment", "type", "status", "group", "category",
+	"size", "color", "colour", "weight", "country", "warranty", "phone", "address", "city", "contact",
+}
+
+// isKnownHeader reports whether the text is a product or generic column title
+func isKnownHeader(text string) bool {
+	if len(matchKeywordGroups(text)) > 0 {
+		return true
+	}
+
+	normalized := " " + normalizeKeywordText(text) + " "
+	for _, kw := range genericHeaderKeywords {
+		if strings.Contains(normalized, " "+kw) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalizeKeywordText lowercases the text and replaces punctuation with single spaces
+func normalizeKeywordText(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// matchKeywordGroups returns the product keyword groups found in the header
+func matchKeywordGroups(header string) []productKeywordGroup {
+	text := " " + normalizeKeywordText(header) + " "
+
+	var groups []productKeywordGroup
+	for _, group := range productKeywordGroups {
+		for _, kw := range group.keywords {
+			if strings.Contains(text, " "+kw) {
+				groups = append(groups, group)
+				break
+			}
+		}
+	}
+
+	return groups
+}
+
+// cellKind is a coarse cell type used for type consistency of columns
+type cellKind int
+
+const (
+	cellKindEmpty cellKind = iota
+	cellKindText
+	cellKindNumber
+	cellKindDate
+	cellKindBool
+)
+
+func kindOf(value app.CellValue, text string) cellKind {
+	if value.Type == app.CellTypeEmpty {
+		value = InferCellValue(text)
+	}
+
+	switch value.Type {
+	case app.CellTypeEmpty:
+		return cellKindEmpty
+	case app.CellTypeNumber, app.CellTypeInteger, app.CellTypeCurrency:
+		return cellKindNumber
+	case app.CellTypeDate:
+		return cellKindDate
+	case app.CellTypeBool:
+		return cellKindBool
+	default:
+		return cellKindText
+	}
+}
+
+func (this *sheetGrid) kindAt(row, col int) cellKind {
+	if row >= len(this.cells) || col >= len(this.cells[row]) {
+		return cellKindEmpty
+	}
+
+	var value app.CellValue
+	if row < len(this.values) && col < len(this.values[row]) {
+		value = this.values[row][col]
+	}
+
+	return kindOf(value, strings.TrimSpace(this.cells[row][col]))
+}
+
+// detectHeaderRowHeuristic picks the header row among the first rows of the table and the row where data starts.
+//
+// Every candidate is scored by header quality of its cells (scoreHeaderQuality, looksLikeColumnName),
+// coverage of the table width, product keywords, and type consistency of the rows below:
+// a real header is text over columns that keep one type
+func detectHeaderRowHeuristic(sg *sheetGrid, startRow int) (headerRow, dataStart int) {
+	headerRow, bestScore := -1, 0.0
+	for r := startRow; r < len(sg.cells) && r < startRow+heuristicHeaderCandidates; r++ {
+		score, ok := sg.headerRowScore(r)
+		if ok && (headerRow < 0 || score > bestScore) {
+			headerRow, bestScore = r, score
+		}
+	}
+	if headerRow < 0 {
+		headerRow = startRow
+	}
+
+	// Sub-header rows below the header are part of it, data starts at the first row that is not header-like
+	dataStart = headerRow + 1
+	for dataStart < len(sg.cells) && dataStart <= headerRow+heuristicMaxSubHeaders {
+		if !sg.isBlank(dataStart, 0, sg.maxCol-1) && !sg.isHeaderLikeRow(dataStart, 0, sg.maxCol-1) {
+			break
+		}
+		dataStart++
+	}
+	if dataStart >= len(sg.cells) || dataStart > headerRow+heuristicMaxSubHeaders {
+		dataStart = headerRow + 1
+	}
+
+	return headerRow, dataStart
+}
+
+// headerRowScore scores the row as the table header. Rows with less than two text cells are not candidates
+func (this *sheetGrid) headerRowScore(row int) (float64, bool) {
+	var filled, texts, columnNames, numbers, keywords int
+	var quality float64
+	for c := 0; c < this.maxCol; c++ {
+		val := strings.TrimSpace(this.headerValue(row, c))
+		if val == "" {
+			continue
+		}
+		filled++
+
+		if this.kindAt(row, c) != cellKindText || isNumericOrCurrency(val) {
+			numbers++
+			continue
+		}
+		texts++
+		quality += float64(scoreHeaderQuality(val))
+		if looksLikeColumnName(val) {
+			columnNames++
+		}
+		if isKnownHeader(val) {
+			keywords++
+		}
+	}
+	if texts < 2 {
+		return 0, false
+	}
+
+	consistency, contrast := this.columnConsistency(row)
+
+	score := quality / float64(texts) * 0.5
+	score += 3 * float64(columnNames) / float64(texts)
+	score += 3 * float64(filled) / float64(this.maxCol)
+	score += 2 * float64(min(keywords, 3))
+	score += 4*consistency + 2*contrast
+	score -= 5 * float64(numbers) / float64(filled)
+
+	return score, true
+}
+
+// columnConsistency measures the rows below the header row: the average share of the dominant
+// type per column and the share of columns whose data type differs from the text header
+func (this *sheetGrid) columnConsistency(headerRow int) (consistency, contrast float64) {
+	var columns int
+	for c := 0; c < this.maxCol; c++ {
+		if this.headerValue(headerRow, c) == "" {
+			continue
+		}
+
+		var counts [cellKindBool + 1]int
+		total := 0
+		for r := headerRow + 1; r < len(this.cells) && r <= headerRow+heuristicDataSampleRows; r++ {
+			if kind := this.kindAt(r, c); kind != cellKindEmpty {
+				counts[kind]++
+				total++
+			}
+		}
+		if total == 0 {
+			continue
+		}
+		columns++
+
+		dominant, dominantCount := cellKindEmpty, 0
+		for kind := cellKindText; kind <= cellKindBool; kind++ {
+			if count := counts[kind]; count > dominantCount {
+				dominant, dominantCount = kind, count
+			}
+		}
+		consistency += float64(dominantCount) / float64(total)
+		if dominant != cellKindText {
+			contrast++
+		}
+	}
+	if columns == 0 {
+		return 0, 0
+	}
+
+	return consistency / float64(columns), contrast / float64(columns)
+}
+
+// classifyProductTable decides whether the table is a product catalog by header keywords and sample data.
+// The answer has the shape of the model answer, so the same confidence threshold applies
+func classifyProductTable(header []string, sampleRows [][]string) *GPTTableValidationResponse {
+	matched := make(map[string]bool)
+	hasIdentity := false
+	for _, h := range header {
+		for _, group := range matchKeywordGroups(h) {
+			matched[group.name] = true
+			hasIdentity = hasIdentity || group.isIdentity
+		}
+	}
+
+	// A product table has at least one mostly numeric column such as price or stock
+	hasNumeric := false
+	for c := range header {
+		numeric, filled := 0, 0
+		for _, row := range sampleRows {
+			if c >= len(row) || strings.TrimSpace(row[c]) == "" {
+				continue
+			}
+			filled++
+			if _, _, _, ok := parseNumberText(strings.TrimSpace(row[c])); ok {
+				numeric++
+			}
+		}
+		if filled > 0 && numeric*2 >= filled {
+			hasNumeric = true
+			break
+		}
+	}
+
+	confidence := 2
+	switch {
+	case hasIdentity && (matched["price"] || matched["quantity"]):
+		confidence = 9
+	case hasIdentity && len(matched) >= 2:
+		confidence = 7
+	case len(matched) >= 2:
+		confidence = 6
+	case len(matched) == 1 && hasNumeric:
+		confidence = 4
+	}
+	if hasNumeric && confidence >= 6 {
+		confidence = min(confidence+1, 10)
+	}
+	if len(sampleRows) == 0 {
+		confidence = max(confidence-3, 1)
+	}
+
+	groups := make([]string, 0, len(matched))
+	for _, group := range productKeywordGroups {
+		if matched[group.name] {
+			groups = append(groups, group.name)
+		}
+	}
+
+	return &GPTTableValidationResponse{
+		IsProductTable: confidence >= heuristicMinConfidence,
+		Confidence:     confidence,
+		Reasoning: fmt.Sprintf("Heuristic: product columns [%s], numeric data column: %t",
+			strings.Join(groups, ", "), hasNumeric),
+	}
+}
+
+// parseTableHeuristic detects the header and validates the table without a language model
+func (this *ExcelParserService) parseTableHeuristic(sheet string, sg *sheetGrid, startRow int, trace *tableTrace) *app.ParseExcelResult {
+	headerRow, dataStart := detectHeaderRowHeuristic(sg, startRow)
+	result := buildResultWithIndices(sg, startRow, 1, headerRow, dataStart, sg.maxCol, sheet)
+	trace.headerAnalysis(app.DecisionSourceHeuristic, nil, headerRow, dataStart)
+
+	sampleRows := result.Rows
+	if len(sampleRows) > heuristicDataSampleRows {
+		sampleRows = sampleRows[:heuristicDataSampleRows]
+	}
+	validation := classifyProductTable(result.Header, sampleRows)
+	trace.validation(app.DecisionSourceHeuristic, validation)
+
+	this.log.Info("Heuristic table detection",
+		"sheet", sheet,
+		"headerRow", headerRow,
+		"dataStart", dataStart,
+		"header", result.Header,
+		"isProductTable", validation.IsProductTable,
+		"confidence", validation.Confidence,
+		"reasoning", validation.Reasoning)
+
+	if !validation.IsProductTable {
+		trace.decide(false, reasonNotProductTable)
+		return nil
+	}
+
+	trace.decide(true, reasonProductTable)
+	return result
+}
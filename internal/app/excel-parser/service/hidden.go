@@ -0,0 +1,84 @@
+package excel_parser_service
+
+import (
+	"github.com/init-pkg/nova-template/domain/app"
+)
+
+// setHidden stores row and column visibility read from the source, padded or cut to the grid size
+func (this *sheetGrid) setHidden(rows, cols []bool) {
+	this.hiddenRows = make([]bool, len(this.cells))
+	copy(this.hiddenRows, rows)
+	this.hiddenCols = make([]bool, this.maxCol)
+	copy(this.hiddenCols, cols)
+}
+
+func (this *sheetGrid) isRowHidden(row int) bool {
+	return row < len(this.hiddenRows) && this.hiddenRows[row]
+}
+
+func (this *sheetGrid) isColHidden(col int) bool {
+	return col < len(this.hiddenCols) && this.hiddenCols[col]
+}
+
+// withoutHidden applies parse options to the grid: hidden rows and columns are removed unless kept.
+// Merges are expanded before, so values of merged ranges starting in a hidden cell are not lost
+func (this *sheetGrid) withoutHidden(opts app.ParseOptions) *sheetGrid {
+	var keptRows, keptCols []int
+	for r := range this.cells {
+		if opts.KeepHiddenRows || !this.isRowHidden(r) {
+			keptRows = append(keptRows, r)
+		}
+	}
+	for c := 0; c < this.maxCol; c++ {
+		if opts.KeepHiddenColumns || !this.isColHidden(c) {
+			keptCols = append(keptCols, c)
+		}
+	}
+	if len(keptRows) == len(this.cells) && len(keptCols) == this.maxCol {
+		return this
+	}
+
+	res := &sheetGrid{
+		cells:      make([][]string, len(keptRows)),
+		merges:     make([][]app.MergeKind, len(keptRows)),
+		values:     make([][]app.CellValue, len(keptRows)),
+		groups:     make(map[gridPos]string),
+		maxCol:     len(keptCols),
+		hiddenRows: make([]bool, len(keptRows)),
+		hiddenCols: make([]bool, len(keptCols)),
+		srcRows:    make([]int, len(keptRows)),
+		srcCols:    make([]int, len(keptCols)),
+		formulas:   this.formulas,
+	}
+
+	colIndex := make(map[int]int, len(keptCols))
+	for i, c := range keptCols {
+		colIndex[c] = i
+		res.hiddenCols[i] = this.isColHidden(c)
+		res.srcCols[i] = this.sourceCol(c)
+	}
+	rowIndex := make(map[int]int, len(keptRows))
+	for i, r := range keptRows {
+		rowIndex[r] = i
+		res.hiddenRows[i] = this.isRowHidden(r)
+		res.srcRows[i] = this.sourceRow(r)
+		res.cells[i] = make([]string, len(keptCols))
+		res.merges[i] = make([]app.MergeKind, len(keptCols))
+		res.values[i] = make([]app.CellValue, len(keptCols))
+		for j, c := range keptCols {
+			res.cells[i][j] = this.cells[r][c]
+			res.merges[i][j] = this.merges[r][c]
+			res.values[i][j] = this.values[r][c]
+		}
+	}
+
+	for pos, val := range this.groups {
+		r, okRow := rowIndex[pos.row]
+		c, okCol := colIndex[pos.col]
+		if okRow && okCol {
+			res.groups[gridPos{r, c}] = val
+		}
+	}
+
+	return res
+}
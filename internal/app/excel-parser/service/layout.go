@@ -0,0 +1,227 @@
+package excel_parser_service
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/init-pkg/nova-template/domain/app"
+)
+
+// defaultLayoutSimilarity is the min similarity of a known layout to reuse its decisions
+const defaultLayoutSimilarity = 0.85
+
+// layoutSampleRows are the data rows profiled for the column types of a layout
+const layoutSampleRows = 20
+
+// Weights of the layout similarity parts, they sum up to 1
+const (
+	layoutHeaderWeight = 0.6
+	layoutTypeWeight   = 0.15
+	layoutColumnWeight = 0.15
+	layoutGroupWeight  = 0.1
+)
+
+// layoutMinHeaderMatch is the min token overlap of two headers to be the same column: "Цена, руб" and "Цена"
+const layoutMinHeaderMatch = 0.5
+
+var layoutDigits = regexp.MustCompile(`\d+`)
+
+func layoutSimilarityFromConfig(value float64) float64 {
+	if value <= 0 || value > 1 {
+		return defaultLayoutSimilarity
+	}
+
+	return value
+}
+
+// tableLayout builds the fingerprint of a parsed table from its header and the types of its first data rows
+func tableLayout(result *app.ParseExcelResult) *app.LayoutFingerprint {
+	sample := *result
+	sample.Rows = result.Rows[:min(layoutSampleRows, len(result.Rows))]
+	sample.Values = result.Values[:min(layoutSampleRows, len(result.Values))]
+	profiles := profileColumns(&sample)
+
+	layout := &app.LayoutFingerprint{
+		Headers: make([][]string, len(result.Header)),
+		Types:   make([]app.ColumnType, len(result.Header)),
+	}
+	for c, header := range result.Header {
+		layout.Headers[c] = layoutTokens(header)
+		layout.Types[c] = profiles[c].Type
+		if len(layout.Headers[c]) > 0 {
+			layout.Columns++
+		}
+	}
+
+	// Header groups are columns sharing the top level of a multi-level header path
+	for c := 0; c < len(result.HeaderPath); c++ {
+		if len(result.HeaderPath[c]) < 2 {
+			continue
+		}
+		title := result.HeaderPath[c][0]
+		end := c
+		for end+1 < len(result.HeaderPath) && len(result.HeaderPath[end+1]) >= 2 && result.HeaderPath[end+1][0] == title {
+			end++
+		}
+		layout.Groups = append(layout.Groups, app.LayoutGroup{Title: strings.Join(layoutTokens(title), " "), Start: c, End: end})
+		c = end
+	}
+
+	return layout
+}
+
+// layoutAt builds the layout of the table at startRow with the given header, from its head and first data rows only.
+// headerRow and dataStart are grid rows, -1 if unknown
+func layoutAt(sg *sheetGrid, sheet string, startRow, headerRows, headerRow, dataStart int) *app.LayoutFingerprint {
+	headEnd := startRow + headerRows
+	if headerRow >= 0 && dataStart >= 0 {
+		headEnd = dataStart
+	}
+	head := sg.subGrid(tableRegion{endRow: min(headEnd+layoutSampleRows, len(sg.cells)) - 1, endCol: sg.maxCol - 1})
+
+	return tableLayout(buildResultWithIndices(head, startRow, headerRows, headerRow, dataStart, head.maxCol, sheet))
+}
+
+// layoutTokens normalizes a header into lowercase words with digits masked: "Цена, руб (2026)" -> [цена руб #]
+func layoutTokens(text string) []string {
+	text = layoutDigits.ReplaceAllString(strings.ToLower(text), "#")
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '#'
+	})
+}
+
+// layoutKey is an exact key of a layout
+func layoutKey(layout *app.LayoutFingerprint) string {
+	data, _ := json.Marshal(layout)
+	hash := md5.Sum(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// layoutSimilarity scores two layouts from 0 to 1. Columns are matched by header tokens regardless of position,
+// then the matched columns are compared by data type. The column count and header groups add the rest
+func layoutSimilarity(a, b *app.LayoutFingerprint) float64 {
+	if a == nil || b == nil || a.Columns == 0 || b.Columns == 0 {
+		return 0
+	}
+
+	pairs, overlap := matchLayoutColumns(a, b)
+	headers := 2 * overlap / float64(a.Columns+b.Columns)
+
+	types, typed := 0.0, 0
+	for _, p := range pairs {
+		ta, tb := layoutType(a, p[0]), layoutType(b, p[1])
+		if ta == app.ColumnTypeEmpty || tb == app.ColumnTypeEmpty {
+			continue
+		}
+		typed++
+		if ta == tb {
+			types++
+		}
+	}
+	if typed > 0 {
+		types /= float64(typed)
+	} else {
+		types = headers
+	}
+
+	columns := float64(min(a.Columns, b.Columns)) / float64(max(a.Columns, b.Columns))
+
+	return layoutHeaderWeight*headers + layoutTypeWeight*types + layoutColumnWeight*columns + layoutGroupWeight*groupSimilarity(a.Groups, b.Groups)
+}
+
+// matchLayoutColumns pairs the columns of two layouts by header token overlap, best pairs first.
+// Returns the pairs and the sum of their overlaps
+func matchLayoutColumns(a, b *app.LayoutFingerprint) ([][2]int, float64) {
+	type candidate struct {
+		i, j    int
+		overlap float64
+	}
+
+	var candidates []candidate
+	for i, ha := range a.Headers {
+		for j, hb := range b.Headers {
+			if overlap := tokenOverlap(ha, hb); overlap >= layoutMinHeaderMatch {
+				candidates = append(candidates, candidate{i, j, overlap})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(x, y int) bool {
+		return candidates[x].overlap > candidates[y].overlap
+	})
+
+	var pairs [][2]int
+	var sum float64
+	usedA, usedB := make(map[int]bool), make(map[int]bool)
+	for _, c := range candidates {
+		if usedA[c.i] || usedB[c.j] {
+			continue
+		}
+		usedA[c.i], usedB[c.j] = true, true
+		pairs = append(pairs, [2]int{c.i, c.j})
+		sum += c.overlap
+	}
+
+	return pairs, sum
+}
+
+// tokenOverlap is the Jaccard index of two token sets, 0 for empty headers
+func tokenOverlap(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	set := make(map[string]bool, len(a))
+	for _, token := range a {
+		set[token] = true
+	}
+	common, union := 0, len(set)
+	seen := make(map[string]bool, len(b))
+	for _, token := range b {
+		if seen[token] {
+			continue
+		}
+		seen[token] = true
+		if set[token] {
+			common++
+		} else {
+			union++
+		}
+	}
+
+	return float64(common) / float64(union)
+}
+
+// groupSimilarity matches header groups by title and width, allowing a shift by one column
+func groupSimilarity(a, b []app.LayoutGroup) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+
+	matched := 0
+	used := make(map[int]bool, len(b))
+	for _, ga := range a {
+		for j, gb := range b {
+			if used[j] || ga.Title != gb.Title || ga.End-ga.Start != gb.End-gb.Start || max(ga.Start-gb.Start, gb.Start-ga.Start) > 1 {
+				continue
+			}
+			used[j] = true
+			matched++
+			break
+		}
+	}
+
+	return 2 * float64(matched) / float64(len(a)+len(b))
+}
+
+func layoutType(layout *app.LayoutFingerprint, col int) app.ColumnType {
+	if col >= len(layout.Types) {
+		return app.ColumnTypeEmpty
+	}
+
+	return layout.Types[col]
+}
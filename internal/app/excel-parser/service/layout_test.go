@@ -0,0 +1,126 @@
+package excel_parser_service
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/init-pkg/nova-template/domain/app"
+)
+
+// testLayout builds a layout of headers with the given column types
+func testLayout(headers []string, types []app.ColumnType, groups ...app.LayoutGroup) *app.LayoutFingerprint {
+	layout := &app.LayoutFingerprint{Types: types, Groups: groups}
+	for _, header := range headers {
+		tokens := layoutTokens(header)
+		layout.Headers = append(layout.Headers, tokens)
+		if len(tokens) > 0 {
+			layout.Columns++
+		}
+	}
+
+	return layout
+}
+
+func TestLayoutTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{text: "Цена, руб (2026)", want: []string{"цена", "руб", "#"}},
+		{text: "Артикул", want: []string{"артикул"}},
+		{text: "Остаток на 12.10", want: []string{"остаток", "на", "#", "#"}},
+		{text: "  ", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := layoutTokens(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("tokens = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayoutSimilarity(t *testing.T) {
+	var (
+		str = app.ColumnTypeText
+		num = app.ColumnTypeNumeric
+	)
+	base := testLayout([]string{"Код", "Наименование", "Цена, руб", "Остаток"}, []app.ColumnType{str, str, num, num})
+
+	tests := []struct {
+		name     string
+		other    *app.LayoutFingerprint
+		min, max float64
+	}{
+		{name: "same layout", other: base, min: 1, max: 1},
+		{
+			name:  "reordered columns",
+			other: testLayout([]string{"Наименование", "Код", "Остаток", "Цена, руб"}, []app.ColumnType{str, str, num, num}),
+			min:   1,
+			max:   1,
+		},
+		{
+			name:  "added column",
+			other: testLayout([]string{"Код", "Наименование", "Цена, руб", "Остаток", "Бренд"}, []app.ColumnType{str, str, num, num, str}),
+			min:   defaultLayoutSimilarity,
+			max:   0.95,
+		},
+		{
+			name:  "renamed header",
+			other: testLayout([]string{"Код", "Наименование", "Цена", "Остаток"}, []app.ColumnType{str, str, num, num}),
+			min:   defaultLayoutSimilarity,
+			max:   0.95,
+		},
+		{
+			name:  "changed column type",
+			other: testLayout([]string{"Код", "Наименование", "Цена, руб", "Остаток"}, []app.ColumnType{str, str, str, str}),
+			min:   defaultLayoutSimilarity,
+			max:   0.95,
+		},
+		{
+			name:  "unrelated table",
+			other: testLayout([]string{"Имя", "Телефон", "Почта", "Город"}, []app.ColumnType{str, str, str, str}),
+			min:   0,
+			max:   0.5,
+		},
+		{name: "no layout", other: nil, min: 0, max: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := layoutSimilarity(base, tt.other)
+			if got < tt.min-1e-9 || got > tt.max+1e-9 {
+				t.Errorf("similarity = %.3f, want %.3f to %.3f", got, tt.min, tt.max)
+			}
+			if back := layoutSimilarity(tt.other, base); back-got > 1e-9 || got-back > 1e-9 {
+				t.Errorf("similarity is not symmetric: %.3f and %.3f", got, back)
+			}
+		})
+	}
+}
+
+func TestGroupSimilarity(t *testing.T) {
+	price := app.LayoutGroup{Title: "цена", Start: 2, End: 3}
+
+	tests := []struct {
+		name string
+		a, b []app.LayoutGroup
+		want float64
+	}{
+		{name: "no groups", want: 1},
+		{name: "same group", a: []app.LayoutGroup{price}, b: []app.LayoutGroup{price}, want: 1},
+		{name: "shifted by one column", a: []app.LayoutGroup{price}, b: []app.LayoutGroup{{Title: "цена", Start: 3, End: 4}}, want: 1},
+		{name: "shifted by two columns", a: []app.LayoutGroup{price}, b: []app.LayoutGroup{{Title: "цена", Start: 4, End: 5}}, want: 0},
+		{name: "wider group", a: []app.LayoutGroup{price}, b: []app.LayoutGroup{{Title: "цена", Start: 2, End: 4}}, want: 0},
+		{name: "one of two groups", a: []app.LayoutGroup{price}, b: []app.LayoutGroup{price, {Title: "остаток", Start: 4, End: 5}}, want: 2.0 / 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := groupSimilarity(tt.a, tt.b); got != tt.want {
+				t.Errorf("similarity = %.3f, want %.3f", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package excel_parser_service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/init-pkg/nova-template/domain/app"
+)
+
+const odsMimeType = "application/vnd.oasis.opendocument.spreadsheet"
+
+// isOdsFile checks the OpenDocument mimetype entry of a zip container
+func isOdsFile(file []byte) bool {
+	zr, err := zip.NewReader(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		return false
+	}
+
+	for _, entry := range zr.File {
+		if entry.Name != "mimetype" {
+			continue
+		}
+		data, err := readZipEntry(entry)
+		return err == nil && strings.TrimSpace(string(data)) == odsMimeType
+	}
+
+	return false
+}
+
+func readZipEntry(entry *zip.File) ([]byte, error) {
+	rc, err := entry.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc)
+}
+
+// odsSheetBuilder collects cells and spans of one table:table element
+type odsSheetBuilder struct {
+	name   string
+	rows   [][]string
+	values [][]app.CellValue
+	merges []mergeRange
+	row    int
+	col    int
+
+	isHidden      bool
+	hiddenRows    [][2]int // [start, end) ranges, kept as ranges because repeats may cover the whole sheet
+	hiddenCols    [][2]int
+	columnDefined int // number of table:table-column entries read
+
+	repeated []odsRepeatedCell // non-empty cells repeated over rows or columns, expanded when the table ends
+}
+
+// odsRepeatedCell is a non-empty cell with number-columns-repeated or in a row with number-rows-repeated
+type odsRepeatedCell struct {
+	row, col   int
+	rows, cols int
+	value      string
+	typed      app.CellValue
+}
+
+// hiddenFlags expands hidden ranges up to the given size
+func hiddenFlags(ranges [][2]int, size int) []bool {
+	flags := make([]bool, size)
+	for _, r := range ranges {
+		for i := r[0]; i < r[1] && i < size; i++ {
+			flags[i] = true
+		}
+	}
+
+	return flags
+}
+
+// odsIsHidden checks table:visibility of a row or column, filtered out rows count as hidden
+func odsIsHidden(el xml.StartElement) bool {
+	visibility := odsAttr(el, "visibility")
+	return visibility == "collapse" || visibility == "filter"
+}
+
+func (this *odsSheetBuilder) setCell(row, col int, value string, typed app.CellValue) {
+	for len(this.rows) <= row {
+		this.rows = append(this.rows, nil)
+		this.values = append(this.values, nil)
+	}
+	for len(this.rows[row]) <= col {
+		this.rows[row] = append(this.rows[row], "")
+		this.values[row] = append(this.values[row], app.CellValue{})
+	}
+	this.rows[row][col] = value
+	this.values[row][col] = typed
+}
+
+// expandRepeated writes the repeated cells within the range used by single cells and spans: a value
+// filled down to the end of the sheet repeats a million times but adds nothing. A repeated cell
+// keeps at least its first copy
+func (this *odsSheetBuilder) expandRepeated() {
+	usedRows, usedCols := len(this.rows), 0
+	for _, row := range this.rows {
+		usedCols = max(usedCols, len(row))
+	}
+	for _, m := range this.merges {
+		usedRows, usedCols = max(usedRows, m.endRow+1), max(usedCols, m.endCol+1)
+	}
+
+	for _, cell := range this.repeated {
+		rows := max(1, min(cell.rows, usedRows-cell.row))
+		cols := max(1, min(cell.cols, usedCols-cell.col))
+		for r := range rows {
+			for c := range cols {
+				this.setCell(cell.row+r, cell.col+c, cell.value, cell.typed)
+			}
+		}
+	}
+	this.repeated = nil
+}
+
+// odsCell is the state of the table cell being read
+type odsCell struct {
+	repeat      int
+	colSpan     int
+	rowSpan     int
+	isCovered   bool
+	valueType   string // office:value-type
+	currency    string // office:currency
+	value       string // office:value / office:date-value / office:boolean-value
+	paragraphs  []string
+	text        strings.Builder
+	isParagraph bool
+}
+
+func (this *odsCell) displayValue() string {
+	if len(this.paragraphs) > 0 {
+		return strings.Join(this.paragraphs, "\n")
+	}
+
+	return this.value
+}
+
+// typedValue types the cell by office:value-type
+func (this *odsCell) typedValue(display string) app.CellValue {
+	switch this.valueType {
+	case "float", "percentage":
+		if v, err := strconv.ParseFloat(this.value, 64); err == nil {
+			return numericCellValue(v, numberFormat{}, display, false)
+		}
+	case "currency":
+		if v, err := strconv.ParseFloat(this.value, 64); err == nil {
+			cur := this.currency
+			if cur == "" {
+				cur = DetectCurrency(display)
+			}
+			return app.CellValue{Type: app.CellTypeCurrency, Number: v, Currency: cur}
+		}
+	case "date":
+		for _, layout := range []string{"2006-01-02T15:04:05.999999999", "2006-01-02"} {
+			if t, err := time.Parse(layout, this.value); err == nil {
+				return timeCellValue(t)
+			}
+		}
+	case "time":
+		// ISO 8601 duration: PT12H30M00S
+		if d, err := time.ParseDuration(strings.ToLower(strings.TrimPrefix(this.value, "PT"))); err == nil {
+			return timeCellValue(excelSerialToTime(0, false).Add(d))
+		}
+	case "boolean":
+		return boolCellValue(this.value == "true")
+	}
+
+	return stringCellValue(strings.TrimSpace(display))
+}
+
+func odsAttr(el xml.StartElement, local string) string {
+	for _, attr := range el.Attr {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+
+	return ""
+}
+
+func odsAttrInt(el xml.StartElement, local string, def int) int {
+	if v, err := strconv.Atoi(odsAttr(el, local)); err == nil && v > 0 {
+		return v
+	}
+
+	return def
+}
+
+// readOdsWorkbook reads all tables of an OpenDocument spreadsheet into grids
+func readOdsWorkbook(file []byte, policy MergePolicy) ([]*workbookSheet, error) {
+	zr, err := zip.NewReader(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		return nil, fmt.Errorf("ods: open zip: %w", err)
+	}
+
+	var content *zip.File
+	for _, entry := range zr.File {
+		if entry.Name == "content.xml" {
+			content = entry
+			break
+		}
+	}
+	if content == nil {
+		return nil, errors.New("ods: content.xml not found")
+	}
+
+	rc, err := content.Open()
+	if err != nil {
+		return nil, fmt.Errorf("ods: open content.xml: %w", err)
+	}
+	defer rc.Close()
+
+	var sheets []*workbookSheet
+	var sheet *odsSheetBuilder
+	var cell *odsCell
+	var rowRepeat int
+	annotationDepth := 0
+
+	// Automatic table styles with table:display="false" hide the sheet
+	hiddenTableStyles := make(map[string]bool)
+	var tableStyle string
+
+	decoder := xml.NewDecoder(rc)
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ods: read content.xml: %w", err)
+		}
+
+		switch el := tok.(type) {
+		case xml.StartElement:
+			if annotationDepth > 0 || el.Name.Local == "annotation" {
+				annotationDepth++
+				continue
+			}
+
+			switch el.Name.Local {
+			case "style":
+				tableStyle = ""
+				if odsAttr(el, "family") == "table" {
+					tableStyle = odsAttr(el, "name")
+				}
+			case "table-properties":
+				if tableStyle != "" && odsAttr(el, "display") == "false" {
+					hiddenTableStyles[tableStyle] = true
+				}
+			case "table":
+				if sheet == nil {
+					sheet = &odsSheetBuilder{name: odsAttr(el, "name"), isHidden: hiddenTableStyles[odsAttr(el, "style-name")]}
+				}
+			case "table-column":
+				if sheet != nil {
+					repeat := odsAttrInt(el, "number-columns-repeated", 1)
+					if odsIsHidden(el) {
+						sheet.hiddenCols = append(sheet.hiddenCols, [2]int{sheet.columnDefined, sheet.columnDefined + repeat})
+					}
+					sheet.columnDefined += repeat
+				}
+			case "table-row":
+				if sheet != nil {
+					sheet.col = 0
+					rowRepeat = odsAttrInt(el, "number-rows-repeated", 1)
+					if odsIsHidden(el) {
+						sheet.hiddenRows = append(sheet.hiddenRows, [2]int{sheet.row, sheet.row + rowRepeat})
+					}
+				}
+			case "table-cell", "covered-table-cell":
+				if sheet == nil {
+					continue
+				}
+				cell = &odsCell{
+					repeat:    odsAttrInt(el, "number-columns-repeated", 1),
+					colSpan:   odsAttrInt(el, "number-columns-spanned", 1),
+					rowSpan:   odsAttrInt(el, "number-rows-spanned", 1),
+					isCovered: el.Name.Local == "covered-table-cell",
+					valueType: odsAttr(el, "value-type"),
+					currency:  odsAttr(el, "currency"),
+				}
+				for _, attr := range []string{"value", "date-value", "time-value", "boolean-value", "string-value"} {
+					if v := odsAttr(el, attr); v != "" {
+						cell.value = v
+						break
+					}
+				}
+			case "p", "h":
+				if cell != nil {
+					cell.isParagraph = true
+					cell.text.Reset()
+				}
+			case "s":
+				if cell != nil && cell.isParagraph {
+					cell.text.WriteString(strings.Repeat(" ", odsAttrInt(el, "c", 1)))
+				}
+			case "tab":
+				if cell != nil && cell.isParagraph {
+					cell.text.WriteString("\t")
+				}
+			case "line-break":
+				if cell != nil && cell.isParagraph {
+					cell.text.WriteString("\n")
+				}
+			}
+
+		case xml.CharData:
+			if annotationDepth == 0 && cell != nil && cell.isParagraph {
+				cell.text.Write(el)
+			}
+
+		case xml.EndElement:
+			if annotationDepth > 0 {
+				annotationDepth--
+				continue
+			}
+
+			switch el.Name.Local {
+			case "p", "h":
+				if cell != nil && cell.isParagraph {
+					cell.paragraphs = append(cell.paragraphs, cell.text.String())
+					cell.isParagraph = false
+				}
+			case "table-cell", "covered-table-cell":
+				if sheet == nil || cell == nil {
+					continue
+				}
+				value := cell.displayValue()
+				if !cell.isCovered && strings.TrimSpace(value) != "" {
+					typed := cell.typedValue(value)
+					if cell.repeat == 1 && rowRepeat == 1 {
+						sheet.setCell(sheet.row, sheet.col, value, typed)
+					} else {
+						sheet.repeated = append(sheet.repeated, odsRepeatedCell{
+							row: sheet.row, col: sheet.col, rows: rowRepeat, cols: cell.repeat, value: value, typed: typed,
+						})
+					}
+				}
+				if !cell.isCovered && (cell.colSpan > 1 || cell.rowSpan > 1) {
+					sheet.merges = append(sheet.merges, mergeRange{
+						startRow: sheet.row,
+						startCol: sheet.col,
+						endRow:   sheet.row + cell.rowSpan - 1,
+						endCol:   sheet.col + cell.colSpan - 1,
+						value:    value,
+					})
+				}
+				sheet.col += cell.repeat
+				cell = nil
+			case "table-row":
+				if sheet != nil {
+					sheet.row += rowRepeat
+					rowRepeat = 1
+				}
+			case "table":
+				if sheet != nil {
+					sheet.expandRepeated()
+					sg := newSheetGrid(sheet.rows, sheet.values, sheet.merges, policy)
+					sg.setHidden(hiddenFlags(sheet.hiddenRows, len(sg.cells)), hiddenFlags(sheet.hiddenCols, sg.maxCol))
+					sheets = append(sheets, &workbookSheet{name: sheet.name, grid: sg, isHidden: sheet.isHidden})
+					sheet = nil
+				}
+			}
+		}
+	}
+
+	return sheets, nil
+}
@@ -0,0 +1,100 @@
+package excel_parser_service
+
+import (
+	"archive/zip"
+	"bytes"
+	"slices"
+	"testing"
+)
+
+// odsFile packs the body of an office:spreadsheet element into a minimal ODS file
+func odsFile(t *testing.T, spreadsheet string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("content.xml")
+	if err != nil {
+		t.Fatalf("create content.xml: %v", err)
+	}
+	content := `<?xml version="1.0" encoding="UTF-8"?>` +
+		`<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0"` +
+		` xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0">` +
+		`<office:body><office:spreadsheet>` + spreadsheet + `</office:spreadsheet></office:body></office:document-content>`
+	if _, err := w.Write([]byte(content)); err != nil {
+		t.Fatalf("write content.xml: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("close ods: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func odsText(text string, attrs string) string {
+	return `<table:table-cell office:value-type="string" ` + attrs + `><text:p>` + text + `</text:p></table:table-cell>`
+}
+
+func TestReadOdsWorkbook(t *testing.T) {
+	tests := []struct {
+		name   string
+		table  string
+		want   [][]string
+		hidden []bool
+	}{
+		{
+			name: "spans and covered cells",
+			table: `<table:table-row>` + odsText("Товар", `table:number-columns-spanned="2"`) + `<table:covered-table-cell/>` + odsText("Цена", "") + `</table:table-row>` +
+				`<table:table-row>` + odsText("Код", "") + odsText("Наименование", "") + odsText("руб.", "") + `</table:table-row>`,
+			want: [][]string{{"Товар", "", "Цена"}, {"Код", "Наименование", "руб."}},
+		},
+		{
+			name: "repeated rows within the used range",
+			table: `<table:table-row>` + odsText("Код", "") + odsText("Цена", "") + `</table:table-row>` +
+				`<table:table-row table:number-rows-repeated="2">` + odsText("A1", "") + odsText("10", "") + `</table:table-row>` +
+				`<table:table-row>` + odsText("A2", "") + odsText("20", "") + `</table:table-row>`,
+			want: [][]string{{"Код", "Цена"}, {"A1", "10"}, {"A1", "10"}, {"A2", "20"}},
+		},
+		{
+			name: "value repeated to the end of the sheet",
+			table: `<table:table-row>` + odsText("Код", "") + odsText("Ед.", "") + odsText("Цена", "") + `</table:table-row>` +
+				`<table:table-row>` + odsText("A1", "") + odsText("шт", `table:number-columns-repeated="16383"`) + `</table:table-row>` +
+				`<table:table-row table:number-rows-repeated="1048574">` + odsText("-", "") + `<table:table-cell table:number-columns-repeated="16383"/></table:table-row>`,
+			want: [][]string{{"Код", "Ед.", "Цена"}, {"A1", "шт", "шт"}, {"-", "", ""}},
+		},
+		{
+			name: "hidden rows",
+			table: `<table:table-row>` + odsText("Код", "") + odsText("Цена", "") + `</table:table-row>` +
+				`<table:table-row table:visibility="collapse">` + odsText("A1", "") + odsText("10", "") + `</table:table-row>` +
+				`<table:table-row table:visibility="filter">` + odsText("A2", "") + odsText("20", "") + `</table:table-row>`,
+			want:   [][]string{{"Код", "Цена"}, {"A1", "10"}, {"A2", "20"}},
+			hidden: []bool{false, true, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := odsFile(t, `<table:table table:name="Прайс">`+tt.table+`</table:table>`)
+			sheets, err := readOdsWorkbook(file, DefaultMergePolicy())
+			if err != nil {
+				t.Fatalf("read ods: %v", err)
+			}
+			if len(sheets) != 1 || sheets[0].name != "Прайс" {
+				t.Fatalf("got %d sheets, want Прайс", len(sheets))
+			}
+
+			sg := sheets[0].grid
+			if len(sg.cells) != len(tt.want) {
+				t.Fatalf("got %d rows, want %d: %q", len(sg.cells), len(tt.want), sg.cells)
+			}
+			for i, want := range tt.want {
+				if got := sg.cells[i]; !slices.Equal(got, want) {
+					t.Errorf("row %d = %q, want %q", i, got, want)
+				}
+			}
+			if tt.hidden != nil && !slices.Equal(sg.hiddenRows, tt.hidden) {
+				t.Errorf("hidden rows = %v, want %v", sg.hiddenRows, tt.hidden)
+			}
+		})
+	}
+}
@@ -1,25 +1,26 @@
 package excel_parser_service
 
 import (
-	"bytes"
 	"context"
 	"crypto/md5"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/init-pkg/nova-template/domain/app"
+	"github.com/init-pkg/nova-template/internal/config"
 	app_redis "github.com/init-pkg/nova-template/internal/infra/redis/client"
 	"github.com/init-pkg/nova/errs"
 	nova_ctx "github.com/init-pkg/nova/shared/ctx"
 
 	"github.com/invopop/jsonschema"
-	openai "github.com/openai/openai-go/v2"
-	"github.com/redis/go-redis/v9"
 	"github.com/xuri/excelize/v2"
 )
 
@@ -35,15 +36,20 @@ type GPTTableValidationResponse struct {
 	Reasoning      string `json:"reasoning" jsonschema_description:"Brief explanation of why this is or isn't a product table"`
 }
 
-// CacheEntry represents a single cache entry with collision resistance
-type CacheEntry struct {
-	HeaderStart    int    `json:"header_start"` // Start row index of headers
-	HeaderEnd      int    `json:"header_end"`   // End row index of headers
-	HeaderHash     string `json:"header_hash"`  // Exact hash of header strings
-	IsProductTable bool   `json:"is_product_table"`
-	Confidence     int    `json:"confidence"`
-	Reasoning      string `json:"reasoning"`
-	Timestamp      int64  `json:"timestamp"`
+// layoutValidation is a cached table validation answer with the layout of the table it was given for
+type layoutValidation struct {
+	Layout         *app.LayoutFingerprint `json:"layout"`
+	IsProductTable bool                   `json:"is_product_table"`
+	Confidence     int                    `json:"confidence"`
+	Reasoning      string                 `json:"reasoning"`
+	Timestamp      int64                  `json:"timestamp"`
+}
+
+// layoutIndexEntry is a known layout with the key of its table validation answer
+type layoutIndexEntry struct {
+	Key       string                 `json:"key"`
+	Layout    *app.LayoutFingerprint `json:"layout"`
+	Timestamp int64                  `json:"timestamp"`
 }
 
 func GenerateSchema[T any]() interface{} {
@@ -64,438 +70,260 @@ var GPTTableValidationResponseSchema = GenerateSchema[GPTTableValidationResponse
 
 // Cache constants
 const (
-	cacheTTL                = 30 * 24 * time.Hour // 30 days
-	tableValidationCacheKey = "excel_parser:table_validation:"
-	headerAnalysisCacheKey  = "excel_parser:header_analysis:"
-	advancedCacheKey        = "excel_parser:advanced_cache:"
+	cacheTTL = 30 * 24 * time.Hour // 30 days
+	// layouts indexed per column count
+	layoutCacheMaxEntries = 50
+	layoutCacheMaxAge     = 45 * 24 * time.Hour
 )
 
-type ExcelParserService struct {
-	openaiClient *openai.Client
-	log          *slog.Logger
-	cache        HeaderCache
-	redisClient  *app_redis.Client
-}
+// Default stage deadlines
+const (
+	defaultParseTimeout           = 5 * time.Minute
+	defaultHeaderAnalysisTimeout  = 60 * time.Second
+	defaultTableValidationTimeout = 60 * time.Second
+)
 
-var _ app.ExcelParserService = &ExcelParserService{}
+const defaultParseWorkers = 4
 
-func New(openaiClient *openai.Client, log *slog.Logger, redisClient *app_redis.Client) *ExcelParserService {
-	return &ExcelParserService{openaiClient, log, &memHeaderCache{}, redisClient}
-}
+// headerPathMaxLen is the max length in characters of a sub-header value kept in a header path
+const headerPathMaxLen = 30
 
-// generateCacheKey creates a cache key based on header data
-func (this *ExcelParserService) generateCacheKey(prefix string, headers []string) string {
-	// Create a hash from headers to ensure consistent cache keys
-	headerText := strings.Join(headers, "|")
-	hash := md5.Sum([]byte(headerText))
-	return prefix + hex.EncodeToString(hash[:])
+func workersFromConfig(value int) int {
+	if value > 0 {
+		return value
+	}
+
+	return defaultParseWorkers
 }
 
-// generateTableValidationCacheKey creates a cache key for table validation including limited sample data context
-func (this *ExcelParserService) generateTableValidationCacheKey(headers []string, sampleRows [][]string) string {
-	// Include headers in the key
-	var keyParts []string
-	keyParts = append(keyParts, strings.Join(headers, "|"))
+// stageTimeouts are deadlines of parse stages, the request context may end them earlier
+type stageTimeouts struct {
+	parse           time.Duration
+	headerAnalysis  time.Duration
+	tableValidation time.Duration
+}
 
-	// Add limited sample data context (only first few cells of first few rows)
-	// This captures the "flavor" of data without making cache too specific
-	for i, row := range sampleRows {
-		if i >= 2 { // Limit to first 2 sample rows
-			break
-		}
-		// Only include first 3 cells to get data "type pattern"
-		limitedRow := make([]string, 0, 3)
-		for j, cell := range row {
-			if j >= 3 { // Only first 3 cells
-				break
-			}
-			// Normalize data to detect patterns rather than specific values
-			normalized := this.normalizeDataForCaching(cell)
-			limitedRow = append(limitedRow, normalized)
-		}
-		keyParts = append(keyParts, strings.Join(limitedRow, "|"))
+func stageTimeoutsFromConfig(cfg config.StageTimeoutsConfig) stageTimeouts {
+	return stageTimeouts{
+		parse:           config.Timeout(cfg.Parse, defaultParseTimeout),
+		headerAnalysis:  config.Timeout(cfg.HeaderAnalysis, defaultHeaderAnalysisTimeout),
+		tableValidation: config.Timeout(cfg.TableValidation, defaultTableValidationTimeout),
 	}
+}
 
-	keyText := strings.Join(keyParts, "||")
-	hash := md5.Sum([]byte(keyText))
-	cacheKey := tableValidationCacheKey + hex.EncodeToString(hash[:])
+// headerAnalysisInstructions is the fixed part of the header analysis prompt, the rows follow it
+const headerAnalysisInstructions = "Analyze this Excel data and identify which row contains the actual table column headers and where the data starts.\n\n" +
+	"IMPORTANT RULES:\n" +
+	"1. Column headers are typically short, descriptive field names (like product codes, names, prices, quantities)\n" +
+	"2. Avoid rows that contain category names, section titles, or descriptive text that spans multiple cells\n" +
+	"3. If you see a row with long descriptive text followed by a row with short field-like names, choose the row with short field names\n" +
+	"4. Data rows contain actual values, not field names\n" +
+	"5. Skip any promotional text, contact information, or metadata\n\n" +
+	"Example patterns:\n" +
+	"- GOOD header row: 'Code | Name | Price | Stock'\n" +
+	"- BAD header row: 'Electronics and Computer Accessories for Modern Office'\n" +
+	"- GOOD data row: 'A123 | Laptop Dell | 1500.00 | 5'\n\n" +
+	"Rows:\n"
+
+// tableValidationInstructions is the fixed part of the table validation prompt, the header and sample rows follow it
+const tableValidationInstructions = "Analyze this table structure and determine if it represents a product/goods catalog table. " +
+	"Look for typical e-commerce/catalog columns like артикул, код, цена, остаток, наименование, описание, бренд, etc. " +
+	"Ignore contact information, navigation menus, or administrative tables.\n\n"
 
-	this.log.Debug("Generated table validation cache key",
-		"headers", headers,
-		"sampleRowsCount", len(sampleRows),
-		"keyText", keyText,
-		"cacheKey", cacheKey[:20]+"...")
-
-	return cacheKey
+type ExcelParserService struct {
+	llm        app.StructuredCompleter
+	log        *slog.Logger
+	cache      HeaderCache
+	cacheLocks *keyLocks // serializes read-modify-write updates of cache records
+	// supplier templates, kept apart from the evictable parse cache
+	templateStore HeaderCache
+	cacheVersion  string
+	mergePolicy   MergePolicy
+	detection     DetectionMode
+	timeouts      stageTimeouts
+	workers       int // sheets analyzed concurrently
+	// min similarity of a known layout to reuse its table validation and template decisions
+	layoutSimilarity float64
 }
 
-// generateAdvancedCacheKey creates a primary cache key from first row hash
-func (this *ExcelParserService) generateAdvancedCacheKey(headers []string) string {
-	// Use only first meaningful header for primary key to group similar tables
-	primaryHeader := ""
-	for _, header := range headers {
-		if strings.TrimSpace(header) != "" {
-			primaryHeader = strings.TrimSpace(header)
-			break
-		}
-	}
-
-	// Fallback to all headers if no meaningful first header
-	if primaryHeader == "" {
-		primaryHeader = strings.Join(headers, "|")
+var _ app.ExcelParserService = &ExcelParserService{}
+var _ app.ExcelParserCacheAdmin = &ExcelParserService{}
+var _ app.ExcelParserTemplates = &ExcelParserService{}
+
+func New(llm app.StructuredCompleter, log *slog.Logger, redisClient *app_redis.Client, cfg *config.Config) *ExcelParserService {
+	return &ExcelParserService{
+		llm:           llm,
+		log:           log,
+		cache:         headerCacheFromConfig(cfg.Internal.ExcelParser.Cache, redisClient),
+		cacheLocks:    newKeyLocks(),
+		templateStore: templateStoreOf(redisClient),
+		cacheVersion:  parserCacheVersion(llm),
+		mergePolicy:   mergePolicyFromConfig(cfg.Internal.ExcelParser.MergePolicy),
+		detection:     detectionModeFromConfig(cfg.Internal.ExcelParser.Detection),
+		timeouts:      stageTimeoutsFromConfig(cfg.Internal.Timeouts),
+		workers:       workersFromConfig(cfg.Internal.ExcelParser.Workers),
+
+		layoutSimilarity: layoutSimilarityFromConfig(cfg.Internal.ExcelParser.LayoutSimilarity),
 	}
+}
 
-	hash := md5.Sum([]byte(primaryHeader))
-	primaryKey := advancedCacheKey + hex.EncodeToString(hash[:])
-
-	this.log.Debug("Generated advanced cache primary key",
-		"primaryHeader", primaryHeader,
-		"primaryKey", primaryKey[:20]+"...")
+// generateCacheKey creates a cache key based on header data
+func (this *ExcelParserService) generateCacheKey(kind app.ParserCacheKind, headers []string) string {
+	// Create a hash from headers to ensure consistent cache keys
+	headerText := strings.Join(headers, "|")
+	hash := md5.Sum([]byte(headerText))
+	return this.cacheKey(kind, hex.EncodeToString(hash[:]))
+}
 
-	return primaryKey
+// tableValidationKey is the key of the table validation answer given for a layout
+func (this *ExcelParserService) tableValidationKey(layout string) string {
+	return this.cacheKey(app.ParserCacheKindTableValidation, layout)
 }
 
-// generateExactHeaderHash creates exact hash from all headers for collision detection
-func (this *ExcelParserService) generateExactHeaderHash(headers []string) string {
-	headerText := strings.Join(headers, "||")
-	hash := md5.Sum([]byte(headerText))
-	return hex.EncodeToString(hash[:])
+// layoutIndexKey is the key of the known layouts with the column count
+func (this *ExcelParserService) layoutIndexKey(columns int) string {
+	return this.cacheKey(app.ParserCacheKindLayoutIndex, fmt.Sprintf("columns-%d", columns))
 }
 
-// getAdvancedCachedTableValidation retrieves cached result with collision resistance
-func (this *ExcelParserService) getAdvancedCachedTableValidation(headers []string, headerStart, headerEnd int) (*GPTTableValidationResponse, bool) {
-	primaryKey := this.generateAdvancedCacheKey(headers)
-	exactHash := this.generateExactHeaderHash(headers)
-
-	this.log.Debug("Checking advanced table validation cache",
-		"primaryKey", primaryKey[:20]+"...",
-		"exactHash", exactHash[:16]+"...",
-		"headerStart", headerStart,
-		"headerEnd", headerEnd)
-
-	// Get array of cache entries
-	cachedData, err := this.redisClient.Get(context.Background(), primaryKey).Result()
-	if err == redis.Nil {
-		this.log.Debug("Advanced cache primary key miss", "primaryKey", primaryKey[:20]+"...")
-		return nil, false
-	}
-	if err != nil {
-		this.log.Error("Error retrieving from advanced cache", "error", err, "primaryKey", primaryKey[:20]+"...")
+// getCachedTableValidation finds the answer given for the most similar known layout.
+// Layouts with one column more or less are looked up too, so that a format with an added column is recognized
+func (this *ExcelParserService) getCachedTableValidation(ctx context.Context, layout *app.LayoutFingerprint, supplierID uint64) (*GPTTableValidationResponse, bool) {
+	if layout.Columns == 0 {
 		return nil, false
 	}
 
-	var cacheEntries []CacheEntry
-	if err := json.Unmarshal([]byte(cachedData), &cacheEntries); err != nil {
-		this.log.Error("Error unmarshaling advanced cache entries", "error", err, "primaryKey", primaryKey[:20]+"...")
-		return nil, false
+	type candidate struct {
+		key   string
+		score float64
 	}
-
-	// Find exact match by header hash and boundaries
-	for _, entry := range cacheEntries {
-		if entry.HeaderHash == exactHash &&
-			entry.HeaderStart == headerStart &&
-			entry.HeaderEnd == headerEnd {
-
-			this.log.Info("Advanced cache exact match found",
-				"primaryKey", primaryKey[:20]+"...",
-				"exactHash", exactHash[:16]+"...",
-				"headerStart", headerStart,
-				"headerEnd", headerEnd,
-				"isProductTable", entry.IsProductTable,
-				"confidence", entry.Confidence,
-				"entryAge", time.Since(time.Unix(entry.Timestamp, 0)).String())
-
-			return &GPTTableValidationResponse{
-				IsProductTable: entry.IsProductTable,
-				Confidence:     entry.Confidence,
-				Reasoning:      entry.Reasoning,
-			}, true
+	var candidates []candidate
+	for columns := max(layout.Columns-1, 1); columns <= layout.Columns+1; columns++ {
+		var index []layoutIndexEntry
+		if !this.getCached(ctx, this.layoutIndexKey(columns), 0, &index) {
+			continue
+		}
+		for _, entry := range index {
+			if score := layoutSimilarity(layout, entry.Layout); score >= this.layoutSimilarity {
+				candidates = append(candidates, candidate{entry.Key, score})
+			}
 		}
 	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
 
-	this.log.Debug("Advanced cache: no exact match found",
-		"primaryKey", primaryKey[:20]+"...",
-		"exactHash", exactHash[:16]+"...",
-		"entriesChecked", len(cacheEntries))
+	// An indexed answer may have expired or been purged, the next similar layout is tried then
+	for _, c := range candidates {
+		var cached layoutValidation
+		if !this.getCached(ctx, this.tableValidationKey(c.key), supplierID, &cached) {
+			continue
+		}
 
-	return nil, false
-}
+		this.log.Info("Table validation cache: similar layout found",
+			"columns", layout.Columns,
+			"similarity", c.score,
+			"isProductTable", cached.IsProductTable,
+			"confidence", cached.Confidence,
+			"entryAge", time.Since(time.Unix(cached.Timestamp, 0)).String())
 
-// setAdvancedCachedTableValidation stores result with collision resistance
-func (this *ExcelParserService) setAdvancedCachedTableValidation(headers []string, headerStart, headerEnd int, validation *GPTTableValidationResponse) {
-	primaryKey := this.generateAdvancedCacheKey(headers)
-	exactHash := this.generateExactHeaderHash(headers)
-
-	this.log.Debug("Setting advanced table validation cache",
-		"primaryKey", primaryKey[:20]+"...",
-		"exactHash", exactHash[:16]+"...",
-		"headerStart", headerStart,
-		"headerEnd", headerEnd,
-		"isProductTable", validation.IsProductTable)
-
-	// Get existing entries
-	var cacheEntries []CacheEntry
-	if cachedData, err := this.redisClient.Get(context.Background(), primaryKey).Result(); err == nil {
-		if unmarshalErr := json.Unmarshal([]byte(cachedData), &cacheEntries); unmarshalErr != nil {
-			this.log.Error("Error unmarshaling existing cache entries", "error", unmarshalErr)
-			cacheEntries = []CacheEntry{} // Reset on error
-		}
+		return &GPTTableValidationResponse{
+			IsProductTable: cached.IsProductTable,
+			Confidence:     cached.Confidence,
+			Reasoning:      cached.Reasoning,
+		}, true
 	}
 
-	// Create new entry
-	newEntry := CacheEntry{
-		HeaderStart:    headerStart,
-		HeaderEnd:      headerEnd,
-		HeaderHash:     exactHash,
+	this.log.Debug("Table validation cache: no similar layout", "columns", layout.Columns)
+	return nil, false
+}
+
+// setCachedTableValidation stores the answer for the layout under its own key and adds the layout
+// to the index of its column count
+func (this *ExcelParserService) setCachedTableValidation(ctx context.Context, layout *app.LayoutFingerprint, supplierID uint64, validation *GPTTableValidationResponse) {
+	key := layoutKey(layout)
+	entry := layoutValidation{
+		Layout:         layout,
 		IsProductTable: validation.IsProductTable,
 		Confidence:     validation.Confidence,
 		Reasoning:      validation.Reasoning,
 		Timestamp:      time.Now().Unix(),
 	}
-
-	// Check if entry already exists (update) or add new
-	found := false
-	for i, entry := range cacheEntries {
-		if entry.HeaderHash == exactHash &&
-			entry.HeaderStart == headerStart &&
-			entry.HeaderEnd == headerEnd {
-			cacheEntries[i] = newEntry // Update existing
-			found = true
-			break
-		}
-	}
-
-	if !found {
-		cacheEntries = append(cacheEntries, newEntry) // Add new
-	}
-
-	// Clean old entries (keep max 50 entries, remove entries older than 45 days)
-	maxEntries := 50
-	maxAge := 45 * 24 * time.Hour
-	cleanedEntries := make([]CacheEntry, 0, len(cacheEntries))
-	now := time.Now()
-
-	for _, entry := range cacheEntries {
-		if now.Sub(time.Unix(entry.Timestamp, 0)) <= maxAge {
-			cleanedEntries = append(cleanedEntries, entry)
-		}
-	}
-
-	// If still too many, keep most recent
-	if len(cleanedEntries) > maxEntries {
-		// Sort by timestamp desc and take first maxEntries
-		for i := 0; i < len(cleanedEntries)-1; i++ {
-			for j := i + 1; j < len(cleanedEntries); j++ {
-				if cleanedEntries[i].Timestamp < cleanedEntries[j].Timestamp {
-					cleanedEntries[i], cleanedEntries[j] = cleanedEntries[j], cleanedEntries[i]
-				}
-			}
-		}
-		cleanedEntries = cleanedEntries[:maxEntries]
-	}
-
-	// Save updated entries
-	data, err := json.Marshal(cleanedEntries)
-	if err != nil {
-		this.log.Error("Error marshaling advanced cache entries", "error", err, "primaryKey", primaryKey[:20]+"...")
+	if !this.setCached(ctx, this.tableValidationKey(key), app.ParserCacheKindTableValidation, supplierID, entry, cacheTTL) {
 		return
 	}
 
-	err = this.redisClient.Set(context.Background(), primaryKey, data, 30*24*time.Hour).Err()
-	if err != nil {
-		this.log.Error("Error storing advanced cache entries", "error", err, "primaryKey", primaryKey[:20]+"...")
-		return
-	}
+	indexed := this.indexLayout(ctx, layout, key)
 
-	this.log.Info("Advanced cache updated successfully",
-		"primaryKey", primaryKey[:20]+"...",
-		"exactHash", exactHash[:16]+"...",
-		"totalEntries", len(cleanedEntries),
+	this.log.Info("Table validation cached",
+		"columns", layout.Columns,
+		"indexedLayouts", indexed,
 		"isProductTable", validation.IsProductTable,
 		"confidence", validation.Confidence)
-} // normalizeDataForCaching normalizes data values to detect patterns rather than cache specific values
-func (this *ExcelParserService) normalizeDataForCaching(value string) string {
-	value = strings.TrimSpace(value)
-	if value == "" {
-		return "EMPTY"
-	}
-
-	// Check if it's a number
-	if _, err := strconv.ParseFloat(value, 64); err == nil {
-		return "NUMBER"
-	}
-
-	// Check if it looks like a product code/SKU (alphanumeric)
-	if this.isAlphanumericCode(value) {
-		return "CODE"
-	}
-
-	// Check length categories for text
-	if len(value) <= 10 {
-		return "SHORT_TEXT"
-	} else if len(value) <= 50 {
-		return "MEDIUM_TEXT"
-	} else {
-		return "LONG_TEXT"
-	}
 }
 
-// isAlphanumericCode checks if string looks like a product code
-func (this *ExcelParserService) isAlphanumericCode(s string) bool {
-	if len(s) < 2 || len(s) > 20 {
-		return false
-	}
-
-	hasLetter := false
-	hasDigit := false
+// indexLayout adds the layout to the index of its column count and returns the index size.
+// The layout replaces the most similar one, old layouts are dropped by age and count
+func (this *ExcelParserService) indexLayout(ctx context.Context, layout *app.LayoutFingerprint, key string) int {
+	indexKey := this.layoutIndexKey(layout.Columns)
+	unlock := this.cacheLocks.lock(indexKey)
+	defer unlock()
 
-	for _, r := range s {
-		if (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') {
-			hasLetter = true
-		} else if r >= '0' && r <= '9' {
-			hasDigit = true
-		} else if r != '-' && r != '_' && r != '.' {
-			return false // Invalid character for product code
-		}
+	var index []layoutIndexEntry
+	if !this.getCached(ctx, indexKey, 0, &index) {
+		index = nil // Reset on miss or error
 	}
 
-	return hasLetter || hasDigit // At least one letter or digit
-}
-
-// getHeuristicHeaders attempts to determine likely headers without GPT analysis
-func (this *ExcelParserService) getHeuristicHeaders(grid [][]string, startRow, maxCol int) []string {
-	// Use ONLY the first meaningful row as headers for caching consistency
-	headers := make([]string, maxCol)
-
-	if startRow < len(grid) {
-		for c := 0; c < maxCol && c < len(grid[startRow]); c++ {
-			headers[c] = strings.TrimSpace(grid[startRow][c])
+	entry := layoutIndexEntry{Key: key, Layout: layout, Timestamp: time.Now().Unix()}
+	replace, bestScore := -1, this.layoutSimilarity
+	for i := range index {
+		if index[i].Key == key {
+			replace = i
+			break
 		}
-	}
-
-	this.log.Debug("Generated heuristic headers",
-		"startRow", startRow,
-		"maxCol", maxCol,
-		"headers", headers)
-
-	return headers
-} // getHeuristicSampleRows gets sample data rows (excluding the header row)
-func (this *ExcelParserService) getHeuristicSampleRows(grid [][]string, startRow, maxCol int) [][]string {
-	sampleRows := make([][]string, 0, 3)
-
-	// Start from startRow+1 to skip the header row, take up to 3 data rows
-	for i := startRow + 1; i < min(startRow+4, len(grid)); i++ {
-		if i < len(grid) {
-			row := make([]string, maxCol)
-			hasData := false
-			for j := 0; j < maxCol && j < len(grid[i]); j++ {
-				if j < len(grid[i]) {
-					row[j] = strings.TrimSpace(grid[i][j])
-					if row[j] != "" {
-						hasData = true
-					}
-				}
-			}
-			if hasData {
-				sampleRows = append(sampleRows, row)
-			}
+		if score := layoutSimilarity(layout, index[i].Layout); score >= bestScore {
+			replace, bestScore = i, score
 		}
 	}
-
-	this.log.Debug("Generated heuristic sample rows",
-		"startRow", startRow,
-		"sampleRowCount", len(sampleRows),
-		"sampleRows", sampleRows)
-
-	return sampleRows
-}
-
-// getCachedTableValidation attempts to retrieve cached table validation result
-func (this *ExcelParserService) getCachedTableValidation(headers []string, sampleRows [][]string) (*GPTTableValidationResponse, bool) {
-	cacheKey := this.generateTableValidationCacheKey(headers, sampleRows)
-
-	this.log.Debug("Checking table validation cache",
-		"cacheKey", cacheKey[:20]+"...",
-		"headersCount", len(headers),
-		"sampleRowsCount", len(sampleRows))
-
-	cachedData, err := this.redisClient.Get(context.Background(), cacheKey).Result()
-	if err == redis.Nil {
-		this.log.Debug("Table validation cache miss", "cacheKey", cacheKey[:20]+"...")
-		return nil, false
-	}
-	if err != nil {
-		this.log.Error("Error retrieving table validation from cache", "error", err, "cacheKey", cacheKey[:20]+"...")
-		return nil, false
-	}
-
-	var validation GPTTableValidationResponse
-	if err := json.Unmarshal([]byte(cachedData), &validation); err != nil {
-		this.log.Error("Error unmarshaling cached table validation", "error", err, "cacheKey", cacheKey[:20]+"...")
-		return nil, false
+	if replace >= 0 {
+		index[replace] = entry
+	} else {
+		index = append(index, entry)
 	}
 
-	this.log.Info("Table validation cache hit",
-		"cacheKey", cacheKey[:20]+"...",
-		"isProductTable", validation.IsProductTable,
-		"reasoning", validation.Reasoning[:min(100, len(validation.Reasoning))]+"...")
-	return &validation, true
-}
-
-// setCachedTableValidation stores table validation result in cache
-func (this *ExcelParserService) setCachedTableValidation(headers []string, sampleRows [][]string, validation *GPTTableValidationResponse) {
-	cacheKey := this.generateTableValidationCacheKey(headers, sampleRows)
-
-	this.log.Debug("Setting table validation cache",
-		"cacheKey", cacheKey[:20]+"...",
-		"isProductTable", validation.IsProductTable,
-		"reasoning", validation.Reasoning[:min(100, len(validation.Reasoning))]+"...")
-
-	data, err := json.Marshal(validation)
-	if err != nil {
-		this.log.Error("Error marshaling table validation for cache", "error", err, "cacheKey", cacheKey[:20]+"...")
-		return
+	now := time.Now()
+	kept := make([]layoutIndexEntry, 0, len(index))
+	for _, e := range index {
+		if now.Sub(time.Unix(e.Timestamp, 0)) <= layoutCacheMaxAge {
+			kept = append(kept, e)
+		}
 	}
-
-	err = this.redisClient.Set(context.Background(), cacheKey, data, 30*24*time.Hour).Err()
-	if err != nil {
-		this.log.Error("Error storing table validation in cache", "error", err, "cacheKey", cacheKey[:20]+"...")
-		return
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].Timestamp > kept[j].Timestamp
+	})
+	if len(kept) > layoutCacheMaxEntries {
+		kept = kept[:layoutCacheMaxEntries]
 	}
 
-	this.log.Info("Table validation cached successfully",
-		"cacheKey", cacheKey[:20]+"...",
-		"isProductTable", validation.IsProductTable)
+	this.writeCached(ctx, indexKey, app.ParserCacheKindLayoutIndex, 0, kept, cacheTTL)
+	return len(kept)
 }
 
 // getCachedHeaderAnalysis retrieves cached header analysis result
-func (this *ExcelParserService) getCachedHeaderAnalysis(rowTexts []string) (*GPTAnalysisResponse, bool) {
-	cacheKey := this.generateCacheKey(headerAnalysisCacheKey, rowTexts)
+func (this *ExcelParserService) getCachedHeaderAnalysis(ctx context.Context, rowTexts []string, supplierID uint64) (*GPTAnalysisResponse, bool) {
+	cacheKey := this.generateCacheKey(app.ParserCacheKindHeaderAnalysis, rowTexts)
 
 	this.log.Debug("Checking header analysis cache",
-		"cacheKey", cacheKey[:20]+"...",
+		"cacheKey", shortCacheKey(cacheKey),
 		"rowTextsCount", len(rowTexts))
 
-	result := this.redisClient.Get(context.Background(), cacheKey)
-	if result.Err() != nil {
-		this.log.Debug("Header analysis cache miss", "cacheKey", cacheKey[:20]+"...", "error", result.Err())
-		return nil, false
-	}
-
-	data, err := result.Result()
-	if err != nil {
-		this.log.Debug("Header analysis cache miss", "cacheKey", cacheKey[:20]+"...", "error", err)
-		return nil, false
-	}
-
 	var analysis GPTAnalysisResponse
-	if err := json.Unmarshal([]byte(data), &analysis); err != nil {
-		this.log.Error("Error unmarshaling cached header analysis", "error", err, "cacheKey", cacheKey[:20]+"...")
+	if !this.getCached(ctx, cacheKey, supplierID, &analysis) {
+		this.log.Debug("Header analysis cache miss", "cacheKey", shortCacheKey(cacheKey))
 		return nil, false
 	}
 
 	this.log.Info("Header analysis cache hit",
-		"cacheKey", cacheKey[:20]+"...",
+		"cacheKey", shortCacheKey(cacheKey),
 		"headerRowIndex", analysis.HeaderRowIndex,
 		"dataStartIndex", analysis.DataStartIndex,
 		"reasoning", analysis.Reasoning[:min(100, len(analysis.Reasoning))]+"...")
@@ -504,74 +332,92 @@ func (this *ExcelParserService) getCachedHeaderAnalysis(rowTexts []string) (*GPT
 }
 
 // setCachedHeaderAnalysis stores header analysis result in cache
-func (this *ExcelParserService) setCachedHeaderAnalysis(rowTexts []string, analysis *GPTAnalysisResponse) {
-	cacheKey := this.generateCacheKey(headerAnalysisCacheKey, rowTexts)
+func (this *ExcelParserService) setCachedHeaderAnalysis(ctx context.Context, rowTexts []string, supplierID uint64, analysis *GPTAnalysisResponse) {
+	cacheKey := this.generateCacheKey(app.ParserCacheKindHeaderAnalysis, rowTexts)
 
 	this.log.Debug("Setting header analysis cache",
-		"cacheKey", cacheKey[:20]+"...",
+		"cacheKey", shortCacheKey(cacheKey),
 		"headerRowIndex", analysis.HeaderRowIndex,
 		"dataStartIndex", analysis.DataStartIndex,
 		"reasoning", analysis.Reasoning[:min(100, len(analysis.Reasoning))]+"...")
 
-	data, err := json.Marshal(analysis)
-	if err != nil {
-		this.log.Error("failed to marshal header analysis for cache", "error", err, "cacheKey", cacheKey[:20]+"...")
-		return
-	}
-
-	if err := this.redisClient.Set(context.Background(), cacheKey, string(data), cacheTTL).Err(); err != nil {
-		this.log.Error("failed to cache header analysis", "error", err, "cacheKey", cacheKey[:20]+"...")
-	} else {
+	if this.setCached(ctx, cacheKey, app.ParserCacheKindHeaderAnalysis, supplierID, analysis, cacheTTL) {
 		this.log.Info("Header analysis cached successfully",
-			"cacheKey", cacheKey[:20]+"...",
+			"cacheKey", shortCacheKey(cacheKey),
 			"headerRowIndex", analysis.HeaderRowIndex,
 			"dataStartIndex", analysis.DataStartIndex)
 	}
 }
 
-func (this *ExcelParserService) Parse(ctx nova_ctx.Ctx, file []byte) ([]*app.ParseExcelResult, errs.Error) {
-	res, err := this.parse(file)
+func (this *ExcelParserService) Parse(ctx nova_ctx.Ctx, file []byte, opts app.ParseOptions) ([]*app.ParseExcelResult, errs.Error) {
+	parseCtx, cancel := context.WithTimeout(ctx, this.timeouts.parse)
+	defer cancel()
+
+	res, err := this.parse(parseCtx, file, opts, nil)
 	if err != nil {
-		return nil, errs.WrapAppError(err, &errs.ErrorOpts{})
+		return nil, errs.WrapAppError(err, &errs.ErrorOpts{Ctx: ctx})
 	}
 
 	return res, nil
 }
 
+func (this *ExcelParserService) ParseWithReport(ctx nova_ctx.Ctx, file []byte, opts app.ParseOptions) ([]*app.ParseExcelResult, *app.ParseReport, errs.Error) {
+	parseCtx, cancel := context.WithTimeout(ctx, this.timeouts.parse)
+	defer cancel()
+
+	report := &app.ParseReport{}
+	res, err := this.parse(parseCtx, file, opts, report)
+	if err != nil {
+		return nil, report, errs.WrapAppError(err, &errs.ErrorOpts{Ctx: ctx})
+	}
+
+	return res, report, nil
+}
+
+// interrupted returns ErrParseCancelled or ErrParseTimeout once the parse context is done
+func interrupted(ctx context.Context) error {
+	switch err := ctx.Err(); {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("%w: %w", app.ErrParseTimeout, err)
+	default:
+		return fmt.Errorf("%w: %w", app.ErrParseCancelled, err)
+	}
+}
+
 // isProductTable checks if the given table structure represents a product/goods table
-func (this *ExcelParserService) isProductTable(header []string, sampleRows [][]string) bool {
-	return this.isProductTableWithBoundaries(header, sampleRows, -1, -1)
+func (this *ExcelParserService) isProductTable(ctx context.Context, header []string, sampleRows [][]string) bool {
+	ok, _ := this.isProductTableWithLayout(ctx, header, sampleRows, nil, 0, nil)
+	return ok
 }
 
-// isProductTableWithBoundaries checks table with header boundary information for advanced caching
-func (this *ExcelParserService) isProductTableWithBoundaries(header []string, sampleRows [][]string, headerStart, headerEnd int) bool {
-	// Check advanced cache first (with collision resistance)
-	if headerStart >= 0 && headerEnd >= 0 {
-		if cached, found := this.getAdvancedCachedTableValidation(header, headerStart, headerEnd); found {
-			this.log.Info("Using advanced cached table validation result",
+// isProductTableWithLayout checks a table, reusing the answer given for the most similar known layout.
+// Answers are cached only when the layout is known. Also returns the source of the verdict,
+// empty when the parse was interrupted
+func (this *ExcelParserService) isProductTableWithLayout(ctx context.Context, header []string, sampleRows [][]string, layout *app.LayoutFingerprint, supplierID uint64, trace *tableTrace) (bool, app.DecisionSource) {
+	if this.detection == DetectionModeHeuristic {
+		heuristic := classifyProductTable(header, sampleRows)
+		trace.validation(app.DecisionSourceHeuristic, heuristic)
+		return heuristic.IsProductTable, app.DecisionSourceHeuristic
+	}
+
+	if layout != nil {
+		if cached, found := this.getCachedTableValidation(ctx, layout, supplierID); found {
+			this.log.Info("Using cached table validation result",
 				"isProductTable", cached.IsProductTable,
 				"confidence", cached.Confidence,
 				"reasoning", cached.Reasoning[:min(100, len(cached.Reasoning))]+"...")
-			return cached.IsProductTable && cached.Confidence >= 7
+			trace.cacheHit(app.ParserCacheKindTableValidation)
+			trace.validation(app.DecisionSourceCache, cached)
+			return cached.IsProductTable && cached.Confidence >= 7, app.DecisionSourceCache
 		}
 	}
 
-	// Fallback to old cache system for compatibility
-	if cached, found := this.getCachedTableValidation(header, sampleRows); found {
-		this.log.Info("Using legacy cached table validation result",
-			"isProductTable", cached.IsProductTable,
-			"confidence", cached.Confidence,
-			"reasoning", cached.Reasoning[:min(100, len(cached.Reasoning))]+"...")
-		return cached.IsProductTable && cached.Confidence >= 7
-	}
-
 	// Create a prompt with header and sample data
 	headerText := strings.Join(header, " | ")
 
-	prompt := "Analyze this table structure and determine if it represents a product/goods catalog table. " +
-		"Look for typical e-commerce/catalog columns like артикул, код, цена, остаток, наименование, описание, бренд, etc. " +
-		"Ignore contact information, navigation menus, or administrative tables.\n\n" +
-		"Header: " + headerText + "\n\n"
+	prompt := tableValidationInstructions + "Header: " + headerText + "\n\n"
 
 	if len(sampleRows) > 0 {
 		prompt += "Sample data rows:\n"
@@ -584,23 +430,12 @@ func (this *ExcelParserService) isProductTableWithBoundaries(header []string, sa
 		}
 	}
 
-	schemaParam := openai.ResponseFormatJSONSchemaJSONSchemaParam{
-		Name:        "table_validation_response",
-		Description: openai.String("Analysis of whether table represents product catalog"),
-		Schema:      GPTTableValidationResponseSchema,
-		Strict:      openai.Bool(true),
-	}
-
-	req := openai.ChatCompletionNewParams{
-		Model: openai.ChatModelGPT5Nano,
-		Messages: []openai.ChatCompletionMessageParamUnion{
-			openai.UserMessage(prompt),
-		},
-		ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{
-			OfJSONSchema: &openai.ResponseFormatJSONSchemaParam{
-				JSONSchema: schemaParam,
-			},
-		},
+	req := app.CompletionRequest{
+		Task:              app.LLMTaskTableValidation,
+		Prompt:            prompt,
+		SchemaName:        "table_validation_response",
+		SchemaDescription: "Analysis of whether table represents product catalog",
+		Schema:            GPTTableValidationResponseSchema,
 	}
 
 	this.log.Info("Making GPT API call for table validation",
@@ -608,363 +443,485 @@ func (this *ExcelParserService) isProductTableWithBoundaries(header []string, sa
 		"sampleRowsCount", len(sampleRows),
 		"headerText", headerText[:min(100, len(headerText))]+"...")
 
-	resp, err := this.openaiClient.Chat.Completions.New(context.Background(), req)
-	if err != nil {
-		this.log.Error("failed to validate table with GPT", "error", err)
-		return true // Default to true if validation fails
-	}
+	callCtx, cancel := context.WithTimeout(ctx, this.timeouts.tableValidation)
+	defer cancel()
 
-	if len(resp.Choices) > 0 {
-		gptResponse := strings.TrimSpace(resp.Choices[0].Message.Content)
-		var validation GPTTableValidationResponse
-		if parseErr := json.Unmarshal([]byte(gptResponse), &validation); parseErr == nil {
-			// Cache in both systems
-			this.setCachedTableValidation(header, sampleRows, &validation)
-
-			// Advanced cache with boundaries if available
-			if headerStart >= 0 && headerEnd >= 0 {
-				this.setAdvancedCachedTableValidation(header, headerStart, headerEnd, &validation)
-			}
-
-			this.log.Info("GPT table validation result",
-				"isProductTable", validation.IsProductTable,
-				"confidence", validation.Confidence,
-				"reasoning", validation.Reasoning)
-			return validation.IsProductTable && validation.Confidence >= 7
+	var validation GPTTableValidationResponse
+	if err := this.llm.Complete(callCtx, req, &validation); err != nil {
+		if ctx.Err() != nil {
+			// The parse is stopping, the caller returns the context error
+			return false, ""
 		}
+		this.log.Error("failed to validate table with GPT, using heuristic validation", "error", err)
+		heuristic := classifyProductTable(header, sampleRows)
+		this.log.Info("Heuristic table validation result",
+			"isProductTable", heuristic.IsProductTable,
+			"confidence", heuristic.Confidence,
+			"reasoning", heuristic.Reasoning)
+		trace.validation(app.DecisionSourceHeuristic, heuristic)
+		return heuristic.IsProductTable, app.DecisionSourceHeuristic
 	}
 
-	return true // Default to true if parsing fails
-}
-
-type HeaderCache interface {
-	// Assuming some interface, but not used in this implementation
-}
+	if layout != nil && layout.Columns > 0 {
+		this.setCachedTableValidation(ctx, layout, supplierID, &validation)
+	}
 
-type memHeaderCache struct {
-	// Implementation if needed
+	this.log.Info("GPT table validation result",
+		"isProductTable", validation.IsProductTable,
+		"confidence", validation.Confidence,
+		"reasoning", validation.Reasoning)
+	trace.validation(app.DecisionSourceLLM, &validation)
+	return validation.IsProductTable && validation.Confidence >= 7, app.DecisionSourceLLM
 }
 
-func (this *ExcelParserService) parse(file []byte) ([]*app.ParseExcelResult, error) {
+// parse detects product tables of all sheets. A non-nil report gets the diagnostics of every sheet
+func (this *ExcelParserService) parse(ctx context.Context, file []byte, opts app.ParseOptions, report *app.ParseReport) ([]*app.ParseExcelResult, error) {
 	this.log.Info("Excel parsing started")
 
-	f, err := excelize.OpenReader(bytes.NewReader(file))
+	sheets, err := this.readWorkbook(file)
 	if err != nil {
 		return nil, err
 	}
 
-	var results []*app.ParseExcelResult
-	for _, sheet := range f.GetSheetList() {
-		grid, maxCol, err := getFilledGrid(f, sheet)
-		if err != nil {
-			this.log.Error("failed to get filled grid", "error", err)
-			continue
-		}
-		if len(grid) == 0 {
-			continue
+	template := this.loadTemplate(ctx, opts.SupplierID)
+
+	// Sheets are analyzed by a pool of workers, results are collected per sheet to keep the workbook order
+	perSheet := make([][]*app.ParseExcelResult, len(sheets))
+	learned := make([]*app.SheetTemplate, len(sheets))
+	sheetErrs := make([]error, len(sheets))
+	sheetReports := make([]*app.SheetReport, len(sheets))
+	if report != nil {
+		for i, ws := range sheets {
+			sheetReports[i] = &app.SheetReport{Sheet: ws.name, Encoding: ws.encoding}
 		}
+		report.Sheets = sheetReports
+	}
+	jobs := make(chan int)
 
-		// Find start row: first row with at least 3 non-empty cells
-		startRow := -1
-		for i := 0; i < len(grid); i++ {
-			nonEmptyCount := 0
-			for _, cell := range grid[i] {
-				if cell != "" {
-					nonEmptyCount++
-				}
-			}
-			if nonEmptyCount >= 3 {
-				startRow = i
-				break
+	var wg sync.WaitGroup
+	for range min(this.workers, len(sheets)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				perSheet[i], learned[i], sheetErrs[i] = this.parseSheet(ctx, sheets[i], opts, sheetTemplate(template, sheets[i].name), sheetReports[i])
 			}
+		}()
+	}
+	for i := range sheets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var results []*app.ParseExcelResult
+	for i := range sheets {
+		if sheetErrs[i] != nil {
+			return nil, sheetErrs[i]
 		}
-		if startRow == -1 {
-			continue
-		}
+		results = append(results, perSheet[i]...)
+	}
 
-		// Early cache check: try to determine if this is a product table using heuristic headers
-		// This avoids GPT calls for structure analysis when we already know the answer
-		heuristicHeaders := this.getHeuristicHeaders(grid, startRow, maxCol)
-		heuristicSampleRows := this.getHeuristicSampleRows(grid, startRow, maxCol)
+	if err := interrupted(ctx); err != nil {
+		this.log.Warn("Excel parsing interrupted", "error", err)
+		return nil, err
+	}
+	this.learnTemplate(ctx, opts.SupplierID, learned)
 
-		this.log.Info("Starting early cache check with heuristic headers",
-			"sheet", sheet,
-			"heuristicHeadersCount", len(heuristicHeaders),
-			"heuristicSampleRowsCount", len(heuristicSampleRows),
-			"firstFewHeaders", heuristicHeaders[:min(3, len(heuristicHeaders))])
-
-		// Check cache for table validation using heuristic headers
-		// Try advanced cache first, then fallback to legacy cache
-		if cached, found := this.getAdvancedCachedTableValidation(heuristicHeaders, startRow, startRow); found {
-			this.log.Info("Using advanced cached table validation for early decision",
-				"sheet", sheet,
-				"isProductTable", cached.IsProductTable,
-				"confidence", cached.Confidence,
-				"reasoning", cached.Reasoning[:min(100, len(cached.Reasoning))]+"...")
+	this.log.Info("Excel parsing completed successfully", "sheetsProcessed", len(results))
+	return results, nil
+}
 
-			// If cache says it's not a product table with high confidence, skip expensive processing
-			if !cached.IsProductTable && cached.Confidence >= 7 {
-				this.log.Info("Skipping sheet based on advanced cached validation - not a product table", "sheet", sheet)
-				continue
-			}
-		} else if cached, found := this.getCachedTableValidation(heuristicHeaders, heuristicSampleRows); found {
-			this.log.Info("Using legacy cached table validation for early decision",
-				"sheet", sheet,
-				"isProductTable", cached.IsProductTable,
-				"confidence", cached.Confidence,
-				"reasoning", cached.Reasoning[:min(100, len(cached.Reasoning))]+"...")
+// parseSheet detects and parses the product tables of one sheet. It runs concurrently with other sheets,
+// a panic is returned as an error of the sheet. Tables matching the supplier template of the sheet reuse
+// its decisions, learned is the template of the sheet after parsing, nil if nothing can be reused.
+// A non-nil report gets the sheet diagnostics
+func (this *ExcelParserService) parseSheet(ctx context.Context, ws *workbookSheet, opts app.ParseOptions, tmpl *app.SheetTemplate, report *app.SheetReport) (results []*app.ParseExcelResult, learned *app.SheetTemplate, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("sheet %s: panic: %v", ws.name, r)
+		}
+		if err != nil && report != nil {
+			report.Error = err.Error()
+		}
+	}()
 
-			// If cache says it's not a product table with high confidence, skip expensive processing
-			if !cached.IsProductTable && cached.Confidence >= 7 {
-				this.log.Info("Skipping sheet based on legacy cached validation - not a product table", "sheet", sheet)
-				continue
-			}
-		} else {
-			this.log.Info("No early cache hit - proceeding with GPT analysis", "sheet", sheet)
+	if ws.isHidden && !opts.KeepHiddenSheets {
+		this.log.Info("Skipping hidden sheet", "sheet", ws.name)
+		if report != nil {
+			report.Skipped = "hidden sheet"
 		}
+		return nil, nil, nil
+	}
 
-		// Determine header rows using GPT
-		potentialHeaderRows := min(10, len(grid)-startRow)
-		rowTexts := make([]string, 0, potentialHeaderRows)
-		rowIndices := make([]int, 0, potentialHeaderRows) // Track original indices
-		for j := 0; j < potentialHeaderRows; j++ {
-			text := strings.Join(grid[startRow+j][:maxCol], " ")
-			if strings.TrimSpace(text) == "" {
-				continue
-			}
-			rowTexts = append(rowTexts, text)
-			rowIndices = append(rowIndices, startRow+j) // Store original row index
+	sheet, sg := ws.name, ws.grid
+	if sg == nil || len(sg.cells) == 0 {
+		if report != nil {
+			report.Skipped = "empty sheet"
 		}
+		return nil, nil, nil
+	}
+	sg = sg.withoutHidden(opts)
 
-		if len(rowTexts) < 2 {
-			// Too few rows, assume no header or minimal
-			headerRows := 0
-			if len(rowTexts) == 1 {
-				headerRows = 1
-			}
-			result := buildResultWithIndices(grid, startRow, headerRows, -1, -1, maxCol, sheet)
+	regions := detectTableRegions(sg)
+	if len(regions) == 0 && report != nil {
+		report.Skipped = "no table regions, every row is blank after hidden rows and columns were removed"
+	}
+	if sheetRejectedByTemplate(tmpl, sg, sheet, regions, this.layoutSimilarity) {
+		this.log.Info("Skipping sheet by the supplier template", "sheet", sheet)
+		if report != nil {
+			report.Skipped = reasonTemplateSheet
+		}
+		return nil, tmpl, nil
+	}
 
-			// Still validate even minimal tables
-			sampleRows := result.Rows
-			if len(sampleRows) > 3 {
-				sampleRows = sampleRows[:3]
-			}
+	learned = &app.SheetTemplate{Sheet: sheet}
+	complete := true
+	for _, region := range regions {
+		if err := interrupted(ctx); err != nil {
+			this.log.Warn("Excel parsing interrupted", "sheet", sheet, "error", err)
+			return nil, nil, err
+		}
 
-			if this.isProductTableWithBoundaries(result.Header, sampleRows, startRow, startRow+headerRows-1) {
-				this.log.Info("Minimal table validated as product table")
-				results = append(results, result)
-			} else {
-				this.log.Info("Minimal table rejected - not a product table", "header", result.Header)
-			}
-			continue
+		sub := sg.subGrid(region)
+		trace := newTableTrace(report, sub, sg.cellRange(region))
+		result, table := this.parseTable(ctx, sheet, sub, opts, tmpl, trace)
+		if table != nil {
+			learned.Tables = append(learned.Tables, table)
+		} else if tableStartRow(sub.cells) >= 0 {
+			complete = false
+		}
+		if result != nil {
+			extractCategories(result)
+			result.Profiles = profileColumns(result)
+			result.Range = sg.cellRange(region)
+			result.ComputedCells, result.FailedFormulas = sg.formulaReport(region)
+			results = append(results, result)
 		}
+	}
 
-		// Use GPT to analyze header structure
-		// Check cache first
-		var analysis GPTAnalysisResponse
-		var useGPTResult bool
+	if len(learned.Tables) == 0 {
+		return results, nil, nil
+	}
+	learned.Skipped = complete && len(results) == 0
 
-		if cached, found := this.getCachedHeaderAnalysis(rowTexts); found {
-			this.log.Info("Using cached header analysis result", "headerRowIndex", cached.HeaderRowIndex, "dataStartIndex", cached.DataStartIndex)
-			analysis = *cached
-			useGPTResult = true
-		} else {
-			prompt := "Analyze this Excel data and identify which row contains the actual table column headers and where the data starts.\n\n" +
-				"IMPORTANT RULES:\n" +
-				"1. Column headers are typically short, descriptive field names (like product codes, names, prices, quantities)\n" +
-				"2. Avoid rows that contain category names, section titles, or descriptive text that spans multiple cells\n" +
-				"3. If you see a row with long descriptive text followed by a row with short field-like names, choose the row with short field names\n" +
-				"4. Data rows contain actual values, not field names\n" +
-				"5. Skip any promotional text, contact information, or metadata\n\n" +
-				"Example patterns:\n" +
-				"- GOOD header row: 'Code | Name | Price | Stock'\n" +
-				"- BAD header row: 'Electronics and Computer Accessories for Modern Office'\n" +
-				"- GOOD data row: 'A123 | Laptop Dell | 1500.00 | 5'\n\n" +
-				"Rows:\n"
-
-			for i, text := range rowTexts {
-				prompt += fmt.Sprintf("Row %d: %s\n", i, text)
-			}
+	return results, learned, nil
+}
 
-			schemaParam := openai.ResponseFormatJSONSchemaJSONSchemaParam{
-				Name:        "gpt_analysis_response",
-				Description: openai.String("Analysis of Excel data to determine header rows"),
-				Schema:      GPTAnalysisResponseSchema,
-				Strict:      openai.Bool(true),
+// tableStartRow returns the first row with at least 3 non-empty cells, -1 if none
+func tableStartRow(grid [][]string) int {
+	for i := 0; i < len(grid); i++ {
+		nonEmptyCount := 0
+		for _, cell := range grid[i] {
+			if cell != "" {
+				nonEmptyCount++
 			}
+		}
+		if nonEmptyCount >= 3 {
+			return i
+		}
+	}
 
-			req := openai.ChatCompletionNewParams{
-				Model: openai.ChatModelGPT5Nano,
-				Messages: []openai.ChatCompletionMessageParamUnion{
-					openai.UserMessage(prompt),
-				},
-				ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{
-					OfJSONSchema: &openai.ResponseFormatJSONSchemaParam{
-						JSONSchema: schemaParam,
-					},
-				},
-			}
+	return -1
+}
 
-			this.log.Info("Making GPT API call for header analysis",
-				"rowTextsCount", len(rowTexts),
-				"promptLength", len(prompt))
+// parseTable detects headers and validates one table region of a sheet.
+// A region whose layout matches a table of the sheet template is decided by the template without the model.
+// Returns nil if the region is not a product table. The decision is returned as a template table
+// when it can be reused for the same layout, nil when it came from heuristics or the parse was interrupted
+func (this *ExcelParserService) parseTable(ctx context.Context, sheet string, sg *sheetGrid, opts app.ParseOptions, tmpl *app.SheetTemplate, trace *tableTrace) (*app.ParseExcelResult, *app.TableTemplate) {
+	grid, maxCol := sg.cells, sg.maxCol
 
-			resp, err := this.openaiClient.Chat.Completions.New(context.Background(), req)
-			if err != nil {
-				this.log.Error("failed to get GPT response", "error", err)
-				// Fallback to heuristic: assume 1-2 header rows
-				result := buildResultWithIndices(grid, startRow, 1, -1, -1, maxCol, sheet)
+	startRow := tableStartRow(grid)
+	if startRow == -1 {
+		trace.decide(false, reasonNoStartRow)
+		return nil, nil
+	}
+	trace.start(startRow)
 
-				// Still validate fallback tables
-				sampleRows := result.Rows
-				if len(sampleRows) > 3 {
-					sampleRows = sampleRows[:3]
-				}
+	if table := matchTableTemplate(tmpl, sg, sheet, startRow, this.layoutSimilarity); table != nil {
+		return this.parseTableFromTemplate(sheet, sg, startRow, table, trace), table
+	}
 
-				if this.isProductTableWithBoundaries(result.Header, sampleRows, startRow, startRow) {
-					this.log.Info("Fallback table validated as product table")
-					results = append(results, result)
-				} else {
-					this.log.Info("Fallback table rejected - not a product table", "header", result.Header)
-				}
-				continue
-			}
+	if this.detection == DetectionModeHeuristic {
+		return this.parseTableHeuristic(sheet, sg, startRow, trace), nil
+	}
 
-			if len(resp.Choices) > 0 {
-				gptResponse := strings.TrimSpace(resp.Choices[0].Message.Content)
+	// Early cache check: try to determine if this is a product table using the start row as the header
+	// This avoids GPT calls for structure analysis when we already know the answer
+	earlyLayout := layoutAt(sg, sheet, startRow, 1, startRow, startRow+1)
 
-				// Parse JSON response directly (no markdown blocks with structured outputs)
-				if parseErr := json.Unmarshal([]byte(gptResponse), &analysis); parseErr == nil {
-					// Cache the successful result
-					this.setCachedHeaderAnalysis(rowTexts, &analysis)
-					useGPTResult = true
-				}
-			}
-		}
+	this.log.Info("Starting early cache check with the start row layout",
+		"sheet", sheet,
+		"columns", earlyLayout.Columns)
 
-		headerRows := 1 // Default fallback
-		actualHeaderRowIndex := -1
-		actualDataStartIndex := -1
-
-		if useGPTResult {
-			if analysis.HeaderRowIndex >= 0 && analysis.HeaderRowIndex < len(rowTexts) &&
-				analysis.DataStartIndex >= 0 && analysis.DataStartIndex < len(rowTexts) &&
-				analysis.DataStartIndex > analysis.HeaderRowIndex {
-				// Convert rowTexts indices to actual grid indices
-				actualHeaderRowIndex = rowIndices[analysis.HeaderRowIndex]
-				actualDataStartIndex = rowIndices[analysis.DataStartIndex]
-			}
+	// Check cache for table validation of a similar layout
+	if cached, found := this.getCachedTableValidation(ctx, earlyLayout, opts.SupplierID); found {
+		this.log.Info("Using cached table validation for early decision",
+			"sheet", sheet,
+			"isProductTable", cached.IsProductTable,
+			"confidence", cached.Confidence,
+			"reasoning", cached.Reasoning[:min(100, len(cached.Reasoning))]+"...")
+
+		// If cache says it's not a product table with high confidence, skip expensive processing
+		if !cached.IsProductTable && cached.Confidence >= 7 {
+			this.log.Info("Skipping sheet based on cached validation - not a product table", "sheet", sheet)
+			trace.cacheHit(app.ParserCacheKindTableValidation)
+			trace.validation(app.DecisionSourceCache, cached)
+			trace.decide(false, reasonEarlyCacheReject)
+			return nil, newTableTemplate(earlyLayout, startRow, 1, startRow, startRow+1, false)
 		}
+	} else {
+		this.log.Info("No early cache hit - proceeding with GPT analysis", "sheet", sheet)
+	}
 
-		// Cap at reasonable number
-		if headerRows > 5 {
-			headerRows = 3 // Reasonable fallback for complex headers
+	// Determine header rows using GPT
+	potentialHeaderRows := min(10, len(grid)-startRow)
+	rowTexts := make([]string, 0, potentialHeaderRows)
+	rowIndices := make([]int, 0, potentialHeaderRows) // Track original indices
+	for j := 0; j < potentialHeaderRows; j++ {
+		text := strings.Join(grid[startRow+j][:maxCol], " ")
+		if strings.TrimSpace(text) == "" {
+			continue
 		}
+		rowTexts = append(rowTexts, text)
+		rowIndices = append(rowIndices, startRow+j) // Store original row index
+	}
 
-		result := buildResultWithIndices(grid, startRow, headerRows, actualHeaderRowIndex, actualDataStartIndex, maxCol, sheet)
+	if len(rowTexts) < 2 {
+		// Too few rows, assume no header or minimal
+		headerRows := 0
+		if len(rowTexts) == 1 {
+			headerRows = 1
+		}
+		result := buildResultWithIndices(sg, startRow, headerRows, -1, -1, maxCol, sheet)
+		if headerRows == 1 {
+			trace.headerAnalysis(app.DecisionSourceMinimal, nil, startRow, startRow+1)
+		} else {
+			trace.headerAnalysis(app.DecisionSourceMinimal, nil, -1, startRow)
+		}
 
-		// Log detailed information about the parsed table structure
-		this.log.Info("Parsed table structure",
-			"sheet", sheet,
-			"startRow", startRow,
-			"headerRows", headerRows,
-			"actualHeaderRowIndex", actualHeaderRowIndex,
-			"actualDataStartIndex", actualDataStartIndex,
-			"maxCol", maxCol,
-			"header", result.Header,
-			"rowCount", len(result.Rows))
-
-		// Check if this is a product table using GPT
+		// Still validate even minimal tables
 		sampleRows := result.Rows
 		if len(sampleRows) > 3 {
-			sampleRows = sampleRows[:3] // Limit to first 3 rows for analysis
+			sampleRows = sampleRows[:3]
 		}
 
-		// Use advanced caching with header boundaries
-		headerStartRow := actualHeaderRowIndex
-		headerEndRow := actualHeaderRowIndex
-		if headerStartRow < 0 {
-			headerStartRow = startRow
-			headerEndRow = startRow + headerRows - 1
+		layout := tableLayout(result)
+		ok, source := this.isProductTableWithLayout(ctx, result.Header, sampleRows, layout, opts.SupplierID, trace)
+		learned := learnedTable(source, layout, startRow, headerRows, -1, -1, ok)
+		if ok {
+			this.log.Info("Minimal table validated as product table")
+			trace.decide(true, reasonProductTable)
+			return withLayout(result, learned), learned
 		}
 
-		if this.isProductTableWithBoundaries(result.Header, sampleRows, headerStartRow, headerEndRow) {
-			this.log.Info("Table validated as product table", "sheet", sheet)
-			results = append(results, result)
-		} else {
-			this.log.Info("Table rejected - not a product table", "sheet", sheet, "header", result.Header)
+		this.log.Info("Minimal table rejected - not a product table", "header", result.Header)
+		trace.decide(false, this.rejectReason(ctx))
+		return nil, learned
+	}
+
+	// Use GPT to analyze header structure
+	// Check cache first
+	var analysis GPTAnalysisResponse
+	var useGPTResult bool
+	analysisSource := app.DecisionSourceLLM
+
+	if cached, found := this.getCachedHeaderAnalysis(ctx, rowTexts, opts.SupplierID); found {
+		this.log.Info("Using cached header analysis result", "headerRowIndex", cached.HeaderRowIndex, "dataStartIndex", cached.DataStartIndex)
+		analysis = *cached
+		useGPTResult = true
+		analysisSource = app.DecisionSourceCache
+		trace.cacheHit(app.ParserCacheKindHeaderAnalysis)
+	} else {
+		prompt := headerAnalysisInstructions
+
+		for i, text := range rowTexts {
+			prompt += fmt.Sprintf("Row %d: %s\n", i, text)
 		}
+
+		req := app.CompletionRequest{
+			Task:              app.LLMTaskHeaderAnalysis,
+			Prompt:            prompt,
+			SchemaName:        "gpt_analysis_response",
+			SchemaDescription: "Analysis of Excel data to determine header rows",
+			Schema:            GPTAnalysisResponseSchema,
+		}
+
+		this.log.Info("Making GPT API call for header analysis",
+			"rowTextsCount", len(rowTexts),
+			"promptLength", len(prompt))
+
+		callCtx, cancel := context.WithTimeout(ctx, this.timeouts.headerAnalysis)
+		err := this.llm.Complete(callCtx, req, &analysis)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				trace.decide(false, reasonInterrupted)
+				return nil, nil
+			}
+			this.log.Error("failed to get GPT response, using heuristic detection", "error", err)
+			return this.parseTableHeuristic(sheet, sg, startRow, trace), nil
+		}
+
+		// Cache the successful result
+		this.setCachedHeaderAnalysis(ctx, rowTexts, opts.SupplierID, &analysis)
+		useGPTResult = true
 	}
 
-	this.log.Info("Excel parsing completed successfully", "sheetsProcessed", len(results))
-	return results, nil
+	headerRows := 1 // Default fallback
+	actualHeaderRowIndex := -1
+	actualDataStartIndex := -1
+
+	if useGPTResult {
+		if analysis.HeaderRowIndex >= 0 && analysis.HeaderRowIndex < len(rowTexts) &&
+			analysis.DataStartIndex >= 0 && analysis.DataStartIndex < len(rowTexts) &&
+			analysis.DataStartIndex > analysis.HeaderRowIndex {
+			// Convert rowTexts indices to actual grid indices
+			actualHeaderRowIndex = rowIndices[analysis.HeaderRowIndex]
+			actualDataStartIndex = rowIndices[analysis.DataStartIndex]
+		}
+	}
+
+	// Cap at reasonable number
+	if headerRows > 5 {
+		headerRows = 3 // Reasonable fallback for complex headers
+	}
+
+	result := buildResultWithIndices(sg, startRow, headerRows, actualHeaderRowIndex, actualDataStartIndex, maxCol, sheet)
+	trace.headerAnalysis(analysisSource, &analysis, actualHeaderRowIndex, actualDataStartIndex)
+
+	// Log detailed information about the parsed table structure
+	this.log.Info("Parsed table structure",
+		"sheet", sheet,
+		"startRow", startRow,
+		"headerRows", headerRows,
+		"actualHeaderRowIndex", actualHeaderRowIndex,
+		"actualDataStartIndex", actualDataStartIndex,
+		"maxCol", maxCol,
+		"header", result.Header,
+		"rowCount", len(result.Rows))
+
+	// Check if this is a product table using GPT
+	sampleRows := result.Rows
+	if len(sampleRows) > 3 {
+		sampleRows = sampleRows[:3] // Limit to first 3 rows for analysis
+	}
+
+	layout := tableLayout(result)
+	ok, source := this.isProductTableWithLayout(ctx, result.Header, sampleRows, layout, opts.SupplierID, trace)
+	learned := learnedTable(source, layout, startRow, headerRows, actualHeaderRowIndex, actualDataStartIndex, ok)
+	if ok {
+		this.log.Info("Table validated as product table", "sheet", sheet)
+		trace.decide(true, reasonProductTable)
+		return withLayout(result, learned), learned
+	}
+
+	this.log.Info("Table rejected - not a product table", "sheet", sheet, "header", result.Header)
+	trace.decide(false, this.rejectReason(ctx))
+	return nil, learned
 }
 
-func getFilledGrid(f *excelize.File, sheet string) ([][]string, int, error) {
-	rows, err := f.GetRows(sheet)
-	if err != nil {
-		return nil, 0, err
+// learnedTable records a table decision for the supplier template when its validation came from the model.
+// Heuristic verdicts are not stored, the model is asked again next time
+func learnedTable(source app.DecisionSource, layout *app.LayoutFingerprint, startRow, headerRows, headerRow, dataStart int, isProductTable bool) *app.TableTemplate {
+	if source != app.DecisionSourceLLM && source != app.DecisionSourceCache {
+		return nil
 	}
-	if len(rows) == 0 {
-		return nil, 0, nil
+
+	return newTableTemplate(layout, startRow, headerRows, headerRow, dataStart, isProductTable)
+}
+
+// withLayout sets the layout of a table with a reusable decision, so that its mapping can be stored in the template
+func withLayout(result *app.ParseExcelResult, learned *app.TableTemplate) *app.ParseExcelResult {
+	if learned != nil {
+		result.Layout = learned.Layout
 	}
 
-	maxCol := 0
-	for _, row := range rows {
-		if len(row) > maxCol {
-			maxCol = len(row)
-		}
+	return result
+}
+
+// rejectReason tells a rejected table from one left unvalidated by an interrupted parse
+func (this *ExcelParserService) rejectReason(ctx context.Context) string {
+	if ctx.Err() != nil {
+		return reasonInterrupted
 	}
 
-	grid := make([][]string, len(rows))
-	for i := range grid {
-		grid[i] = make([]string, maxCol)
-		if len(rows[i]) > 0 {
-			// Apply trim to all cell values
-			for j, cell := range rows[i] {
-				if j < maxCol {
-					grid[i][j] = strings.TrimSpace(cell)
-				}
-			}
-		}
+	return reasonNotProductTable
+}
+
+// getFilledGrid reads an xlsx sheet into a grid. formulas are the sheet formula cells without cached results,
+// they are evaluated and filled in
+func getFilledGrid(f *excelize.File, sheet string, formulas []*formulaCell, policy MergePolicy) (*sheetGrid, error) {
+	rows, err := f.GetRows(sheet)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := f.GetRows(sheet, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, err
+	}
+	if len(formulas) > 0 {
+		rows, raw = evaluateFormulas(f, sheet, formulas, rows, raw)
+	}
+	if len(rows) == 0 {
+		return nil, nil
 	}
 
-	merges, err := f.GetMergeCells(sheet)
+	mergeCells, err := f.GetMergeCells(sheet)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
-	for _, merge := range merges {
-		val := strings.TrimSpace(merge[0]) // Apply trim to merged cell values too
-		// Parse range
-		parts := strings.Split(merge[1], ":")
-		if len(parts) != 2 {
+
+	merges := make([]mergeRange, 0, len(mergeCells))
+	for _, merge := range mergeCells {
+		startCol, startRowIdx, err := excelize.CellNameToCoordinates(merge.GetStartAxis())
+		if err != nil {
 			continue
 		}
-		startCol, startRowIdx, err := excelize.CellNameToCoordinates(parts[0])
+		endCol, endRowIdx, err := excelize.CellNameToCoordinates(merge.GetEndAxis())
 		if err != nil {
 			continue
 		}
-		endCol, endRowIdx, err := excelize.CellNameToCoordinates(parts[1])
+
+		merges = append(merges, mergeRange{
+			startRow: startRowIdx - 1,
+			startCol: startCol - 1,
+			endRow:   endRowIdx - 1,
+			endCol:   endCol - 1,
+			value:    merge.GetCellValue(),
+		})
+	}
+
+	values := getCellValues(f, sheet, rows, raw, formulas)
+
+	sg := newSheetGrid(rows, values, merges, policy)
+	sg.formulas = formulas
+
+	hiddenRows := make([]bool, len(sg.cells))
+	for r := range hiddenRows {
+		if visible, err := f.GetRowVisible(sheet, r+1); err == nil {
+			hiddenRows[r] = !visible
+		}
+	}
+	hiddenCols := make([]bool, sg.maxCol)
+	for c := range hiddenCols {
+		name, err := excelize.ColumnNumberToName(c + 1)
 		if err != nil {
 			continue
 		}
-		startCol--
-		startRowIdx--
-		endCol--
-		endRowIdx--
-		for r := startRowIdx; r <= endRowIdx; r++ {
-			for c := startCol; c <= endCol; c++ {
-				if r < len(grid) && c < len(grid[r]) {
-					grid[r][c] = val
-				}
-			}
+		if visible, err := f.GetColVisible(sheet, name); err == nil {
+			hiddenCols[c] = !visible
 		}
 	}
+	sg.setHidden(hiddenRows, hiddenCols)
 
-	return grid, maxCol, nil
+	return sg, nil
 }
 
-func buildResultWithIndices(grid [][]string, startRow, headerRows, actualHeaderRowIndex, actualDataStartIndex, maxCol int, sheetName string) *app.ParseExcelResult {
+func buildResultWithIndices(sg *sheetGrid, startRow, headerRows, actualHeaderRowIndex, actualDataStartIndex, maxCol int, sheetName string) *app.ParseExcelResult {
+	grid := sg.cells
+
 	// Build header using specific header row index if provided
 	header := make([]string, maxCol)
 
@@ -987,7 +944,7 @@ func buildResultWithIndices(grid [][]string, startRow, headerRows, actualHeaderR
 						if val != "" {
 							// Check if this looks like a header vs category/data
 							// Skip very long values (likely category names) but allow normal headers with spaces
-							if len(val) <= 30 {
+							if utf8.RuneCountInString(val) <= 30 {
 								headerValue = val
 								break
 							}
@@ -998,7 +955,7 @@ func buildResultWithIndices(grid [][]string, startRow, headerRows, actualHeaderR
 
 			// Dynamic header quality improvement: if we have a short/ambiguous header,
 			// look for better alternatives in the same column
-			if headerValue != "" && (len(headerValue) <= 4 || isNumericOrCurrency(headerValue)) {
+			if headerValue != "" && (utf8.RuneCountInString(headerValue) <= 4 || isNumericOrCurrency(headerValue)) {
 				bestAlternative := headerValue
 				bestScore := scoreHeaderQuality(headerValue)
 
@@ -1045,27 +1002,114 @@ func buildResultWithIndices(grid [][]string, startRow, headerRows, actualHeaderR
 		dataStart = actualDataStartIndex
 	}
 
+	// Build full header path per column from the top header row down to the data start
+	headerTop := startRow
+	if actualHeaderRowIndex >= 0 && actualDataStartIndex >= 0 {
+		headerTop = actualHeaderRowIndex
+	}
+	headerPath := make([][]string, maxCol)
+	headerCells := make([]string, maxCol)
+	sourceCols := make([]string, maxCol)
+	for c := 0; c < maxCol; c++ {
+		headerPath[c] = buildHeaderPath(sg, headerTop, dataStart, c)
+		headerCells[c] = headerCellRange(sg, headerTop, dataStart, c)
+		sourceCols[c], _ = excelize.ColumnNumberToName(sg.sourceCol(c) + 1)
+	}
+
+	var rowMerges [][]app.MergeKind
+	var values [][]app.CellValue
+	var sourceRows []int
 	for i := dataStart; i < len(grid); i++ {
 		row := make([]string, maxCol)
+		rowMerge := make([]app.MergeKind, maxCol)
+		rowValues := make([]app.CellValue, maxCol)
 		empty := true
 		for j := 0; j < maxCol && j < len(grid[i]); j++ {
 			row[j] = strings.TrimSpace(grid[i][j]) // Apply trim here too
+			rowMerge[j] = sg.merges[i][j]
+			rowValues[j] = sg.values[i][j]
 			if row[j] != "" {
 				empty = false
 			}
 		}
 		if !empty {
 			rows = append(rows, row)
+			rowMerges = append(rowMerges, rowMerge)
+			values = append(values, rowValues)
+			sourceRows = append(sourceRows, sg.sourceRow(i)+1)
 		}
 	}
 
+	hiddenCols := make([]bool, maxCol)
+	for c := range hiddenCols {
+		hiddenCols[c] = sg.isColHidden(c)
+	}
+
 	return &app.ParseExcelResult{
-		Header:    header,
-		Rows:      rows,
-		SheetName: sheetName,
+		Header:        header,
+		HeaderPath:    headerPath,
+		Rows:          rows,
+		RowMerges:     rowMerges,
+		Values:        values,
+		HiddenColumns: hiddenCols,
+		SheetName:     sheetName,
+		SourceRows:    sourceRows,
+		SourceColumns: sourceCols,
+		HeaderCells:   headerCells,
 	}
 }
 
+// buildHeaderPath collects header levels of a column from top to bottom.
+// Header group spans resolve to the group value, repeated values (vertically merged cells)
+// are collapsed, and long values between the top and the last header row are skipped as they are likely
+// category names. The last header row is the column title and is always kept
+func buildHeaderPath(sg *sheetGrid, headerTop, dataStart, col int) []string {
+	path := make([]string, 0, 2)
+
+	lastRow := min(dataStart, len(sg.cells)) - 1
+	for r := headerTop; r <= lastRow; r++ {
+		val := sg.headerValue(r, col)
+		if val == "" {
+			continue
+		}
+		if r > headerTop && r < lastRow && utf8.RuneCountInString(val) > headerPathMaxLen {
+			continue
+		}
+		if len(path) > 0 && path[len(path)-1] == val {
+			continue
+		}
+		path = append(path, val)
+	}
+
+	return path
+}
+
+// headerCellRange returns the A1 range of the source header rows of a column that hold its header values.
+// Empty if the column has no header
+func headerCellRange(sg *sheetGrid, headerTop, dataStart, col int) string {
+	first, last := -1, -1
+	for r := headerTop; r < dataStart && r < len(sg.cells); r++ {
+		if sg.headerValue(r, col) == "" {
+			continue
+		}
+		if first < 0 {
+			first = r
+		}
+		last = r
+	}
+	if first < 0 {
+		return ""
+	}
+
+	src := sg.sourceCol(col)
+	if first == last {
+		cell, _ := excelize.CoordinatesToCellName(src+1, sg.sourceRow(first)+1)
+		return cell
+	}
+
+	return cellRange(sg.sourceRow(first), src, sg.sourceRow(last), src)
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -1083,7 +1127,7 @@ func scoreHeaderQuality(header string) int {
 	score := 0
 
 	// Length scoring: prefer meaningful length headers
-	length := len(header)
+	length := utf8.RuneCountInString(header)
 	if length >= 3 && length <= 15 {
 		score += 3 // Good length range for column names
 	} else if length > 15 && length <= 30 {
@@ -1168,14 +1212,14 @@ func looksLikeColumnName(s string) bool {
 
 	// Pattern 1: Single word that's not too long
 	words := strings.Fields(s)
-	if len(words) == 1 && len(s) >= 2 && len(s) <= 12 {
+	if n := utf8.RuneCountInString(s); len(words) == 1 && n >= 2 && n <= 12 {
 		return true
 	}
 
 	// Pattern 2: Two short words (like "First Name", "Item Code")
 	if len(words) == 2 {
 		word1, word2 := words[0], words[1]
-		if len(word1) <= 8 && len(word2) <= 8 {
+		if utf8.RuneCountInString(word1) <= 8 && utf8.RuneCountInString(word2) <= 8 {
 			return true
 		}
 	}
@@ -0,0 +1,89 @@
+package excel_parser_service
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+
+	"github.com/init-pkg/nova-template/domain/app"
+	llm_client "github.com/init-pkg/nova-template/internal/clients/llm"
+	"github.com/init-pkg/nova-template/internal/config"
+)
+
+// newTestService builds a parser with an in-process cache and a fake model that finds the header
+// in the first row and accepts every table
+func newTestService(t *testing.T) (*ExcelParserService, *llm_client.FakeCompleter) {
+	t.Helper()
+
+	fake := llm_client.NewFake(map[app.LLMTask]string{
+		app.LLMTaskHeaderAnalysis:  `{"header_row_index":0,"data_start_index":1,"reasoning":"header in the first row"}`,
+		app.LLMTaskTableValidation: `{"is_product_table":true,"confidence":9,"reasoning":"products with prices"}`,
+	})
+
+	cfg := &config.Config{}
+	cfg.Internal.ExcelParser.Cache.Backend = HeaderCacheBackendMemory
+
+	return New(fake, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, cfg), fake
+}
+
+func countTasks(requests []app.CompletionRequest, task app.LLMTask) int {
+	n := 0
+	for _, req := range requests {
+		if req.Task == task {
+			n++
+		}
+	}
+
+	return n
+}
+
+func TestParseWithFakeCompleter(t *testing.T) {
+	s, fake := newTestService(t)
+	file := []byte("Код,Наименование,Цена,Остаток,Бренд\nA1,Болт,10,5,X\nA2,Гайка,20,7,Y\nA3,Шайба,3,1,Z\n")
+
+	results, err := s.parse(context.Background(), file, app.ParseOptions{}, nil)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d tables, want 1", len(results))
+	}
+	if want := []string{"Код", "Наименование", "Цена", "Остаток", "Бренд"}; !slices.Equal(results[0].Header, want) {
+		t.Errorf("header = %v, want %v", results[0].Header, want)
+	}
+	if len(results[0].Rows) != 3 {
+		t.Errorf("got %d rows, want 3", len(results[0].Rows))
+	}
+
+	requests := fake.Requests()
+	if n := countTasks(requests, app.LLMTaskHeaderAnalysis); n != 1 {
+		t.Errorf("header analysis called %d times, want 1", n)
+	}
+	if n := countTasks(requests, app.LLMTaskTableValidation); n != 1 {
+		t.Errorf("table validation called %d times, want 1", n)
+	}
+
+	// The same layout is answered from the cache
+	if _, err := s.parse(context.Background(), file, app.ParseOptions{}, nil); err != nil {
+		t.Fatalf("second parse: %v", err)
+	}
+	if n := len(fake.Requests()); n != len(requests) {
+		t.Errorf("second parse made %d model calls, want 0", n-len(requests))
+	}
+}
+
+func TestParseRejectedTable(t *testing.T) {
+	s, fake := newTestService(t)
+	fake.Respond(app.LLMTaskTableValidation, `{"is_product_table":false,"confidence":9,"reasoning":"contacts"}`)
+	file := []byte("Имя,Телефон,Почта,Город\nИван,123,a@b.ru,Москва\nПетр,456,c@d.ru,Казань\n")
+
+	results, err := s.parse(context.Background(), file, app.ParseOptions{}, nil)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("got %d tables, want none", len(results))
+	}
+}
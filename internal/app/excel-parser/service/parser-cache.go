@@ -0,0 +1,428 @@
+package excel_parser_service
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/init-pkg/nova-template/domain/app"
+	"github.com/init-pkg/nova/errs"
+	nova_ctx "github.com/init-pkg/nova/shared/ctx"
+)
+
+// cacheSchemaVersion changes when the layout of cached answers changes.
+// The unversioned schemes before it count as version 1
+const cacheSchemaVersion = 5
+
+// cacheNamespace is the prefix of all parser cache keys: excel_parser:cache:<version>:<kind>:<hash>
+const cacheNamespace = "excel_parser:cache:"
+
+// cacheSuppliersNamespace holds the set of suppliers attributed to a record: excel_parser:cache_suppliers:<version>:<kind>:<hash>.
+// Attribution only adds to the set, so hits of concurrent instances never rewrite the record
+const cacheSuppliersNamespace = "excel_parser:cache_suppliers:"
+
+// legacyCachePrefixes are keys of the unversioned schemes. They are not read anymore
+// and are removed by the stale invalidation
+var legacyCachePrefixes = []string{
+	"excel_parser:table_validation:",
+	"excel_parser:header_analysis:",
+	"excel_parser:advanced_cache:",
+}
+
+const defaultCacheListLimit = 100
+
+// cacheRecord wraps every cached answer with the data needed for inspection and invalidation
+type cacheRecord struct {
+	Kind      app.ParserCacheKind `json:"kind"`
+	Version   string              `json:"version"`
+	UpdatedAt time.Time           `json:"updated_at"`
+	Value     json.RawMessage     `json:"value"`
+}
+
+// parserCacheVersion hashes everything a cached answer depends on: the cache schema,
+// the prompt instructions, the answer schemas and the models of both tasks.
+// Changing any of them moves the parser to a new key space, old entries are left to expire
+func parserCacheVersion(llm app.StructuredCompleter) string {
+	analysisSchema, _ := json.Marshal(GPTAnalysisResponseSchema)
+	validationSchema, _ := json.Marshal(GPTTableValidationResponseSchema)
+
+	hash := md5.New()
+	for _, part := range []string{
+		fmt.Sprint(cacheSchemaVersion),
+		headerAnalysisInstructions,
+		tableValidationInstructions,
+		string(analysisSchema),
+		string(validationSchema),
+		llm.Model(app.LLMTaskHeaderAnalysis),
+		llm.Model(app.LLMTaskTableValidation),
+	} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+
+	return fmt.Sprintf("v%d-%s", cacheSchemaVersion, hex.EncodeToString(hash.Sum(nil))[:8])
+}
+
+// cacheKey builds a key of the current version
+func (this *ExcelParserService) cacheKey(kind app.ParserCacheKind, hash string) string {
+	return cacheNamespace + this.cacheVersion + ":" + string(kind) + ":" + hash
+}
+
+// parseCacheKey splits a namespaced key into its version and kind
+func parseCacheKey(key string) (version string, kind app.ParserCacheKind, ok bool) {
+	rest, found := strings.CutPrefix(key, cacheNamespace)
+	if !found {
+		return "", "", false
+	}
+
+	parts := strings.SplitN(rest, ":", 3)
+	if len(parts) != 3 || !app.ParserCacheKind(parts[1]).IsValid() {
+		return "", "", false
+	}
+
+	return parts[0], app.ParserCacheKind(parts[1]), true
+}
+
+// suppliersKey is the key of the supplier set of a record
+func suppliersKey(key string) string {
+	return cacheSuppliersNamespace + strings.TrimPrefix(key, cacheNamespace)
+}
+
+// recordKey maps a supplier set key back to the key of its record, other keys are returned as is
+func recordKey(key string) string {
+	if rest, ok := strings.CutPrefix(key, cacheSuppliersNamespace); ok {
+		return cacheNamespace + rest
+	}
+
+	return key
+}
+
+func isLegacyCacheKey(key string) bool {
+	for _, prefix := range legacyCachePrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// shortCacheKey is a log friendly key without the namespace
+func shortCacheKey(key string) string {
+	key = strings.TrimPrefix(key, cacheNamespace)
+	if len(key) > 48 {
+		return key[:48] + "..."
+	}
+
+	return key
+}
+
+// readRecord reads the record of a namespaced key. Errors are reported as a miss
+func (this *ExcelParserService) readRecord(ctx context.Context, key string) (*cacheRecord, bool, error) {
+	data, ok, err := this.cache.Get(ctx, key)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	var record cacheRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, false, fmt.Errorf("unmarshal cache record %s: %w", key, err)
+	}
+
+	return &record, true, nil
+}
+
+func (this *ExcelParserService) writeRecord(ctx context.Context, key string, record *cacheRecord, ttl time.Duration) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal cache record %s: %w", key, err)
+	}
+
+	return this.cache.Set(ctx, key, data, ttl)
+}
+
+// getCached reads a cached answer of the current version into out. A hit attributes the entry
+// to the supplier, so that purging the supplier removes answers its files relied on. Answers have a key
+// per header or layout, so a supplier is attributed only the answers its own tables were given.
+// Errors are logged and reported as a miss
+func (this *ExcelParserService) getCached(ctx context.Context, key string, supplierID uint64, out any) bool {
+	record, ok, err := this.readRecord(ctx, key)
+	if err != nil {
+		this.log.Error("Error retrieving from header cache", "error", err, "cacheKey", shortCacheKey(key))
+		return false
+	}
+	if !ok || record.Version != this.cacheVersion {
+		return false
+	}
+
+	if err := json.Unmarshal(record.Value, out); err != nil {
+		this.log.Error("Error unmarshaling cached value", "error", err, "cacheKey", shortCacheKey(key))
+		return false
+	}
+
+	this.attributeCached(ctx, key, supplierID, cacheTTL)
+	return true
+}
+
+// attributeCached adds the supplier to the supplier set of the record. Errors are logged
+func (this *ExcelParserService) attributeCached(ctx context.Context, key string, supplierID uint64, ttl time.Duration) {
+	if supplierID == 0 {
+		return
+	}
+
+	if err := this.cache.AddMembers(ctx, suppliersKey(key), ttl, strconv.FormatUint(supplierID, 10)); err != nil {
+		this.log.Warn("Error attributing cached value to supplier", "error", err, "cacheKey", shortCacheKey(key))
+	}
+}
+
+// readSuppliers reads the suppliers attributed to the record of the key
+func (this *ExcelParserService) readSuppliers(ctx context.Context, key string) ([]uint64, error) {
+	members, err := this.cache.Members(ctx, suppliersKey(key))
+	if err != nil {
+		return nil, err
+	}
+
+	var suppliers []uint64
+	for _, member := range members {
+		if id, err := strconv.ParseUint(member, 10, 64); err == nil {
+			suppliers = append(suppliers, id)
+		}
+	}
+	slices.Sort(suppliers)
+
+	return suppliers, nil
+}
+
+// setCached stores an answer of the current version. Errors are logged
+func (this *ExcelParserService) setCached(ctx context.Context, key string, kind app.ParserCacheKind, supplierID uint64, value any, ttl time.Duration) bool {
+	unlock := this.cacheLocks.lock(key)
+	defer unlock()
+
+	return this.writeCached(ctx, key, kind, supplierID, value, ttl)
+}
+
+// writeCached is setCached for a caller holding the lock of the key.
+// The supplier set is kept, suppliers of the replaced answer stay attributed
+func (this *ExcelParserService) writeCached(ctx context.Context, key string, kind app.ParserCacheKind, supplierID uint64, value any, ttl time.Duration) bool {
+	data, err := json.Marshal(value)
+	if err != nil {
+		this.log.Error("Error marshaling value for cache", "error", err, "cacheKey", shortCacheKey(key))
+		return false
+	}
+
+	record := &cacheRecord{Kind: kind, Version: this.cacheVersion, UpdatedAt: time.Now(), Value: data}
+	if err := this.writeRecord(ctx, key, record, ttl); err != nil {
+		this.log.Error("Error storing value in header cache", "error", err, "cacheKey", shortCacheKey(key))
+		return false
+	}
+
+	this.attributeCached(ctx, key, supplierID, ttl)
+	return true
+}
+
+// keyLocks are per-key mutexes of the process. Concurrent sheets and uploads update a record one at a time,
+// so that no update is lost. Other instances sharing Redis are not serialized: answers have a key per table,
+// a lost update of a shared index only costs a repeated model call
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	waiters int
+}
+
+func newKeyLocks() *keyLocks {
+	return &keyLocks{locks: make(map[string]*keyLock)}
+}
+
+// lock locks the key and returns its unlock function
+func (this *keyLocks) lock(key string) func() {
+	this.mu.Lock()
+	l, ok := this.locks[key]
+	if !ok {
+		l = &keyLock{}
+		this.locks[key] = l
+	}
+	l.waiters++
+	this.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		this.mu.Lock()
+		l.waiters--
+		if l.waiters == 0 {
+			delete(this.locks, key)
+		}
+		this.mu.Unlock()
+	}
+}
+
+func (this *ExcelParserService) entryOf(key string, record *cacheRecord, suppliers []uint64) *app.ParserCacheEntry {
+	return &app.ParserCacheEntry{
+		Key:       key,
+		Kind:      record.Kind,
+		Version:   record.Version,
+		IsCurrent: record.Version == this.cacheVersion,
+		Suppliers: suppliers,
+		UpdatedAt: record.UpdatedAt,
+	}
+}
+
+func (this *ExcelParserService) ListCacheEntries(ctx nova_ctx.Ctx, filter app.ParserCacheFilter) ([]*app.ParserCacheEntry, errs.Error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultCacheListLimit
+	}
+
+	keys, err := this.cache.Keys(ctx, cacheNamespace)
+	if err != nil {
+		return nil, errs.WrapAppError(err, &errs.ErrorOpts{Ctx: ctx})
+	}
+
+	var entries []*app.ParserCacheEntry
+	for _, key := range keys {
+		if _, kind, ok := parseCacheKey(key); !ok || (filter.Kind != "" && kind != filter.Kind) {
+			continue
+		}
+
+		record, ok, err := this.readRecord(ctx, key)
+		if err != nil {
+			this.log.Warn("Skipping unreadable cache entry", "error", err, "cacheKey", shortCacheKey(key))
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		suppliers, err := this.readSuppliers(ctx, key)
+		if err != nil {
+			this.log.Warn("Skipping cache entry with unreadable suppliers", "error", err, "cacheKey", shortCacheKey(key))
+			continue
+		}
+		if filter.SupplierID != 0 && !slices.Contains(suppliers, filter.SupplierID) {
+			continue
+		}
+
+		entries = append(entries, this.entryOf(key, record, suppliers))
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].UpdatedAt.After(entries[j].UpdatedAt)
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	return entries, nil
+}
+
+func (this *ExcelParserService) GetCacheEntry(ctx nova_ctx.Ctx, key string) (*app.ParserCacheEntry, errs.Error) {
+	if _, _, ok := parseCacheKey(key); !ok {
+		return nil, nil
+	}
+
+	record, ok, err := this.readRecord(ctx, key)
+	if err != nil {
+		return nil, errs.WrapAppError(err, &errs.ErrorOpts{Ctx: ctx})
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	suppliers, err := this.readSuppliers(ctx, key)
+	if err != nil {
+		return nil, errs.WrapAppError(err, &errs.ErrorOpts{Ctx: ctx})
+	}
+
+	entry := this.entryOf(key, record, suppliers)
+	entry.Value = record.Value
+
+	return entry, nil
+}
+
+func (this *ExcelParserService) PurgeCacheKey(ctx nova_ctx.Ctx, key string) errs.Error {
+	keys := []string{key}
+	if _, _, ok := parseCacheKey(key); ok {
+		keys = append(keys, suppliersKey(key))
+	} else if !isLegacyCacheKey(key) {
+		return errs.NewBadRequestError("not a parser cache key", &errs.ErrorOpts{Ctx: ctx})
+	}
+
+	if err := this.cache.Delete(ctx, keys...); err != nil {
+		return errs.WrapAppError(err, &errs.ErrorOpts{Ctx: ctx})
+	}
+
+	this.log.Info("Parser cache entry purged", "cacheKey", shortCacheKey(key))
+	return nil
+}
+
+func (this *ExcelParserService) PurgeCacheSupplier(ctx nova_ctx.Ctx, supplierID uint64) (int, errs.Error) {
+	if supplierID == 0 {
+		return 0, errs.NewBadRequestError("supplier id is required", &errs.ErrorOpts{Ctx: ctx})
+	}
+
+	setKeys, err := this.cache.Keys(ctx, cacheSuppliersNamespace)
+	if err != nil {
+		return 0, errs.WrapAppError(err, &errs.ErrorOpts{Ctx: ctx})
+	}
+
+	var purge []string
+	for _, setKey := range setKeys {
+		key := recordKey(setKey)
+		suppliers, err := this.readSuppliers(ctx, key)
+		if err == nil && slices.Contains(suppliers, supplierID) {
+			purge = append(purge, key, setKey)
+		}
+	}
+
+	if err := this.cache.Delete(ctx, purge...); err != nil {
+		return 0, errs.WrapAppError(err, &errs.ErrorOpts{Ctx: ctx})
+	}
+
+	this.log.Info("Parser cache purged for supplier", "supplierID", supplierID, "purged", len(purge)/2)
+	return len(purge) / 2, nil
+}
+
+func (this *ExcelParserService) InvalidateCache(ctx nova_ctx.Ctx, scope app.ParserCacheScope) (int, errs.Error) {
+	if !scope.IsValid() {
+		return 0, errs.NewBadRequestError(fmt.Sprintf("unknown cache scope %q", scope), &errs.ErrorOpts{Ctx: ctx})
+	}
+
+	// Supplier sets are removed with their records but not counted as entries
+	var purge []string
+	var purged int
+	for _, prefix := range append([]string{cacheNamespace, cacheSuppliersNamespace}, legacyCachePrefixes...) {
+		keys, err := this.cache.Keys(ctx, prefix)
+		if err != nil {
+			return 0, errs.WrapAppError(err, &errs.ErrorOpts{Ctx: ctx})
+		}
+
+		for _, key := range keys {
+			version, _, ok := parseCacheKey(recordKey(key))
+			if scope == app.ParserCacheScopeAll || !ok || version != this.cacheVersion {
+				purge = append(purge, key)
+				if prefix != cacheSuppliersNamespace {
+					purged++
+				}
+			}
+		}
+	}
+
+	if err := this.cache.Delete(ctx, purge...); err != nil {
+		return 0, errs.WrapAppError(err, &errs.ErrorOpts{Ctx: ctx})
+	}
+
+	this.log.Info("Parser cache invalidated", "scope", scope, "version", this.cacheVersion, "purged", purged)
+	return purged, nil
+}
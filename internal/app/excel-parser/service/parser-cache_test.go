@@ -0,0 +1,54 @@
+package excel_parser_service
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/init-pkg/nova-template/domain/app"
+)
+
+func TestCachedSupplierAttribution(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+	key := s.cacheKey(app.ParserCacheKindHeaderAnalysis, "hash")
+
+	if !s.setCached(ctx, key, app.ParserCacheKindHeaderAnalysis, 1, "first", cacheTTL) {
+		t.Fatal("set cached answer")
+	}
+
+	var got string
+	for _, supplierID := range []uint64{2, 2, 0} {
+		if !s.getCached(ctx, key, supplierID, &got) || got != "first" {
+			t.Fatalf("cached answer = %q, want first", got)
+		}
+	}
+
+	// A replaced answer keeps the suppliers of the previous one
+	if !s.setCached(ctx, key, app.ParserCacheKindHeaderAnalysis, 3, "second", cacheTTL) {
+		t.Fatal("replace cached answer")
+	}
+	if !s.getCached(ctx, key, 0, &got) || got != "second" {
+		t.Fatalf("cached answer = %q, want second", got)
+	}
+
+	suppliers, err := s.readSuppliers(ctx, key)
+	if err != nil {
+		t.Fatalf("read suppliers: %v", err)
+	}
+	if want := []uint64{1, 2, 3}; !slices.Equal(suppliers, want) {
+		t.Errorf("suppliers = %v, want %v", suppliers, want)
+	}
+
+	// Supplier sets are out of the record namespace
+	keys, err := s.cache.Keys(ctx, cacheNamespace)
+	if err != nil {
+		t.Fatalf("list keys: %v", err)
+	}
+	if !slices.Equal(keys, []string{key}) {
+		t.Errorf("record keys = %q, want %q", keys, key)
+	}
+	if got := recordKey(suppliersKey(key)); got != key {
+		t.Errorf("record key = %q, want %q", got, key)
+	}
+}
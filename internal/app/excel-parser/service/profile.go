@@ -0,0 +1,211 @@
+package excel_parser_service
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/init-pkg/nova-template/domain/app"
+)
+
+// Column profiling limits
+const (
+	profileSamples       = 5   // distinct sample values per column
+	profileSampleLen     = 80  // max sample length in runes
+	profileMinTypeShare  = 0.6 // min share of filled cells for a type to be the column type
+	profileCodeMaxLen    = 32  // longer tokens are text, not codes
+	profileCurrencyShare = 0.3 // min share of currency cells among numbers for a currency column
+)
+
+// profileColumns infers the type and collects value statistics of every column of the result
+func profileColumns(result *app.ParseExcelResult) []app.ColumnProfile {
+	profiles := make([]app.ColumnProfile, len(result.Header))
+	for c := range profiles {
+		profiles[c] = profileColumn(result, c)
+	}
+
+	return profiles
+}
+
+func profileColumn(result *app.ParseExcelResult, col int) app.ColumnProfile {
+	counts := make(map[app.ColumnType]int)
+	distinct := make(map[string]struct{})
+	profile := app.ColumnProfile{Type: app.ColumnTypeEmpty}
+	filled := 0
+
+	for r, row := range result.Rows {
+		if col >= len(row) || row[col] == "" {
+			continue
+		}
+		text := row[col]
+		filled++
+
+		var value app.CellValue
+		if r < len(result.Values) && col < len(result.Values[r]) {
+			value = result.Values[r][col]
+		}
+		typ := cellColumnType(value, text)
+		counts[typ]++
+
+		switch typ {
+		case app.ColumnTypeNumeric, app.ColumnTypeInteger, app.ColumnTypeCurrency:
+			if value.Type == app.CellTypeEmpty {
+				value = InferCellValue(text)
+			}
+			if profile.Min == nil || value.Number < *profile.Min {
+				profile.Min = &value.Number
+			}
+			if profile.Max == nil || value.Number > *profile.Max {
+				profile.Max = &value.Number
+			}
+		}
+
+		if _, ok := distinct[text]; ok {
+			continue
+		}
+		distinct[text] = struct{}{}
+		if len(profile.Samples) < profileSamples {
+			profile.Samples = append(profile.Samples, shortenSample(text))
+		}
+	}
+
+	if len(result.Rows) > 0 {
+		profile.FillRate = roundShare(float64(filled) / float64(len(result.Rows)))
+	}
+	profile.Distinct = len(distinct)
+	if filled > 0 {
+		profile.Type, profile.TypeShare = dominantColumnType(counts, filled)
+	}
+
+	return profile
+}
+
+// dominantColumnType picks the column type from the cell type counts. Numbers of all kinds count together:
+// a column of integers and fractions is numeric, and a column with enough currency amounts is currency
+func dominantColumnType(counts map[app.ColumnType]int, filled int) (app.ColumnType, float64) {
+	numbers := counts[app.ColumnTypeNumeric] + counts[app.ColumnTypeInteger] + counts[app.ColumnTypeCurrency]
+	if float64(numbers)/float64(filled) >= profileMinTypeShare {
+		share := roundShare(float64(numbers) / float64(filled))
+		switch {
+		case float64(counts[app.ColumnTypeCurrency])/float64(numbers) >= profileCurrencyShare:
+			return app.ColumnTypeCurrency, share
+		case counts[app.ColumnTypeInteger] == numbers:
+			return app.ColumnTypeInteger, share
+		default:
+			return app.ColumnTypeNumeric, share
+		}
+	}
+
+	best, bestCount := app.ColumnTypeText, 0
+	for _, typ := range []app.ColumnType{
+		app.ColumnTypeBarcode, app.ColumnTypeCode, app.ColumnTypeURL,
+		app.ColumnTypeDate, app.ColumnTypeBool, app.ColumnTypeText,
+	} {
+		if counts[typ] > bestCount {
+			best, bestCount = typ, counts[typ]
+		}
+	}
+	if float64(bestCount)/float64(filled) < profileMinTypeShare {
+		return app.ColumnTypeText, roundShare(float64(counts[app.ColumnTypeText]) / float64(filled))
+	}
+
+	return best, roundShare(float64(bestCount) / float64(filled))
+}
+
+// cellColumnType types one filled cell. Barcodes are checked before numbers
+// because they are usually stored as numbers
+func cellColumnType(value app.CellValue, text string) app.ColumnType {
+	if isBarcode(text) {
+		return app.ColumnTypeBarcode
+	}
+	if isURL(text) {
+		return app.ColumnTypeURL
+	}
+
+	if value.Type == app.CellTypeEmpty || value.Type == app.CellTypeString {
+		value = InferCellValue(text)
+	}
+
+	switch value.Type {
+	case app.CellTypeCurrency:
+		return app.ColumnTypeCurrency
+	case app.CellTypeInteger:
+		return app.ColumnTypeInteger
+	case app.CellTypeNumber:
+		return app.ColumnTypeNumeric
+	case app.CellTypeDate:
+		return app.ColumnTypeDate
+	case app.CellTypeBool:
+		return app.ColumnTypeBool
+	}
+
+	if isCodeLike(text) {
+		return app.ColumnTypeCode
+	}
+
+	return app.ColumnTypeText
+}
+
+// isBarcode reports whether the text is a GTIN of 8, 12, 13 or 14 digits with a valid check digit
+func isBarcode(text string) bool {
+	switch len(text) {
+	case 8, 12, 13, 14:
+	default:
+		return false
+	}
+
+	sum := 0
+	for i := len(text) - 2; i >= 0; i-- {
+		d := int(text[i] - '0')
+		if d < 0 || d > 9 {
+			return false
+		}
+		// Weights alternate 3 and 1 starting from the digit next to the check digit
+		if (len(text)-2-i)%2 == 0 {
+			d *= 3
+		}
+		sum += d
+	}
+
+	check := int(text[len(text)-1] - '0')
+	return check >= 0 && check <= 9 && (10-sum%10)%10 == check
+}
+
+func isURL(text string) bool {
+	lower := strings.ToLower(text)
+	return !strings.ContainsAny(text, " \t\n") &&
+		(strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "www."))
+}
+
+// isCodeLike reports whether the text is a single short token of letters and digits
+// with at least one digit, like article numbers "AB-1234", "X1/200" or "00123"
+func isCodeLike(text string) bool {
+	if utf8.RuneCountInString(text) > profileCodeMaxLen {
+		return false
+	}
+
+	hasDigit := false
+	for _, r := range text {
+		switch {
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsLetter(r), strings.ContainsRune("-_./#", r):
+		default:
+			return false
+		}
+	}
+
+	return hasDigit
+}
+
+func shortenSample(text string) string {
+	if utf8.RuneCountInString(text) <= profileSampleLen {
+		return text
+	}
+
+	return string([]rune(text)[:profileSampleLen]) + "..."
+}
+
+func roundShare(share float64) float64 {
+	return float64(int(share*100+0.5)) / 100
+}
@@ -0,0 +1,125 @@
+package excel_parser_service
+
+import (
+	"strings"
+
+	"github.com/init-pkg/nova-template/domain/app"
+)
+
+const reportTextLen = 120
+
+// Reasons of table decisions
+const (
+	reasonNoStartRow       = "no row with at least 3 filled cells"
+	reasonEarlyCacheReject = "not a product table by the cached validation of the first row, header analysis skipped"
+	reasonProductTable     = "product table"
+	reasonNotProductTable  = "not a product table"
+	reasonInterrupted      = "parse interrupted before the table was validated"
+	reasonTemplateReject   = "not a product table by the supplier template"
+	reasonTemplateSheet    = "every table is rejected by the supplier template"
+)
+
+// tableTrace records the decisions made for one table region into its report.
+// A nil trace records nothing, so parsing without diagnostics pays nothing for them
+type tableTrace struct {
+	sg     *sheetGrid
+	report *app.TableReport
+}
+
+// newTableTrace adds the report of a table region to the sheet report. sg is the region grid
+func newTableTrace(sheet *app.SheetReport, sg *sheetGrid, cellRange string) *tableTrace {
+	if sheet == nil {
+		return nil
+	}
+
+	report := &app.TableReport{Range: cellRange}
+	sheet.Tables = append(sheet.Tables, report)
+
+	return &tableTrace{sg: sg, report: report}
+}
+
+// row converts a row of the region grid into a 1-based sheet row
+func (this *tableTrace) row(row int) int {
+	if row < 0 {
+		return 0
+	}
+
+	return this.sg.sourceRow(row) + 1
+}
+
+// start records the table start row and scores the rows below it as header candidates
+func (this *tableTrace) start(startRow int) {
+	if this == nil {
+		return
+	}
+
+	this.report.StartRow = this.row(startRow)
+	for r := startRow; r < len(this.sg.cells) && r < startRow+heuristicHeaderCandidates; r++ {
+		score, ok := this.sg.headerRowScore(r)
+		if !ok {
+			continue
+		}
+
+		text := strings.Join(strings.Fields(strings.Join(this.sg.cells[r], " ")), " ")
+		if len([]rune(text)) > reportTextLen {
+			text = string([]rune(text)[:reportTextLen]) + "..."
+		}
+		this.report.HeaderCandidates = append(this.report.HeaderCandidates, app.HeaderCandidate{
+			Row:   this.row(r),
+			Score: float64(int(score*100)) / 100,
+			Text:  text,
+		})
+	}
+}
+
+func (this *tableTrace) cacheHit(kind app.ParserCacheKind) {
+	if this == nil {
+		return
+	}
+
+	this.report.CacheHits = append(this.report.CacheHits, kind)
+}
+
+// headerAnalysis records the chosen header. headerRow and dataStart are region grid rows, -1 if unknown
+func (this *tableTrace) headerAnalysis(source app.DecisionSource, analysis *GPTAnalysisResponse, headerRow, dataStart int) {
+	if this == nil {
+		return
+	}
+
+	report := &app.HeaderAnalysisReport{
+		Source:         source,
+		HeaderRowIndex: -1,
+		DataStartIndex: -1,
+		HeaderRow:      this.row(headerRow),
+		DataStart:      this.row(dataStart),
+	}
+	if analysis != nil {
+		report.HeaderRowIndex = analysis.HeaderRowIndex
+		report.DataStartIndex = analysis.DataStartIndex
+		report.Reasoning = analysis.Reasoning
+	}
+
+	this.report.HeaderAnalysis = report
+}
+
+func (this *tableTrace) validation(source app.DecisionSource, validation *GPTTableValidationResponse) {
+	if this == nil {
+		return
+	}
+
+	this.report.Validation = &app.ValidationReport{
+		Source:         source,
+		IsProductTable: validation.IsProductTable,
+		Confidence:     validation.Confidence,
+		Reasoning:      validation.Reasoning,
+	}
+}
+
+func (this *tableTrace) decide(kept bool, reason string) {
+	if this == nil {
+		return
+	}
+
+	this.report.Kept = kept
+	this.report.Reason = reason
+}
@@ -0,0 +1,258 @@
+package excel_parser_service
+
+import (
+	"github.com/init-pkg/nova-template/domain/app"
+	"github.com/xuri/excelize/v2"
+)
+
+// Segmentation thresholds
+const (
+	tableGapRows        = 2   // blank rows that separate independent tables
+	tableGapCols        = 2   // blank columns that separate side-by-side tables
+	tableLayoutOverlap  = 0.6 // min column overlap of blocks separated by a single blank row to stay in one table
+	tableMinHeaderCells = 2   // min non-empty cells of a row that starts a new table
+)
+
+// tableRegion is a rectangular table block of a sheet grid with 0-based inclusive coordinates
+type tableRegion struct {
+	startRow, startCol int
+	endRow, endCol     int
+}
+
+// cellRange returns the region in A1 notation of the source sheet, e.g. "A5:H120"
+func (this *sheetGrid) cellRange(region tableRegion) string {
+	return cellRange(
+		this.sourceRow(region.startRow), this.sourceCol(region.startCol),
+		this.sourceRow(region.endRow), this.sourceCol(region.endCol),
+	)
+}
+
+// cellRange formats 0-based inclusive coordinates in A1 notation
+func cellRange(startRow, startCol, endRow, endCol int) string {
+	start, err := excelize.CoordinatesToCellName(startCol+1, startRow+1)
+	if err != nil {
+		return ""
+	}
+	end, err := excelize.CoordinatesToCellName(endCol+1, endRow+1)
+	if err != nil {
+		return ""
+	}
+
+	return start + ":" + end
+}
+
+func (this tableRegion) colOverlap(other tableRegion) float64 {
+	lo := max(this.startCol, other.startCol)
+	hi := min(this.endCol, other.endCol)
+	if hi < lo {
+		return 0
+	}
+
+	union := max(this.endCol, other.endCol) - min(this.startCol, other.startCol) + 1
+	return float64(hi-lo+1) / float64(union)
+}
+
+// subGrid copies the region into a standalone grid so the table pipeline can run on it unchanged
+func (this *sheetGrid) subGrid(region tableRegion) *sheetGrid {
+	width := region.endCol - region.startCol + 1
+	sub := &sheetGrid{
+		cells:  make([][]string, 0, region.endRow-region.startRow+1),
+		merges: make([][]app.MergeKind, 0, region.endRow-region.startRow+1),
+		values: make([][]app.CellValue, 0, region.endRow-region.startRow+1),
+		groups: make(map[gridPos]string),
+		maxCol: width,
+	}
+
+	for r := region.startRow; r <= region.endRow && r < len(this.cells); r++ {
+		sub.cells = append(sub.cells, append([]string(nil), this.cells[r][region.startCol:region.startCol+width]...))
+		sub.merges = append(sub.merges, append([]app.MergeKind(nil), this.merges[r][region.startCol:region.startCol+width]...))
+		sub.values = append(sub.values, append([]app.CellValue(nil), this.values[r][region.startCol:region.startCol+width]...))
+	}
+
+	sub.srcRows = make([]int, len(sub.cells))
+	for i := range sub.srcRows {
+		sub.srcRows[i] = this.sourceRow(region.startRow + i)
+	}
+	sub.srcCols = make([]int, width)
+	for i := range sub.srcCols {
+		sub.srcCols[i] = this.sourceCol(region.startCol + i)
+	}
+
+	if this.hiddenRows != nil || this.hiddenCols != nil {
+		rows := make([]bool, len(sub.cells))
+		for i := range rows {
+			rows[i] = this.isRowHidden(region.startRow + i)
+		}
+		cols := make([]bool, width)
+		for i := range cols {
+			cols[i] = this.isColHidden(region.startCol + i)
+		}
+		sub.setHidden(rows, cols)
+	}
+
+	for pos, val := range this.groups {
+		if pos.row >= region.startRow && pos.row <= region.endRow && pos.col >= region.startCol && pos.col <= region.endCol {
+			sub.groups[gridPos{pos.row - region.startRow, pos.col - region.startCol}] = val
+		}
+	}
+
+	return sub
+}
+
+func (this *sheetGrid) isBlank(row, startCol, endCol int) bool {
+	for c := startCol; c <= endCol && c < this.maxCol; c++ {
+		if this.cells[row][c] != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// detectTableRegions finds rectangular table regions in the grid.
+// The sheet is first split into row blocks by runs of blank rows, each block into column bands
+// by runs of blank columns, and each band into stacked tables where a single blank row is followed
+// by a header-like row with a different column layout.
+// Blocks that do not start with a header (category groups, continuation) stay in the previous table
+func detectTableRegions(sg *sheetGrid) []tableRegion {
+	var regions []tableRegion
+	for _, rows := range sg.rowBlocks() {
+		for _, band := range sg.columnBands(rows[0], rows[1]) {
+			regions = append(regions, sg.rowRegions(rows[0], rows[1], band[0], band[1])...)
+		}
+	}
+
+	return regions
+}
+
+// rowBlocks splits rows into blocks separated by at least tableGapRows blank rows
+func (this *sheetGrid) rowBlocks() [][2]int {
+	return splitByGaps(len(this.cells), tableGapRows, func(r int) bool {
+		return this.isBlank(r, 0, this.maxCol-1)
+	})
+}
+
+// columnBands splits columns of the row block into bands separated by at least tableGapCols blank columns
+func (this *sheetGrid) columnBands(startRow, endRow int) [][2]int {
+	return splitByGaps(this.maxCol, tableGapCols, func(c int) bool {
+		for r := startRow; r <= endRow; r++ {
+			if this.cells[r][c] != "" {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// splitByGaps returns inclusive [start, end] spans of non-blank lines separated by at least minGap blank lines
+func splitByGaps(count, minGap int, isBlank func(int) bool) [][2]int {
+	var spans [][2]int
+	start, gap := -1, 0
+	for i := 0; i < count; i++ {
+		if isBlank(i) {
+			gap++
+			if start >= 0 && gap >= minGap {
+				spans = append(spans, [2]int{start, i - gap})
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+		gap = 0
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, count - 1 - gap})
+	}
+
+	return spans
+}
+
+// rowRegions splits a column band of the row block into stacked table regions
+func (this *sheetGrid) rowRegions(startRow, endRow, bandStart, bandEnd int) []tableRegion {
+	type block struct {
+		region    tableRegion
+		gapBefore int
+	}
+
+	// Blocks of consecutive non-blank rows with the blank row count before each
+	var blocks []block
+	gap := 0
+	for r := startRow; r <= endRow; r++ {
+		if this.isBlank(r, bandStart, bandEnd) {
+			gap++
+			continue
+		}
+
+		minCol, maxCol := this.rowExtent(r, bandStart, bandEnd)
+		if len(blocks) == 0 || gap > 0 {
+			blocks = append(blocks, block{region: tableRegion{r, minCol, r, maxCol}, gapBefore: gap})
+		} else {
+			last := &blocks[len(blocks)-1].region
+			last.endRow = r
+			last.startCol = min(last.startCol, minCol)
+			last.endCol = max(last.endCol, maxCol)
+		}
+		gap = 0
+	}
+
+	var regions []tableRegion
+	for _, b := range blocks {
+		if len(regions) == 0 {
+			regions = append(regions, b.region)
+			continue
+		}
+
+		last := &regions[len(regions)-1]
+		startsTable := this.isHeaderLikeRow(b.region.startRow, bandStart, bandEnd) &&
+			(b.gapBefore >= tableGapRows || last.colOverlap(b.region) < tableLayoutOverlap)
+
+		if startsTable {
+			regions = append(regions, b.region)
+			continue
+		}
+
+		last.endRow = b.region.endRow
+		last.startCol = min(last.startCol, b.region.startCol)
+		last.endCol = max(last.endCol, b.region.endCol)
+	}
+
+	return regions
+}
+
+func (this *sheetGrid) rowExtent(row, startCol, endCol int) (int, int) {
+	lo, hi := -1, -1
+	for c := startCol; c <= endCol && c < this.maxCol; c++ {
+		if this.cells[row][c] == "" {
+			continue
+		}
+		if lo < 0 {
+			lo = c
+		}
+		hi = c
+	}
+
+	return lo, hi
+}
+
+// isHeaderLikeRow reports whether the row looks like column headers:
+// several non-empty cells, no numeric values and mostly column-name-like texts
+func (this *sheetGrid) isHeaderLikeRow(row, startCol, endCol int) bool {
+	nonEmpty, columnNames := 0, 0
+	for c := startCol; c <= endCol && c < this.maxCol; c++ {
+		val := this.headerValue(row, c)
+		if val == "" {
+			continue
+		}
+		if isNumericOrCurrency(val) {
+			return false
+		}
+		nonEmpty++
+		if looksLikeColumnName(val) {
+			columnNames++
+		}
+	}
+
+	return nonEmpty >= tableMinHeaderCells && columnNames*2 >= nonEmpty
+}
@@ -0,0 +1,609 @@
+package excel_parser_service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/init-pkg/nova-template/domain/app"
+	"github.com/init-pkg/nova/errs"
+	nova_ctx "github.com/init-pkg/nova/shared/ctx"
+	"github.com/xuri/excelize/v2"
+)
+
+// streamHeadRows is the number of leading rows of a sheet kept in memory for table and header detection
+const streamHeadRows = 200
+
+// sheetRow is one row of a sheet read by a sheetRowSource
+type sheetRow struct {
+	index    int // source sheet row
+	isHidden bool
+	cells    []string
+	merges   []app.MergeKind
+	values   []app.CellValue
+	formulas []*formulaCell // evaluated formula cells of the row without cached results
+}
+
+// sheetRowSource reads a sheet row by row: the head as a grid for table detection, then the remaining rows.
+// next returns nil after the last row
+type sheetRowSource interface {
+	head(rows int) (*sheetGrid, error)
+	next() (*sheetRow, error)
+}
+
+// xlsxRowSource reads rows with the excelize iterator without loading the worksheet.
+// Merged cells and cell types are not available this way, so rows have no merge metadata
+// and values are typed by their text.
+// Formulas without cached values are not evaluated, as the calculation engine loads the worksheet:
+// the cells are left empty and reported as failed formulas
+type xlsxRowSource struct {
+	sheet      string
+	rows       *excelize.Rows
+	policy     MergePolicy
+	opts       app.ParseOptions
+	hiddenCols []bool                 // source columns hidden in the sheet
+	formulas   map[int][]*formulaCell // formula cells without cached results by source row
+	index      int                    // source row of the next row
+}
+
+func (this *xlsxRowSource) head(rows int) (*sheetGrid, error) {
+	var head [][]string
+	var values [][]app.CellValue
+	var srcRows []int
+	var hiddenRows []bool
+	var formulas []*formulaCell
+	for len(head) < rows {
+		row, err := this.next()
+		if err != nil {
+			return nil, err
+		}
+		if row == nil {
+			break
+		}
+		head = append(head, row.cells)
+		values = append(values, row.values)
+		srcRows = append(srcRows, row.index)
+		hiddenRows = append(hiddenRows, row.isHidden)
+		formulas = append(formulas, row.formulas...)
+	}
+
+	sg := newSheetGrid(head, values, nil, this.policy)
+	sg.formulas = formulas
+	var hiddenCols []bool
+	sg.srcRows = srcRows
+	for c := 0; len(sg.srcCols) < sg.maxCol; c++ {
+		isHidden := c < len(this.hiddenCols) && this.hiddenCols[c]
+		if this.opts.KeepHiddenColumns || !isHidden {
+			sg.srcCols = append(sg.srcCols, c)
+			hiddenCols = append(hiddenCols, isHidden)
+		}
+	}
+	sg.setHidden(hiddenRows, hiddenCols)
+
+	return sg, nil
+}
+
+func (this *xlsxRowSource) next() (*sheetRow, error) {
+	for this.rows.Next() {
+		index := this.index
+		this.index++
+
+		isHidden := this.rows.GetRowOpts().Hidden
+		if isHidden && !this.opts.KeepHiddenRows {
+			continue
+		}
+
+		cells, err := this.rows.Columns()
+		if err != nil {
+			return nil, err
+		}
+
+		var formulas []*formulaCell
+		for _, cell := range this.formulas[index] {
+			isHidden := cell.col < len(this.hiddenCols) && this.hiddenCols[cell.col]
+			if isHidden && !this.opts.KeepHiddenColumns {
+				continue
+			}
+
+			cell.err = errFormulaNotStreamed
+			formulas = append(formulas, cell)
+		}
+
+		if !this.opts.KeepHiddenColumns {
+			cells = this.visibleCells(cells)
+		}
+
+		values := make([]app.CellValue, len(cells))
+		for i, cell := range cells {
+			values[i] = InferCellValue(cell)
+		}
+
+		return &sheetRow{index: index, cells: cells, values: values, isHidden: isHidden, formulas: formulas}, nil
+	}
+
+	return nil, this.rows.Error()
+}
+
+func (this *xlsxRowSource) visibleCells(cells []string) []string {
+	visible := cells[:0:0]
+	for c, cell := range cells {
+		if c >= len(this.hiddenCols) || !this.hiddenCols[c] {
+			visible = append(visible, cell)
+		}
+	}
+
+	return visible
+}
+
+// readXlsxHiddenColumns reads column visibility of an xlsx sheet from the cols element
+// that precedes sheet data, without loading the worksheet
+func readXlsxHiddenColumns(file []byte, sheet string) ([]bool, error) {
+	rc, err := openXlsxWorksheet(file, sheet)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var hidden []bool
+	decoder := xml.NewDecoder(rc)
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		el, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if el.Name.Local == "sheetData" {
+			break
+		}
+		if el.Name.Local != "col" || !(odsAttr(el, "hidden") == "1" || odsAttr(el, "hidden") == "true") {
+			continue
+		}
+
+		// Last col element may cover all columns up to XFD, only columns with data matter
+		last := min(odsAttrInt(el, "max", 0), excelize.MaxColumns)
+		for c := odsAttrInt(el, "min", 1); c <= last; c++ {
+			for len(hidden) < c {
+				hidden = append(hidden, false)
+			}
+			hidden[c-1] = true
+		}
+	}
+
+	return hidden, nil
+}
+
+// openXlsxWorksheet opens the raw XML part of an xlsx sheet
+func openXlsxWorksheet(file []byte, sheet string) (io.ReadCloser, error) {
+	zr, err := zip.NewReader(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]*zip.File, len(zr.File))
+	for _, entry := range zr.File {
+		entries[entry.Name] = entry
+	}
+
+	// Sheet name -> relationship id -> worksheet part
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodeZipXML(entries["xl/workbook.xml"], &workbook); err != nil {
+		return nil, err
+	}
+	if err := decodeZipXML(entries["xl/_rels/workbook.xml.rels"], &rels); err != nil {
+		return nil, err
+	}
+
+	var part string
+	for _, s := range workbook.Sheets {
+		if s.Name != sheet {
+			continue
+		}
+		for _, rel := range rels.Relationships {
+			if rel.ID == s.ID {
+				part = strings.TrimPrefix(rel.Target, "/")
+				if !strings.HasPrefix(part, "xl/") {
+					part = "xl/" + part
+				}
+			}
+		}
+	}
+	entry := entries[part]
+	if entry == nil {
+		return nil, fmt.Errorf("xlsx: worksheet part of %q not found", sheet)
+	}
+
+	return entry.Open()
+}
+
+func decodeZipXML(entry *zip.File, v any) error {
+	if entry == nil {
+		return errors.New("xlsx: part not found")
+	}
+
+	data, err := readZipEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	return xml.Unmarshal(data, v)
+}
+
+// gridRowSource streams a sheet that was already read whole, for formats without a row iterator
+type gridRowSource struct {
+	grid *sheetGrid
+	pos  int
+}
+
+func (this *gridRowSource) head(rows int) (*sheetGrid, error) {
+	this.pos = min(rows, len(this.grid.cells))
+	if this.pos == 0 || this.grid.maxCol == 0 {
+		return &sheetGrid{groups: make(map[gridPos]string)}, nil
+	}
+
+	return this.grid.subGrid(tableRegion{0, 0, this.pos - 1, this.grid.maxCol - 1}), nil
+}
+
+func (this *gridRowSource) next() (*sheetRow, error) {
+	if this.pos >= len(this.grid.cells) {
+		return nil, nil
+	}
+
+	this.pos++
+	return &sheetRow{
+		index:  this.grid.sourceRow(this.pos - 1),
+		cells:  this.grid.cells[this.pos-1],
+		merges: this.grid.merges[this.pos-1],
+		values: this.grid.values[this.pos-1],
+	}, nil
+}
+
+// streamTable is a table detected on the sheet head whose rows are being streamed
+type streamTable struct {
+	table      *app.ParseExcelResult
+	region     tableRegion
+	categories *categoryTracker[*sheetRow]
+	startRow   int // source sheet coordinates of the table range
+	startCol   int
+	endRow     int
+	endCol     int
+	blankRows  int // blank rows of the table columns since its last row
+}
+
+// reachesHeadEnd reports whether the region i runs to the end of the head: it is followed by fewer blank rows
+// than a table gap and no other region starts below it in its columns
+func reachesHeadEnd(head *sheetGrid, regions []tableRegion, i int) bool {
+	region := regions[i]
+	if len(head.cells)-1-region.endRow >= tableGapRows {
+		return false
+	}
+	for j, other := range regions {
+		if j != i && other.startRow > region.endRow && other.startCol <= region.endCol && region.startCol <= other.endCol {
+			return false
+		}
+	}
+
+	return true
+}
+
+// cut takes the table columns of a sheet row. Returns nil if they are empty
+func (this *streamTable) cut(row *sheetRow) *sheetRow {
+	width := this.region.endCol - this.region.startCol + 1
+	res := &sheetRow{
+		index:  row.index,
+		cells:  make([]string, width),
+		merges: make([]app.MergeKind, width),
+		values: make([]app.CellValue, width),
+	}
+	empty := true
+
+	for c := 0; c < width; c++ {
+		col := this.region.startCol + c
+		if col < len(row.cells) {
+			res.cells[c] = strings.TrimSpace(row.cells[col])
+		}
+		if col < len(row.merges) {
+			res.merges[c] = row.merges[col]
+		}
+		if col < len(row.values) {
+			res.values[c] = row.values[col]
+		}
+		if res.cells[c] != "" {
+			empty = false
+		}
+	}
+
+	if empty {
+		return nil
+	}
+
+	return res
+}
+
+// addFormulas reports evaluated formula cells of a streamed row that are within the table columns
+func (this *streamTable) addFormulas(cells []*formulaCell) {
+	for _, cell := range cells {
+		if cell.col < this.startCol || cell.col > this.endCol {
+			continue
+		}
+		if cell.err != nil {
+			this.table.FailedFormulas = append(this.table.FailedFormulas, cell.report())
+		} else {
+			this.table.ComputedCells = append(this.table.ComputedCells, cell.report())
+		}
+	}
+}
+
+// emit passes the data rows decided by the row to consume and returns their count.
+// Rows that may be categories are held until a following row decides
+func (this *streamTable) emit(row *sheetRow, consume func(*app.ParseStreamRow) error) (int, error) {
+	return this.pass(this.categories.next(row.cells, row.merges, row), consume)
+}
+
+// finish passes the rows still held at the end of the table
+func (this *streamTable) finish(consume func(*app.ParseStreamRow) error) (int, error) {
+	return this.pass(this.categories.flush(), consume)
+}
+
+func (this *streamTable) pass(rows []categorizedRow[*sheetRow], consume func(*app.ParseStreamRow) error) (int, error) {
+	for i, r := range rows {
+		err := consume(&app.ParseStreamRow{
+			Table:        this.table,
+			Cells:        r.ref.cells,
+			Merges:       r.ref.merges,
+			Values:       r.ref.values,
+			CategoryPath: r.levels,
+			SourceRow:    r.ref.index + 1,
+		})
+		if err != nil {
+			return i, err
+		}
+	}
+
+	return len(rows), nil
+}
+
+func (this *ExcelParserService) ParseStream(ctx nova_ctx.Ctx, file []byte, opts app.ParseOptions, consume func(row *app.ParseStreamRow) error) errs.Error {
+	parseCtx, cancel := context.WithTimeout(ctx, this.timeouts.parse)
+	defer cancel()
+
+	if err := this.parseStream(parseCtx, file, opts, consume); err != nil {
+		return errs.WrapAppError(err, &errs.ErrorOpts{Ctx: ctx})
+	}
+
+	return nil
+}
+
+func (this *ExcelParserService) parseStream(ctx context.Context, file []byte, opts app.ParseOptions, consume func(*app.ParseStreamRow) error) error {
+	this.log.Info("Excel stream parsing started")
+	template := this.loadTemplate(ctx, opts.SupplierID)
+
+	var format = detectWorkbookFormat(file)
+	if format != workbookFormatXlsx {
+		// Legacy and text formats have no row iterator: sheets are read whole and rows are streamed from the grid
+		sheets, err := this.readWorkbook(file)
+		if err != nil {
+			return err
+		}
+
+		for _, ws := range sheets {
+			if ws.grid == nil || (ws.isHidden && !opts.KeepHiddenSheets) {
+				continue
+			}
+			if err := this.streamSheet(ctx, ws.name, &gridRowSource{grid: ws.grid.withoutHidden(opts)}, opts, sheetTemplate(template, ws.name), consume); err != nil {
+				return err
+			}
+		}
+
+		this.log.Info("Excel stream parsing completed successfully", "sheetsProcessed", len(sheets))
+		return nil
+	}
+
+	this.log.Info("Workbook format detected", "format", format)
+
+	f, err := excelize.OpenReader(bytes.NewReader(file))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var sheets = f.GetSheetList()
+	for _, sheet := range sheets {
+		if visible, err := f.GetSheetVisible(sheet); err == nil && !visible && !opts.KeepHiddenSheets {
+			this.log.Info("Skipping hidden sheet", "sheet", sheet)
+			continue
+		}
+
+		hiddenCols, err := readXlsxHiddenColumns(file, sheet)
+		if err != nil {
+			this.log.Error("failed to read hidden columns", "sheet", sheet, "error", err)
+		}
+
+		formulas, err := readXlsxFormulaCells(file, sheet)
+		if err != nil {
+			this.log.Error("failed to read formula cells", "sheet", sheet, "error", err)
+		}
+
+		rows, err := f.Rows(sheet)
+		if err != nil {
+			this.log.Error("failed to open sheet rows", "sheet", sheet, "error", err)
+			continue
+		}
+
+		source := &xlsxRowSource{
+			sheet:      sheet,
+			rows:       rows,
+			policy:     this.mergePolicy,
+			opts:       opts,
+			hiddenCols: hiddenCols,
+			formulas:   make(map[int][]*formulaCell),
+		}
+		for _, cell := range formulas {
+			source.formulas[cell.row] = append(source.formulas[cell.row], cell)
+		}
+		err = this.streamSheet(ctx, sheet, source, opts, sheetTemplate(template, sheet), consume)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	this.log.Info("Excel stream parsing completed successfully", "sheetsProcessed", len(sheets))
+	return nil
+}
+
+// streamSheet detects tables on the sheet head and streams their data rows.
+// Tables at the bottom of the head continue with the remaining rows of the sheet.
+// Tables matching the sheet template tmpl are decided by it
+func (this *ExcelParserService) streamSheet(ctx context.Context, sheet string, source sheetRowSource, opts app.ParseOptions, tmpl *app.SheetTemplate, consume func(*app.ParseStreamRow) error) error {
+	head, err := source.head(streamHeadRows)
+	if err != nil {
+		return err
+	}
+	if len(head.cells) == 0 {
+		return nil
+	}
+
+	var tables, open []*streamTable
+	regions := detectTableRegions(head)
+	for r, region := range regions {
+		result, _ := this.parseTable(ctx, sheet, head.subGrid(region), opts, tmpl, nil)
+		if err := interrupted(ctx); err != nil {
+			return err
+		}
+		if result == nil {
+			continue
+		}
+
+		t := &streamTable{
+			table: &app.ParseExcelResult{
+				Header:        result.Header,
+				HeaderPath:    result.HeaderPath,
+				HiddenColumns: result.HiddenColumns,
+				SourceColumns: result.SourceColumns,
+				HeaderCells:   result.HeaderCells,
+				Profiles:      profileColumns(result),
+				Layout:        result.Layout,
+				ColumnMapping: result.ColumnMapping,
+				SheetName:     sheet,
+				Range:         head.cellRange(region),
+			},
+			region:     region,
+			categories: newCategoryTracker[*sheetRow](firstFilledCol(result.Rows)),
+			startRow:   head.sourceRow(region.startRow),
+			startCol:   head.sourceCol(region.startCol),
+			endRow:     head.sourceRow(region.endRow),
+			endCol:     head.sourceCol(region.endCol),
+			blankRows:  len(head.cells) - 1 - region.endRow,
+		}
+		t.table.ComputedCells, t.table.FailedFormulas = head.formulaReport(region)
+		tables = append(tables, t)
+		// Only a table running to the end of a cut off head continues below it
+		isOpen := len(head.cells) >= streamHeadRows && reachesHeadEnd(head, regions, r)
+		if isOpen {
+			open = append(open, t)
+		}
+
+		for i, cells := range result.Rows {
+			row := &sheetRow{cells: cells}
+			if i < len(result.SourceRows) {
+				row.index = result.SourceRows[i] - 1
+			}
+			if i < len(result.RowMerges) {
+				row.merges = result.RowMerges[i]
+			}
+			if i < len(result.Values) {
+				row.values = result.Values[i]
+			}
+			if _, err := t.emit(row, consume); err != nil {
+				return err
+			}
+		}
+		if !isOpen {
+			if _, err := t.finish(consume); err != nil {
+				return err
+			}
+		}
+	}
+	if len(open) == 0 {
+		return nil
+	}
+
+	streamed := 0
+	for len(open) > 0 {
+		if err := interrupted(ctx); err != nil {
+			return err
+		}
+
+		sourceRow, err := source.next()
+		if err != nil {
+			return err
+		}
+		if sourceRow == nil {
+			break
+		}
+
+		remaining := open[:0]
+		for _, t := range open {
+			row := t.cut(sourceRow)
+			if row == nil {
+				// A gap of blank rows ends the table like it separates tables on the head
+				t.blankRows++
+				if t.blankRows < tableGapRows {
+					remaining = append(remaining, t)
+					continue
+				}
+				n, err := t.finish(consume)
+				if err != nil {
+					return err
+				}
+				streamed += n
+				continue
+			}
+
+			t.blankRows = 0
+			t.endRow = sourceRow.index
+			t.table.Range = cellRange(t.startRow, t.startCol, t.endRow, t.endCol)
+			t.addFormulas(sourceRow.formulas)
+			n, err := t.emit(row, consume)
+			if err != nil {
+				return err
+			}
+			streamed += n
+			remaining = append(remaining, t)
+		}
+		open = remaining
+	}
+	for _, t := range open {
+		n, err := t.finish(consume)
+		if err != nil {
+			return err
+		}
+		streamed += n
+	}
+
+	this.log.Info("Sheet streamed", "sheet", sheet, "tables", len(tables), "rowsAfterHead", streamed)
+	return nil
+}
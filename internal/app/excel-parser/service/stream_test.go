@@ -0,0 +1,119 @@
+package excel_parser_service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/init-pkg/nova-template/domain/app"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestParseStreamStopsAtTableEnd(t *testing.T) {
+	s, _ := newTestService(t)
+
+	var b strings.Builder
+	b.WriteString("Код,Наименование,Цена,Остаток,Бренд\n")
+	for i := 1; i <= 60; i++ {
+		fmt.Fprintf(&b, "A%d,Товар %d,%d,%d,X\n", i, i, i*10, i)
+	}
+	// Notes below the table run past the streamed head
+	b.WriteString(",,,,\n,,,,\n")
+	for i := 1; i <= streamHeadRows; i++ {
+		fmt.Fprintf(&b, "Примечание %d,,,,\n", i)
+	}
+
+	var rows []*app.ParseStreamRow
+	err := s.parseStream(context.Background(), []byte(b.String()), app.ParseOptions{}, func(row *app.ParseStreamRow) error {
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("parse stream: %v", err)
+	}
+	if len(rows) != 60 {
+		t.Fatalf("streamed %d rows, want 60", len(rows))
+	}
+	if last := rows[len(rows)-1]; last.SourceRow != 61 || last.Table.Range != "A1:E61" {
+		t.Errorf("last row %d of range %s, want 61 of A1:E61", last.SourceRow, last.Table.Range)
+	}
+}
+
+func TestParseStreamContinuesPastHead(t *testing.T) {
+	s, _ := newTestService(t)
+
+	var b strings.Builder
+	b.WriteString("Код,Наименование,Цена,Остаток,Бренд\n")
+	for i := 1; i <= 300; i++ {
+		fmt.Fprintf(&b, "A%d,Товар %d,%d,%d,X\n", i, i, i*10, i)
+	}
+
+	var rows []*app.ParseStreamRow
+	err := s.parseStream(context.Background(), []byte(b.String()), app.ParseOptions{}, func(row *app.ParseStreamRow) error {
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("parse stream: %v", err)
+	}
+	if len(rows) != 300 {
+		t.Fatalf("streamed %d rows, want 300", len(rows))
+	}
+	if got := rows[len(rows)-1].Table.Range; got != "A1:E301" {
+		t.Errorf("range = %s, want A1:E301", got)
+	}
+}
+
+func TestParseStreamReportsFormulasWithEmptyCachedValue(t *testing.T) {
+	f := excelize.NewFile()
+	defer f.Close()
+	rows := [][]any{
+		{"Код", "Наименование", "Цена", "Количество", "Сумма"},
+		{"A1", "Болт", 10, 3},
+		{"A2", "Гайка", 20, 2},
+	}
+	for r, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, r+1)
+		if err := f.SetSheetRow("Sheet1", cell, &row); err != nil {
+			t.Fatalf("set row: %v", err)
+		}
+	}
+	for r := 2; r <= len(rows); r++ {
+		if err := f.SetCellFormula("Sheet1", fmt.Sprintf("E%d", r), fmt.Sprintf("C%d*D%d", r, r)); err != nil {
+			t.Fatalf("set formula: %v", err)
+		}
+	}
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		t.Fatalf("write xlsx: %v", err)
+	}
+
+	s, _ := newTestService(t)
+	var streamed []*app.ParseStreamRow
+	err = s.parseStream(context.Background(), withEmptyCachedValues(t, buf.Bytes()), app.ParseOptions{}, func(row *app.ParseStreamRow) error {
+		streamed = append(streamed, row)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("parse stream: %v", err)
+	}
+	if len(streamed) != 2 {
+		t.Fatalf("streamed %d rows, want 2", len(streamed))
+	}
+	for i, row := range streamed {
+		if len(row.Cells) != 5 || row.Cells[4] != "" {
+			t.Errorf("row %d = %q, want an empty sum", i, row.Cells)
+		}
+	}
+
+	failed := streamed[len(streamed)-1].Table.FailedFormulas
+	if len(failed) != 2 {
+		t.Fatalf("got %d failed formulas, want 2", len(failed))
+	}
+	for i, want := range []string{"C2*D2", "C3*D3"} {
+		if failed[i].Formula != want || failed[i].Error != errFormulaNotStreamed.Error() {
+			t.Errorf("failed formula %d = %+v, want %s not evaluated", i, failed[i], want)
+		}
+	}
+}
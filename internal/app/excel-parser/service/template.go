@@ -0,0 +1,333 @@
+package excel_parser_service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/init-pkg/nova-template/domain/app"
+	app_redis "github.com/init-pkg/nova-template/internal/infra/redis/client"
+	"github.com/init-pkg/nova/errs"
+	nova_ctx "github.com/init-pkg/nova/shared/ctx"
+)
+
+// templateSchemaVersion changes when the layout fingerprint or the stored decisions change
+const templateSchemaVersion = 2
+
+// templateNamespace is the prefix of supplier template keys: excel_parser:template:<supplier id>.
+// Templates are not model answers of a version, cache invalidation leaves them alone
+const templateNamespace = "excel_parser:template:"
+
+// templateTTL keeps templates until they are deleted
+const templateTTL = 0
+
+// templateStoreOf keeps supplier templates in Redis whatever the parse cache backend is: a template is used
+// for every upload of the supplier and must survive restarts and cache eviction. Without Redis no template is kept
+func templateStoreOf(redisClient *app_redis.Client) HeaderCache {
+	if redisClient == nil {
+		return nil
+	}
+
+	return NewRedisHeaderCache(redisClient)
+}
+
+func templateKey(supplierID uint64) string {
+	return templateNamespace + strconv.FormatUint(supplierID, 10)
+}
+
+// matchTableTemplate finds the template table whose layout is the closest to the table at startRow.
+// Every template table is tried with its own header rows. Returns a copy with the layout of the table,
+// so that the template follows small changes of the format, nil if no layout is similar enough
+func matchTableTemplate(tmpl *app.SheetTemplate, sg *sheetGrid, sheet string, startRow int, minSimilarity float64) *app.TableTemplate {
+	if tmpl == nil {
+		return nil
+	}
+
+	var best *app.TableTemplate
+	bestScore := minSimilarity
+	for _, table := range tmpl.Tables {
+		layout := layoutAt(sg, sheet, startRow, table.HeaderRows, templateRow(startRow, table.HeaderRow), templateRow(startRow, table.DataStart))
+		if score := layoutSimilarity(layout, table.Fingerprint); score >= bestScore {
+			matched := *table
+			matched.Fingerprint, matched.Layout = layout, layoutKey(layout)
+			best, bestScore = &matched, score
+		}
+	}
+
+	return best
+}
+
+// closestTable finds the table of the sheet template with the most similar layout, nil if none is similar enough
+func closestTable(tmpl *app.SheetTemplate, layout *app.LayoutFingerprint, minSimilarity float64) *app.TableTemplate {
+	if tmpl == nil {
+		return nil
+	}
+
+	var best *app.TableTemplate
+	bestScore := minSimilarity
+	for _, table := range tmpl.Tables {
+		if score := layoutSimilarity(layout, table.Fingerprint); score >= bestScore {
+			best, bestScore = table, score
+		}
+	}
+
+	return best
+}
+
+// newTableTemplate records a reusable table decision for the layout. headerRow and dataStart are region grid rows,
+// -1 if unknown
+func newTableTemplate(layout *app.LayoutFingerprint, startRow, headerRows, headerRow, dataStart int, isProductTable bool) *app.TableTemplate {
+	table := &app.TableTemplate{
+		Fingerprint:    layout,
+		HeaderRows:     headerRows,
+		HeaderRow:      templateOffset(startRow, headerRow),
+		DataStart:      templateOffset(startRow, dataStart),
+		IsProductTable: isProductTable,
+	}
+	table.Layout = layoutKey(table.Fingerprint)
+
+	return table
+}
+
+// templateOffset converts a grid row into an offset from the start row and back, keeping -1
+func templateOffset(startRow, row int) int {
+	if row < 0 {
+		return -1
+	}
+
+	return row - startRow
+}
+
+func templateRow(startRow, offset int) int {
+	if offset < 0 {
+		return -1
+	}
+
+	return startRow + offset
+}
+
+// parseTableFromTemplate builds a table with the header and data start of a supplier template, without the model.
+// Returns nil if the template rejects the table
+func (this *ExcelParserService) parseTableFromTemplate(sheet string, sg *sheetGrid, startRow int, table *app.TableTemplate, trace *tableTrace) *app.ParseExcelResult {
+	headerRow, dataStart := templateRow(startRow, table.HeaderRow), templateRow(startRow, table.DataStart)
+	trace.headerAnalysis(app.DecisionSourceTemplate, nil, headerRow, dataStart)
+	trace.validation(app.DecisionSourceTemplate, &GPTTableValidationResponse{IsProductTable: table.IsProductTable})
+
+	this.log.Info("Table layout matches the supplier template",
+		"sheet", sheet,
+		"startRow", startRow,
+		"headerRow", headerRow,
+		"dataStart", dataStart,
+		"isProductTable", table.IsProductTable)
+
+	if !table.IsProductTable {
+		trace.decide(false, reasonTemplateReject)
+		return nil
+	}
+
+	result := buildResultWithIndices(sg, startRow, table.HeaderRows, headerRow, dataStart, sg.maxCol, sheet)
+	result.Layout, result.ColumnMapping = table.Layout, table.Mapping
+	trace.decide(true, reasonProductTable)
+	return result
+}
+
+// sheetRejectedByTemplate reports whether the sheet template is skipped and rejects every table region of the sheet
+func sheetRejectedByTemplate(tmpl *app.SheetTemplate, sg *sheetGrid, sheet string, regions []tableRegion, minSimilarity float64) bool {
+	if tmpl == nil || !tmpl.Skipped {
+		return false
+	}
+
+	for _, region := range regions {
+		sub := sg.subGrid(region)
+		startRow := tableStartRow(sub.cells)
+		if startRow < 0 {
+			continue
+		}
+		if table := matchTableTemplate(tmpl, sub, sheet, startRow, minSimilarity); table == nil || table.IsProductTable {
+			return false
+		}
+	}
+
+	return true
+}
+
+// loadTemplate reads the template of the supplier. Errors are logged and reported as no template
+func (this *ExcelParserService) loadTemplate(ctx context.Context, supplierID uint64) *app.SupplierTemplate {
+	if supplierID == 0 {
+		return nil
+	}
+
+	tmpl, err := this.readTemplate(ctx, supplierID)
+	if err != nil {
+		this.log.Error("Error reading supplier template", "error", err, "supplierID", supplierID)
+		return nil
+	}
+	if tmpl == nil || tmpl.Version != templateSchemaVersion {
+		return nil
+	}
+
+	return tmpl
+}
+
+// sheetTemplate returns the template of the sheet. A sheet unknown by name, e.g. renamed, gets the tables
+// of all sheets of the supplier to find the closest layout among them
+func sheetTemplate(tmpl *app.SupplierTemplate, name string) *app.SheetTemplate {
+	if tmpl == nil {
+		return nil
+	}
+	if sheet := tmpl.Sheet(name); sheet != nil {
+		return sheet
+	}
+
+	all := &app.SheetTemplate{Sheet: name}
+	for _, sheet := range tmpl.Sheets {
+		all.Tables = append(all.Tables, sheet.Tables...)
+	}
+
+	return all
+}
+
+func (this *ExcelParserService) readTemplate(ctx context.Context, supplierID uint64) (*app.SupplierTemplate, error) {
+	if this.templateStore == nil {
+		return nil, nil
+	}
+
+	data, ok, err := this.templateStore.Get(ctx, templateKey(supplierID))
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	var tmpl app.SupplierTemplate
+	if err := json.Unmarshal(data, &tmpl); err != nil {
+		return nil, fmt.Errorf("unmarshal supplier template %d: %w", supplierID, err)
+	}
+
+	return &tmpl, nil
+}
+
+func (this *ExcelParserService) writeTemplate(ctx context.Context, tmpl *app.SupplierTemplate) error {
+	tmpl.Version, tmpl.UpdatedAt = templateSchemaVersion, time.Now()
+	data, err := json.Marshal(tmpl)
+	if err != nil {
+		return fmt.Errorf("marshal supplier template %d: %w", tmpl.SupplierID, err)
+	}
+
+	return this.templateStore.Set(ctx, templateKey(tmpl.SupplierID), data, templateTTL)
+}
+
+// learnTemplate stores the layout decisions of a parsed file. Sheets of the file replace the stored ones,
+// column mappings of tables with a similar layout are kept. The template is read again under the lock of
+// its key, so that concurrent uploads of the supplier do not drop each other's sheets. Errors are logged
+func (this *ExcelParserService) learnTemplate(ctx context.Context, supplierID uint64, learned []*app.SheetTemplate) {
+	if supplierID == 0 || this.templateStore == nil {
+		return
+	}
+
+	unlock := this.cacheLocks.lock(templateKey(supplierID))
+	defer unlock()
+
+	prev := this.loadTemplate(ctx, supplierID)
+
+	tmpl := &app.SupplierTemplate{SupplierID: supplierID}
+	changed := false
+	for _, sheet := range learned {
+		if sheet == nil {
+			continue
+		}
+
+		stored := prev.Sheet(sheet.Sheet)
+		for _, table := range sheet.Tables {
+			if table.Mapping != nil {
+				continue
+			}
+			if match := closestTable(stored, table.Fingerprint, this.layoutSimilarity); match != nil {
+				table.Mapping = match.Mapping
+			}
+		}
+		changed = changed || !reflect.DeepEqual(stored, sheet)
+		tmpl.Sheets = append(tmpl.Sheets, sheet)
+	}
+	if !changed {
+		return
+	}
+
+	if prev != nil {
+		for _, sheet := range prev.Sheets {
+			if tmpl.Sheet(sheet.Sheet) == nil {
+				tmpl.Sheets = append(tmpl.Sheets, sheet)
+			}
+		}
+	}
+
+	if err := this.writeTemplate(ctx, tmpl); err != nil {
+		this.log.Error("Error storing supplier template", "error", err, "supplierID", supplierID)
+		return
+	}
+
+	this.log.Info("Supplier template updated", "supplierID", supplierID, "sheets", len(tmpl.Sheets))
+}
+
+func storedTable(sheet *app.SheetTemplate, layout string) *app.TableTemplate {
+	if sheet == nil {
+		return nil
+	}
+	for _, table := range sheet.Tables {
+		if table.Layout == layout {
+			return table
+		}
+	}
+
+	return nil
+}
+
+func (this *ExcelParserService) GetTemplate(ctx nova_ctx.Ctx, supplierID uint64) (*app.SupplierTemplate, errs.Error) {
+	tmpl, err := this.readTemplate(ctx, supplierID)
+	if err != nil {
+		return nil, errs.WrapAppError(err, &errs.ErrorOpts{Ctx: ctx})
+	}
+
+	return tmpl, nil
+}
+
+func (this *ExcelParserService) SaveTemplateMapping(ctx nova_ctx.Ctx, supplierID uint64, sheet, layout string, mapping map[string]string) errs.Error {
+	if supplierID == 0 {
+		return errs.NewBadRequestError("supplier id is required", &errs.ErrorOpts{Ctx: ctx})
+	}
+
+	unlock := this.cacheLocks.lock(templateKey(supplierID))
+	defer unlock()
+
+	tmpl := this.loadTemplate(ctx, supplierID)
+	table := storedTable(tmpl.Sheet(sheet), layout)
+	if table == nil || reflect.DeepEqual(table.Mapping, mapping) {
+		return nil
+	}
+
+	table.Mapping = mapping
+	if err := this.writeTemplate(ctx, tmpl); err != nil {
+		return errs.WrapAppError(err, &errs.ErrorOpts{Ctx: ctx})
+	}
+
+	this.log.Info("Supplier template mapping saved", "supplierID", supplierID, "sheet", sheet, "columns", len(mapping))
+	return nil
+}
+
+func (this *ExcelParserService) DeleteTemplate(ctx nova_ctx.Ctx, supplierID uint64) errs.Error {
+	if supplierID == 0 {
+		return errs.NewBadRequestError("supplier id is required", &errs.ErrorOpts{Ctx: ctx})
+	}
+
+	if this.templateStore == nil {
+		return nil
+	}
+
+	if err := this.templateStore.Delete(ctx, templateKey(supplierID)); err != nil {
+		return errs.WrapAppError(err, &errs.ErrorOpts{Ctx: ctx})
+	}
+
+	this.log.Info("Supplier template deleted", "supplierID", supplierID)
+	return nil
+}
@@ -0,0 +1,108 @@
+package excel_parser_service
+
+import (
+	"bytes"
+
+	"github.com/xuri/excelize/v2"
+)
+
+type workbookFormat string
+
+var zipSignature = []byte{'P', 'K', 0x03, 0x04}
+
+const (
+	workbookFormatXlsx workbookFormat = "xlsx"
+	workbookFormatXls  workbookFormat = "xls"
+	workbookFormatCsv  workbookFormat = "csv"
+	workbookFormatOds  workbookFormat = "ods"
+)
+
+// workbookSheet is one sheet of any supported workbook format converted to the grid model
+type workbookSheet struct {
+	name     string
+	grid     *sheetGrid
+	isHidden bool
+	encoding string // text encoding of delimited text, empty for workbooks
+}
+
+// detectWorkbookFormat detects the workbook format by content, not by file name
+func detectWorkbookFormat(file []byte) workbookFormat {
+	if bytes.HasPrefix(file, zipSignature) {
+		if isOdsFile(file) {
+			return workbookFormatOds
+		}
+		return workbookFormatXlsx
+	}
+
+	if isOleFile(file) {
+		// OLE2 container is either a legacy BIFF workbook or an encrypted .xlsx
+		if _, ok, err := xlsWorkbookStream(file); err == nil && ok {
+			return workbookFormatXls
+		}
+		return workbookFormatXlsx
+	}
+
+	if looksLikeDelimitedText(file) {
+		return workbookFormatCsv
+	}
+
+	return workbookFormatXlsx
+}
+
+// readWorkbook reads all sheets of the file into grids
+func (this *ExcelParserService) readWorkbook(file []byte) ([]*workbookSheet, error) {
+	var format = detectWorkbookFormat(file)
+	this.log.Info("Workbook format detected", "format", format)
+
+	switch format {
+	case workbookFormatXls:
+		return readXlsWorkbook(file, this.mergePolicy)
+	case workbookFormatOds:
+		return readOdsWorkbook(file, this.mergePolicy)
+	case workbookFormatCsv:
+		sheets, encodingName, err := readCsvWorkbook(file, this.mergePolicy)
+		if err != nil {
+			return nil, err
+		}
+		this.log.Info("Delimited text decoded", "encoding", encodingName)
+		return sheets, nil
+	default:
+		return this.readXlsxWorkbook(file)
+	}
+}
+
+func (this *ExcelParserService) readXlsxWorkbook(file []byte) ([]*workbookSheet, error) {
+	f, err := excelize.OpenReader(bytes.NewReader(file))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sheets []*workbookSheet
+	for _, sheet := range f.GetSheetList() {
+		formulas, err := readXlsxFormulaCells(file, sheet)
+		if err != nil {
+			this.log.Error("failed to read formula cells", "sheet", sheet, "error", err)
+		}
+
+		sg, err := getFilledGrid(f, sheet, formulas, this.mergePolicy)
+		if err != nil {
+			this.log.Error("failed to get filled grid", "error", err)
+			continue
+		}
+
+		if len(formulas) > 0 {
+			computed, failed := formulaSummary(formulas)
+			this.log.Info("Formulas without cached values evaluated", "sheet", sheet, "computed", computed, "failed", failed)
+		}
+
+		visible, err := f.GetSheetVisible(sheet)
+		if err != nil {
+			visible = true
+		}
+
+		sheets = append(sheets, &workbookSheet{name: sheet, grid: sg, isHidden: !visible})
+	}
+
+	return sheets, nil
+}
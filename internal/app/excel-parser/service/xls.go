@@ -0,0 +1,659 @@
+package excel_parser_service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/init-pkg/nova-template/domain/app"
+	"github.com/richardlehane/mscfb"
+)
+
+// BIFF8 record types used by the legacy .xls reader
+const (
+	biffRecordBOF         = 0x0809
+	biffRecordEOF         = 0x000A
+	biffRecordBoundSheet  = 0x0085
+	biffRecordSST         = 0x00FC
+	biffRecordContinue    = 0x003C
+	biffRecordFormat      = 0x041E
+	biffRecordXF          = 0x00E0
+	biffRecordDateMode    = 0x0022
+	biffRecordFilePass    = 0x002F
+	biffRecordNumber      = 0x0203
+	biffRecordRK          = 0x027E
+	biffRecordMulRK       = 0x00BD
+	biffRecordLabelSST    = 0x00FD
+	biffRecordLabel       = 0x0204
+	biffRecordFormula     = 0x0006
+	biffRecordString      = 0x0207
+	biffRecordBoolErr     = 0x0205
+	biffRecordMergedCells = 0x00E5
+	biffRecordRow         = 0x0208
+	biffRecordColInfo     = 0x007D
+
+	biffVersion8           = 0x0600
+	biffSheetTypeWorksheet = 0x00
+)
+
+var oleSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// isOleFile checks the OLE2 compound file magic bytes used by legacy .xls files
+func isOleFile(file []byte) bool {
+	return bytes.HasPrefix(file, oleSignature)
+}
+
+// xlsWorkbookStream extracts the BIFF workbook stream from an OLE2 compound file.
+// Returns false if the container has no workbook stream (e.g. an encrypted .xlsx)
+func xlsWorkbookStream(file []byte) ([]byte, bool, error) {
+	doc, err := mscfb.New(bytes.NewReader(file))
+	if err != nil {
+		return nil, false, err
+	}
+
+	for entry, err := doc.Next(); err == nil; entry, err = doc.Next() {
+		if entry.Name != "Workbook" && entry.Name != "Book" {
+			continue
+		}
+
+		buf := make([]byte, entry.Size)
+		n, err := io.ReadFull(entry, buf)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, false, err
+		}
+
+		return buf[:n], true, nil
+	}
+
+	return nil, false, nil
+}
+
+type biffRecord struct {
+	kind uint16
+	data []byte
+}
+
+// readBiffRecord reads the record at offset and returns it with the offset of the next one
+func readBiffRecord(stream []byte, offset int) (biffRecord, int, bool) {
+	if offset+4 > len(stream) {
+		return biffRecord{}, offset, false
+	}
+
+	kind := binary.LittleEndian.Uint16(stream[offset:])
+	size := int(binary.LittleEndian.Uint16(stream[offset+2:]))
+	end := offset + 4 + size
+	if end > len(stream) {
+		end = len(stream)
+	}
+
+	return biffRecord{kind: kind, data: stream[offset+4 : end]}, end, true
+}
+
+// readBiffRecordWithContinue reads a record together with its CONTINUE records as separate chunks
+func readBiffRecordWithContinue(stream []byte, offset int) ([][]byte, int) {
+	rec, next, ok := readBiffRecord(stream, offset)
+	if !ok {
+		return nil, offset
+	}
+
+	chunks := [][]byte{rec.data}
+	for {
+		cont, after, ok := readBiffRecord(stream, next)
+		if !ok || cont.kind != biffRecordContinue {
+			break
+		}
+		chunks = append(chunks, cont.data)
+		next = after
+	}
+
+	return chunks, next
+}
+
+// biffReader reads values from a record split into CONTINUE chunks.
+// Character data crossing a chunk boundary restarts with a new option flags byte
+type biffReader struct {
+	chunks [][]byte
+	chunk  int
+	pos    int
+}
+
+var errBiffShortRecord = errors.New("xls: unexpected end of record")
+
+func (this *biffReader) ensure() bool {
+	for this.chunk < len(this.chunks) && this.pos >= len(this.chunks[this.chunk]) {
+		this.chunk++
+		this.pos = 0
+	}
+
+	return this.chunk < len(this.chunks)
+}
+
+func (this *biffReader) readBytes(n int) ([]byte, error) {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		if !this.ensure() {
+			return nil, errBiffShortRecord
+		}
+		cur := this.chunks[this.chunk]
+		take := min(n-len(out), len(cur)-this.pos)
+		out = append(out, cur[this.pos:this.pos+take]...)
+		this.pos += take
+	}
+
+	return out, nil
+}
+
+func (this *biffReader) readU8() (uint8, error) {
+	b, err := this.readBytes(1)
+	if err != nil {
+		return 0, err
+	}
+
+	return b[0], nil
+}
+
+func (this *biffReader) readU16() (uint16, error) {
+	b, err := this.readBytes(2)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint16(b), nil
+}
+
+func (this *biffReader) readU32() (uint32, error) {
+	b, err := this.readBytes(4)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+// readChars reads cch characters that may continue into the next chunk with new flags
+func (this *biffReader) readChars(cch int, isHighByte bool) (string, error) {
+	units := make([]uint16, 0, cch)
+
+	for len(units) < cch {
+		if this.chunk >= len(this.chunks) {
+			return "", errBiffShortRecord
+		}
+
+		cur := this.chunks[this.chunk]
+		if this.pos >= len(cur) {
+			// Character data continued in the next chunk starts with a fresh flags byte
+			this.chunk++
+			if this.chunk >= len(this.chunks) || len(this.chunks[this.chunk]) == 0 {
+				return "", errBiffShortRecord
+			}
+			isHighByte = this.chunks[this.chunk][0]&0x01 != 0
+			this.pos = 1
+			continue
+		}
+
+		if !isHighByte {
+			units = append(units, uint16(cur[this.pos]))
+			this.pos++
+			continue
+		}
+
+		if this.pos+1 >= len(cur) {
+			this.pos = len(cur)
+			continue
+		}
+		units = append(units, binary.LittleEndian.Uint16(cur[this.pos:]))
+		this.pos += 2
+	}
+
+	return string(utf16.Decode(units)), nil
+}
+
+// readUnicodeString reads XLUnicodeString / XLUnicodeRichExtendedString, skipping formatting runs
+func (this *biffReader) readUnicodeString(cch int) (string, error) {
+	flags, err := this.readU8()
+	if err != nil {
+		return "", err
+	}
+
+	var runs uint16
+	var extSize uint32
+	if flags&0x08 != 0 {
+		if runs, err = this.readU16(); err != nil {
+			return "", err
+		}
+	}
+	if flags&0x04 != 0 {
+		if extSize, err = this.readU32(); err != nil {
+			return "", err
+		}
+	}
+
+	str, err := this.readChars(cch, flags&0x01 != 0)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := this.readBytes(int(runs)*4 + int(extSize)); err != nil {
+		return "", err
+	}
+
+	return str, nil
+}
+
+// xlsFormats resolves cell XF indices to number formats to render dates
+type xlsFormats struct {
+	custom     map[uint16]string
+	xfFormats  []uint16
+	isDate1904 bool
+}
+
+// format returns the number format of the cell XF
+func (this *xlsFormats) format(ixfe uint16) numberFormat {
+	if int(ixfe) >= len(this.xfFormats) {
+		return numberFormat{}
+	}
+
+	ifmt := this.xfFormats[ixfe]
+	return numberFormat{id: int(ifmt), code: this.custom[ifmt]}
+}
+
+func (this *xlsFormats) isDateXF(ixfe uint16) bool {
+	return this.format(ixfe).isDate()
+}
+
+// isDateFormatCode checks whether a custom number format renders a date or time
+func isDateFormatCode(code string) bool {
+	var b strings.Builder
+	isQuoted := false
+	isBracket := false
+	for _, r := range code {
+		switch {
+		case r == '"':
+			isQuoted = !isQuoted
+		case isQuoted:
+		case r == '[':
+			isBracket = true
+		case r == ']':
+			isBracket = false
+		case isBracket:
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	cleaned := strings.ToLower(b.String())
+	if strings.Contains(cleaned, "general") {
+		return false
+	}
+
+	return strings.ContainsAny(cleaned, "ymdhs")
+}
+
+// formatNumber renders a numeric cell value, converting serial dates for date formats
+func (this *xlsFormats) formatNumber(value float64, ixfe uint16) string {
+	if this.isDateXF(ixfe) {
+		return formatExcelSerialDate(value, this.isDate1904)
+	}
+
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// numberValue types a numeric cell value by its number format
+func (this *xlsFormats) numberValue(value float64, ixfe uint16) app.CellValue {
+	return numericCellValue(value, this.format(ixfe), "", this.isDate1904)
+}
+
+// formatExcelSerialDate converts Excel serial date to "2006-01-02" or "2006-01-02 15:04:05"
+func formatExcelSerialDate(value float64, isDate1904 bool) string {
+	t := excelSerialToTime(value, isDate1904)
+
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+		return t.Format("2006-01-02")
+	}
+	if math.Floor(value) == 0 {
+		return t.Format("15:04:05")
+	}
+
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// decodeRK decodes the compressed RK number representation
+func decodeRK(rk uint32) float64 {
+	var value float64
+	if rk&0x02 != 0 {
+		value = float64(int32(rk) >> 2)
+	} else {
+		value = math.Float64frombits(uint64(rk&0xFFFFFFFC) << 32)
+	}
+
+	if rk&0x01 != 0 {
+		value /= 100
+	}
+
+	return value
+}
+
+type xlsBoundSheet struct {
+	name     string
+	offset   int
+	isHidden bool
+}
+
+// xlsSheet is the content of one worksheet substream
+type xlsSheet struct {
+	rows       [][]string
+	values     [][]app.CellValue
+	merges     []mergeRange
+	hiddenRows []bool
+	hiddenCols []bool
+}
+
+// readXlsWorkbook reads all worksheets of a BIFF8 workbook into grids
+func readXlsWorkbook(file []byte, policy MergePolicy) ([]*workbookSheet, error) {
+	stream, ok, err := xlsWorkbookStream(file)
+	if err != nil {
+		return nil, fmt.Errorf("xls: read compound file: %w", err)
+	}
+	if !ok {
+		return nil, errors.New("xls: workbook stream not found")
+	}
+
+	bof, _, ok := readBiffRecord(stream, 0)
+	if !ok || bof.kind != biffRecordBOF || len(bof.data) < 2 {
+		return nil, errors.New("xls: missing BOF record")
+	}
+	if version := binary.LittleEndian.Uint16(bof.data); version != biffVersion8 {
+		return nil, fmt.Errorf("xls: unsupported BIFF version 0x%04X", version)
+	}
+
+	var sst []string
+	var sheets []xlsBoundSheet
+	formats := &xlsFormats{custom: make(map[uint16]string)}
+
+	// Workbook globals substream
+	for offset := 0; ; {
+		rec, next, ok := readBiffRecord(stream, offset)
+		if !ok || rec.kind == biffRecordEOF {
+			break
+		}
+
+		switch rec.kind {
+		case biffRecordFilePass:
+			return nil, errors.New("xls: encrypted workbooks are not supported")
+
+		case biffRecordBoundSheet:
+			if len(rec.data) < 8 || rec.data[5] != biffSheetTypeWorksheet {
+				break
+			}
+			r := &biffReader{chunks: [][]byte{rec.data[6:]}}
+			cch, err := r.readU8()
+			if err != nil {
+				break
+			}
+			flags, err := r.readU8()
+			if err != nil {
+				break
+			}
+			name, err := r.readChars(int(cch), flags&0x01 != 0)
+			if err != nil {
+				break
+			}
+			sheets = append(sheets, xlsBoundSheet{
+				name:     name,
+				offset:   int(binary.LittleEndian.Uint32(rec.data)),
+				isHidden: rec.data[4]&0x03 != 0, // hidden or very hidden
+			})
+
+		case biffRecordFormat:
+			if len(rec.data) < 4 {
+				break
+			}
+			r := &biffReader{chunks: [][]byte{rec.data[2:]}}
+			cch, err := r.readU16()
+			if err != nil {
+				break
+			}
+			if code, err := r.readUnicodeString(int(cch)); err == nil {
+				formats.custom[binary.LittleEndian.Uint16(rec.data)] = code
+			}
+
+		case biffRecordXF:
+			if len(rec.data) >= 4 {
+				formats.xfFormats = append(formats.xfFormats, binary.LittleEndian.Uint16(rec.data[2:]))
+			}
+
+		case biffRecordDateMode:
+			formats.isDate1904 = len(rec.data) >= 2 && binary.LittleEndian.Uint16(rec.data) == 1
+
+		case biffRecordSST:
+			var chunks [][]byte
+			chunks, next = readBiffRecordWithContinue(stream, offset)
+			if sst, err = readSharedStrings(chunks); err != nil {
+				return nil, err
+			}
+		}
+
+		offset = next
+	}
+
+	res := make([]*workbookSheet, 0, len(sheets))
+	for _, sheet := range sheets {
+		data := readXlsSheet(stream, sheet.offset, sst, formats)
+		sg := newSheetGrid(data.rows, data.values, data.merges, policy)
+		sg.setHidden(data.hiddenRows, data.hiddenCols)
+		res = append(res, &workbookSheet{name: sheet.name, grid: sg, isHidden: sheet.isHidden})
+	}
+
+	return res, nil
+}
+
+// readSharedStrings decodes the shared string table split across SST and CONTINUE records
+func readSharedStrings(chunks [][]byte) ([]string, error) {
+	r := &biffReader{chunks: chunks}
+	if _, err := r.readU32(); err != nil { // cstTotal
+		return nil, err
+	}
+	unique, err := r.readU32()
+	if err != nil {
+		return nil, err
+	}
+
+	sst := make([]string, 0, unique)
+	for i := uint32(0); i < unique; i++ {
+		cch, err := r.readU16()
+		if err != nil {
+			// Truncated table: keep what was decoded
+			break
+		}
+		str, err := r.readUnicodeString(int(cch))
+		if err != nil {
+			break
+		}
+		sst = append(sst, str)
+	}
+
+	return sst, nil
+}
+
+// readXlsSheet reads cell values, their typed values, merged ranges and visibility of the worksheet substream at offset
+func readXlsSheet(stream []byte, offset int, sst []string, formats *xlsFormats) *xlsSheet {
+	var rows [][]string
+	var values [][]app.CellValue
+	var ranges []mergeRange
+	var hiddenRows, hiddenCols []bool
+
+	setHidden := func(hidden []bool, index int) []bool {
+		for len(hidden) <= index {
+			hidden = append(hidden, false)
+		}
+		hidden[index] = true
+		return hidden
+	}
+
+	setCell := func(row, col int, value string, typed app.CellValue) {
+		for len(rows) <= row {
+			rows = append(rows, nil)
+			values = append(values, nil)
+		}
+		for len(rows[row]) <= col {
+			rows[row] = append(rows[row], "")
+			values[row] = append(values[row], app.CellValue{})
+		}
+		rows[row][col] = value
+		values[row][col] = typed
+	}
+	setNumber := func(row, col int, value float64, ixfe uint16) {
+		setCell(row, col, formats.formatNumber(value, ixfe), formats.numberValue(value, ixfe))
+	}
+	setBool := func(row, col int, value bool) {
+		if value {
+			setCell(row, col, "TRUE", boolCellValue(true))
+		} else {
+			setCell(row, col, "FALSE", boolCellValue(false))
+		}
+	}
+	setString := func(row, col int, value string) {
+		setCell(row, col, value, stringCellValue(strings.TrimSpace(value)))
+	}
+
+	// Position of the last formula with a string result that is stored in the next STRING record
+	pendingRow, pendingCol := -1, -1
+
+	bof, next, ok := readBiffRecord(stream, offset)
+	if !ok || bof.kind != biffRecordBOF {
+		return &xlsSheet{}
+	}
+
+	for offset = next; ; {
+		rec, next, ok := readBiffRecord(stream, offset)
+		if !ok || rec.kind == biffRecordEOF {
+			break
+		}
+		data := rec.data
+
+		switch rec.kind {
+		case biffRecordNumber:
+			if len(data) >= 14 {
+				value := math.Float64frombits(binary.LittleEndian.Uint64(data[6:]))
+				setNumber(int(binary.LittleEndian.Uint16(data)), int(binary.LittleEndian.Uint16(data[2:])), value, binary.LittleEndian.Uint16(data[4:]))
+			}
+
+		case biffRecordRK:
+			if len(data) >= 10 {
+				value := decodeRK(binary.LittleEndian.Uint32(data[6:]))
+				setNumber(int(binary.LittleEndian.Uint16(data)), int(binary.LittleEndian.Uint16(data[2:])), value, binary.LittleEndian.Uint16(data[4:]))
+			}
+
+		case biffRecordMulRK:
+			if len(data) >= 6 {
+				row := int(binary.LittleEndian.Uint16(data))
+				col := int(binary.LittleEndian.Uint16(data[2:]))
+				for p := 4; p+6 <= len(data)-2; p += 6 {
+					value := decodeRK(binary.LittleEndian.Uint32(data[p+2:]))
+					setNumber(row, col, value, binary.LittleEndian.Uint16(data[p:]))
+					col++
+				}
+			}
+
+		case biffRecordLabelSST:
+			if len(data) >= 10 {
+				idx := int(binary.LittleEndian.Uint32(data[6:]))
+				if idx < len(sst) {
+					setString(int(binary.LittleEndian.Uint16(data)), int(binary.LittleEndian.Uint16(data[2:])), sst[idx])
+				}
+			}
+
+		case biffRecordLabel:
+			if len(data) >= 9 {
+				r := &biffReader{chunks: [][]byte{data[8:]}}
+				if str, err := r.readUnicodeString(int(binary.LittleEndian.Uint16(data[6:]))); err == nil {
+					setString(int(binary.LittleEndian.Uint16(data)), int(binary.LittleEndian.Uint16(data[2:])), str)
+				}
+			}
+
+		case biffRecordBoolErr:
+			if len(data) >= 8 && data[7] == 0 {
+				setBool(int(binary.LittleEndian.Uint16(data)), int(binary.LittleEndian.Uint16(data[2:])), data[6] != 0)
+			}
+
+		case biffRecordFormula:
+			if len(data) < 14 {
+				break
+			}
+			row := int(binary.LittleEndian.Uint16(data))
+			col := int(binary.LittleEndian.Uint16(data[2:]))
+			result := data[6:14]
+			if binary.LittleEndian.Uint16(result[6:]) != 0xFFFF {
+				setNumber(row, col, math.Float64frombits(binary.LittleEndian.Uint64(result)), binary.LittleEndian.Uint16(data[4:]))
+				break
+			}
+			switch result[0] {
+			case 0x00: // string, stored in the following STRING record
+				pendingRow, pendingCol = row, col
+			case 0x01:
+				setBool(row, col, result[2] != 0)
+			}
+
+		case biffRecordString:
+			if pendingRow < 0 {
+				break
+			}
+			var chunks [][]byte
+			chunks, next = readBiffRecordWithContinue(stream, offset)
+			r := &biffReader{chunks: chunks}
+			if cch, err := r.readU16(); err == nil {
+				if str, err := r.readUnicodeString(int(cch)); err == nil {
+					setString(pendingRow, pendingCol, str)
+				}
+			}
+			pendingRow, pendingCol = -1, -1
+
+		case biffRecordRow:
+			if len(data) >= 14 && binary.LittleEndian.Uint16(data[12:])&0x0020 != 0 {
+				hiddenRows = setHidden(hiddenRows, int(binary.LittleEndian.Uint16(data)))
+			}
+
+		case biffRecordColInfo:
+			if len(data) >= 10 && binary.LittleEndian.Uint16(data[8:])&0x0001 != 0 {
+				// Last COLINFO may cover all 256 columns, grid size limits it later
+				last := min(int(binary.LittleEndian.Uint16(data[2:])), 255)
+				for col := int(binary.LittleEndian.Uint16(data)); col <= last; col++ {
+					hiddenCols = setHidden(hiddenCols, col)
+				}
+			}
+
+		case biffRecordMergedCells:
+			if len(data) < 2 {
+				break
+			}
+			count := int(binary.LittleEndian.Uint16(data))
+			for i := 0; i < count && 2+i*8+8 <= len(data); i++ {
+				ref := data[2+i*8:]
+				ranges = append(ranges, mergeRange{
+					startRow: int(binary.LittleEndian.Uint16(ref)),
+					endRow:   int(binary.LittleEndian.Uint16(ref[2:])),
+					startCol: int(binary.LittleEndian.Uint16(ref[4:])),
+					endCol:   int(binary.LittleEndian.Uint16(ref[6:])),
+				})
+			}
+		}
+
+		offset = next
+	}
+
+	// Merged range value is the value of its top-left cell
+	for i := range ranges {
+		m := &ranges[i]
+		if m.startRow < len(rows) && m.startCol < len(rows[m.startRow]) {
+			m.value = rows[m.startRow][m.startCol]
+		}
+	}
+
+	return &xlsSheet{rows: rows, values: values, merges: ranges, hiddenRows: hiddenRows, hiddenCols: hiddenCols}
+}
@@ -0,0 +1,126 @@
+package excel_parser_service
+
+import (
+	"encoding/binary"
+	"math"
+	"slices"
+	"testing"
+	"unicode/utf16"
+)
+
+// biffRecordBytes encodes a BIFF record header and data
+func biffRecordBytes(kind uint16, data ...[]byte) []byte {
+	body := slices.Concat(data...)
+	rec := binary.LittleEndian.AppendUint16(nil, kind)
+	rec = binary.LittleEndian.AppendUint16(rec, uint16(len(body)))
+
+	return append(rec, body...)
+}
+
+func u16(v uint16) []byte { return binary.LittleEndian.AppendUint16(nil, v) }
+func u32(v uint32) []byte { return binary.LittleEndian.AppendUint32(nil, v) }
+
+// utf16Bytes encodes a string as UTF-16LE without flags
+func utf16Bytes(s string) []byte {
+	var out []byte
+	for _, unit := range utf16.Encode([]rune(s)) {
+		out = binary.LittleEndian.AppendUint16(out, unit)
+	}
+
+	return out
+}
+
+func TestDecodeRK(t *testing.T) {
+	tests := []struct {
+		name string
+		rk   uint32
+		want float64
+	}{
+		{name: "integer", rk: 123<<2 | 0x02, want: 123},
+		{name: "negative integer", rk: 0xFFFFFFEC | 0x02, want: -5},
+		{name: "integer divided by 100", rk: 12345<<2 | 0x03, want: 123.45},
+		{name: "float", rk: uint32(math.Float64bits(1.5) >> 32), want: 1.5},
+		{name: "float divided by 100", rk: uint32(math.Float64bits(1.5)>>32) | 0x01, want: 0.015},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeRK(tt.rk); got != tt.want {
+				t.Errorf("decodeRK(0x%08X) = %v, want %v", tt.rk, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSharedStrings(t *testing.T) {
+	// Strings cross the CONTINUE boundaries, each continued part restarts with its own flags byte
+	chunks := [][]byte{
+		slices.Concat(
+			u32(4), u32(4),
+			u16(3), []byte{0x00}, []byte("abc"),
+			u16(4), []byte{0x01}, utf16Bytes("Бо"),
+		),
+		slices.Concat(
+			[]byte{0x01}, utf16Bytes("лт"),
+			u16(5), []byte{0x01}, utf16Bytes("Цена"),
+		),
+		slices.Concat(
+			[]byte{0x00}, []byte("1"),
+			// rich text with one formatting run
+			u16(2), []byte{0x08}, u16(1), []byte("ok"), u32(0),
+		),
+	}
+
+	sst, err := readSharedStrings(chunks)
+	if err != nil {
+		t.Fatalf("read shared strings: %v", err)
+	}
+	if want := []string{"abc", "Болт", "Цена1", "ok"}; !slices.Equal(sst, want) {
+		t.Errorf("shared strings = %q, want %q", sst, want)
+	}
+
+	// A truncated table keeps the strings decoded so far
+	sst, err = readSharedStrings(chunks[:1])
+	if err != nil {
+		t.Fatalf("read truncated shared strings: %v", err)
+	}
+	if want := []string{"abc"}; !slices.Equal(sst, want) {
+		t.Errorf("truncated shared strings = %q, want %q", sst, want)
+	}
+}
+
+func TestReadXlsSheet(t *testing.T) {
+	rk := func(v int32) []byte { return u32(uint32(v<<2) | 0x02) }
+	stringResult := []byte{0x00, 0, 0, 0, 0, 0, 0xFF, 0xFF}
+
+	stream := slices.Concat(
+		biffRecordBytes(biffRecordBOF, u16(biffVersion8), u16(0x0010), make([]byte, 12)),
+		biffRecordBytes(biffRecordLabelSST, u16(0), u16(0), u16(0), u32(1)),
+		biffRecordBytes(biffRecordLabelSST, u16(0), u16(1), u16(0), u32(0)),
+		biffRecordBytes(biffRecordRK, u16(1), u16(0), u16(0), rk(7)),
+		biffRecordBytes(biffRecordMulRK, u16(1), u16(1), u16(0), rk(10), u16(0), rk(20), u16(2)),
+		biffRecordBytes(biffRecordNumber, u16(1), u16(3), u16(0), binary.LittleEndian.AppendUint64(nil, math.Float64bits(2.5))),
+		biffRecordBytes(biffRecordFormula, u16(2), u16(0), u16(0), stringResult, make([]byte, 6)),
+		biffRecordBytes(biffRecordString, u16(4), []byte{0x00}, []byte("Ga")),
+		biffRecordBytes(biffRecordContinue, []byte{0x01}, utf16Bytes("йк")),
+		biffRecordBytes(biffRecordEOF),
+	)
+
+	sheet := readXlsSheet(stream, 0, []string{"Цена", "Код"}, &xlsFormats{custom: make(map[uint16]string)})
+	want := [][]string{
+		{"Код", "Цена"},
+		{"7", "10", "20", "2.5"},
+		{"Gaйк"},
+	}
+	if len(sheet.rows) != len(want) {
+		t.Fatalf("got %d rows, want %d: %q", len(sheet.rows), len(want), sheet.rows)
+	}
+	for i := range want {
+		if !slices.Equal(sheet.rows[i], want[i]) {
+			t.Errorf("row %d = %q, want %q", i, sheet.rows[i], want[i])
+		}
+	}
+	if v := sheet.values[1][3]; v.Number != 2.5 {
+		t.Errorf("typed value = %+v, want 2.5", v)
+	}
+}
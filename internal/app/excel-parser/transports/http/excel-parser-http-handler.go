@@ -2,11 +2,17 @@ package excel_parser_http_handler
 
 import (
 	"fmt"
+	"log/slog"
+	"maps"
+	"strconv"
 
 	"github.com/init-pkg/nova-template/domain/app"
 	"github.com/init-pkg/nova-template/domain/dtos"
 	mapping_service "github.com/init-pkg/nova-template/internal/app/mapping/general"
+	normalize_service "github.com/init-pkg/nova-template/internal/app/mapping/normalize"
+	validation_service "github.com/init-pkg/nova-template/internal/app/mapping/validation"
 	laravel_client "github.com/init-pkg/nova-template/internal/clients/laravel"
+	"github.com/init-pkg/nova-template/internal/config"
 	"github.com/init-pkg/nova/errs"
 	nova_fiber "github.com/init-pkg/nova/shared/fiber"
 
@@ -15,18 +21,39 @@ import (
 
 type ExcelParserHttpHandler struct {
 	service        app.ExcelParserService
+	cacheAdmin     app.ExcelParserCacheAdmin
+	templates      app.ExcelParserTemplates
 	laravelClient  *laravel_client.LaravelClient
 	mappingService *mapping_service.Service
+	normalizer     *normalize_service.Service
+	validator      *validation_service.Service
+	log            *slog.Logger
+	adminEnabled   bool
 }
 
-func New(service app.ExcelParserService, laravelClient *laravel_client.LaravelClient, mappingService *mapping_service.Service) *ExcelParserHttpHandler {
-	return &ExcelParserHttpHandler{service: service, laravelClient: laravelClient, mappingService: mappingService}
+func New(service app.ExcelParserService, cacheAdmin app.ExcelParserCacheAdmin, templates app.ExcelParserTemplates, laravelClient *laravel_client.LaravelClient, mappingService *mapping_service.Service, normalizer *normalize_service.Service, validator *validation_service.Service, log *slog.Logger, cfg *config.Config) *ExcelParserHttpHandler {
+	return &ExcelParserHttpHandler{service: service, cacheAdmin: cacheAdmin, templates: templates, laravelClient: laravelClient, mappingService: mappingService, normalizer: normalizer, validator: validator, log: log, adminEnabled: cfg.Internal.ExcelParser.AdminEndpoints}
 }
 
 func (this *ExcelParserHttpHandler) Register(mainApp *fiber.App) {
 	var app = mainApp.Group("/")
 
 	app.Post("/manual-upload", this.manualUpload)
+	app.Post("/excel-parser/diagnose", this.diagnose)
+
+	// admin endpoints purge the cache and templates shared by all uploads, there is no auth on this router
+	if !this.adminEnabled {
+		return
+	}
+
+	app.Get("/excel-parser/cache", this.listCacheEntries)
+	app.Get("/excel-parser/cache/entry", this.getCacheEntry)
+	app.Delete("/excel-parser/cache/entry", this.purgeCacheKey)
+	app.Delete("/excel-parser/cache/supplier/:supplier_id", this.purgeCacheSupplier)
+	app.Delete("/excel-parser/cache", this.invalidateCache)
+
+	app.Get("/excel-parser/templates/:supplier_id", this.getTemplate)
+	app.Delete("/excel-parser/templates/:supplier_id", this.deleteTemplate)
 }
 
 func (this *ExcelParserHttpHandler) manualUpload(fctx fiber.Ctx) error {
@@ -46,14 +73,14 @@ func (this *ExcelParserHttpHandler) manualUpload(fctx fiber.Ctx) error {
 		return errs.WriteError(fctx, errs.NewBadRequestError("file is required", &errs.ErrorOpts{Ctx: ctx}))
 	}
 
-	res, err := this.service.Parse(ctx, uploadFile)
+	res, err := this.service.Parse(ctx, uploadFile, req.ParseOptions())
 	if err != nil {
 		return errs.WriteError(fctx, err)
 	}
 
 	var supMappings []laravel_client.ProductMappingResponse = nil
 	if req.HasSupplier() {
-		sm, e := this.laravelClient.GetProductMappings(&laravel_client.QueryParams{SupplierID: req.SupplierId})
+		sm, e := this.laravelClient.GetProductMappings(ctx, &laravel_client.QueryParams{SupplierID: req.SupplierId})
 		if e != nil {
 			return errs.WriteError(fctx, e)
 		}
@@ -61,24 +88,210 @@ func (this *ExcelParserHttpHandler) manualUpload(fctx fiber.Ctx) error {
 		supMappings = sm
 	}
 
-	gMappings, e := this.laravelClient.GetProductMappings(&laravel_client.QueryParams{OnlyGlobal: true})
+	gMappings, e := this.laravelClient.GetProductMappings(ctx, &laravel_client.QueryParams{OnlyGlobal: true})
 	if e != nil {
 		return errs.WriteError(fctx, e)
 	}
 
-	fmt.Println("sm", supMappings)
+	this.log.Debug("Product mappings loaded", "supplierName", req.SupplierName, "supplierMappings", len(supMappings), "generalMappings", len(gMappings))
+	var validations = make([]*app.RowValidation, 0, len(res))
+	var mappingErrors []dtos.ExcelParserTableError
+	for _, table := range res {
+		mapped, e := this.mappingService.MapProductFields(ctx, req.SupplierId, table, supMappings, gMappings)
+		if e != nil {
+			this.log.Error("Table mapping failed", "error", e, "sheet", table.SheetName, "range", table.Range)
+			mappingErrors = append(mappingErrors, dtos.ExcelParserTableError{SheetName: table.SheetName, Range: table.Range, Error: e.Error()})
+			continue
+		}
+
+		// remember the mapping of a new or changed layout, so the next upload of the supplier skips the model
+		if req.HasSupplier() && table.Layout != "" && !maps.Equal(table.ColumnMapping, mapped.ColumnMapping) {
+			if e := this.templates.SaveTemplateMapping(ctx, *req.SupplierId, table.SheetName, table.Layout, mapped.ColumnMapping); e != nil {
+				this.log.Warn("Template mapping not saved", "error", e, "supplierID", *req.SupplierId, "sheet", table.SheetName)
+			}
+		}
+
+		normalized := this.normalizer.Normalize(mapped, req.ParseOptions().SupplierID)
+		validation := this.validator.Validate(mapped, normalized)
+		validations = append(validations, validation)
+		this.log.Info("Table validated",
+			"sheet", table.SheetName,
+			"range", table.Range,
+			"rows", validation.Summary.Rows,
+			"validRows", validation.Summary.ValidRows)
+	}
+
+	var summary = this.validator.Summarize(validations)
+	var jobError = "Not implemented yet"
+	switch {
+	case len(res) == 0:
+		jobError = "File rejected: no product tables found"
+	case len(validations) == 0 && len(mappingErrors) > 0:
+		jobError = fmt.Sprintf("File rejected: mapping failed for all %d tables: %s", len(mappingErrors), mappingErrors[0].Error)
+	case summary.Decision == app.ImportDecisionReject:
+		jobError = fmt.Sprintf("File rejected: %d of %d rows invalid, missing fields: %v", summary.InvalidRows, summary.Rows, summary.MissingFields)
+	}
+	if len(validations) > 0 && len(mappingErrors) > 0 {
+		jobError += fmt.Sprintf("; mapping failed for %d of %d tables", len(mappingErrors), len(res))
+	}
+
+	err = this.laravelClient.MarkJobFailed(ctx, req.JobId, jobError)
+	if err != nil {
+		return errs.WriteError(fctx, err)
+	}
+
+	return fctx.JSON(dtos.ExcelParserManualUploadResponse{Validation: summary, MappingErrors: mappingErrors})
+}
+
+// diagnose parses an uploaded file and explains why every sheet was kept or dropped
+func (this *ExcelParserHttpHandler) diagnose(fctx fiber.Ctx) error {
+	var ctx = nova_fiber.ToNovaCtx(fctx)
+
+	req, err := nova_fiber.ParseAndValidateBodyT[dtos.ExcelParserDiagnoseRequest](fctx, ctx)
+	if err != nil {
+		return errs.WriteError(fctx, err)
+	}
+
+	uploadFile, ok, err := nova_fiber.ExtractFileBytes(fctx, "file")
+	if err != nil {
+		return errs.WriteError(fctx, err)
+	}
+
+	if !ok {
+		return errs.WriteError(fctx, errs.NewBadRequestError("file is required", &errs.ErrorOpts{Ctx: ctx}))
+	}
+
+	res, report, err := this.service.ParseWithReport(ctx, uploadFile, req.ParseOptions())
+	if report == nil {
+		return errs.WriteError(fctx, err)
+	}
 
-	fmt.Println("Supplier name: ", req.SupplierName)
+	var resp = dtos.ExcelParserDiagnoseResponse{Report: report, Tables: make([]dtos.ExcelParserTableSummary, 0, len(res))}
+	if err != nil {
+		resp.Error = err.Error()
+	}
 	for _, table := range res {
-		fmt.Println("Table sheet: ", table.SheetName)
+		resp.Tables = append(resp.Tables, dtos.ExcelParserTableSummary{
+			SheetName: table.SheetName,
+			Range:     table.Range,
+			Header:    table.HeaderTitles(),
+			RowCount:  len(table.Rows),
+			Profiles:  table.Profiles,
+		})
+	}
 
-		this.mappingService.MapProductFields(req.SupplierId, table, supMappings, gMappings)
+	return fctx.JSON(resp)
+}
+
+func (this *ExcelParserHttpHandler) listCacheEntries(fctx fiber.Ctx) error {
+	var ctx = nova_fiber.ToNovaCtx(fctx)
+
+	var filter app.ParserCacheFilter
+	if e := fctx.Bind().Query(&filter); e != nil {
+		return errs.WriteError(fctx, errs.NewBadRequestError(e.Error(), &errs.ErrorOpts{Ctx: ctx}))
 	}
 
-	err = this.laravelClient.MarkJobFailed(req.JobId, "Not implemented yet")
+	entries, err := this.cacheAdmin.ListCacheEntries(ctx, filter)
 	if err != nil {
 		return errs.WriteError(fctx, err)
 	}
-	var _ = res
-	return nil
+
+	return fctx.JSON(entries)
+}
+
+func (this *ExcelParserHttpHandler) getCacheEntry(fctx fiber.Ctx) error {
+	var ctx = nova_fiber.ToNovaCtx(fctx)
+
+	var key = fctx.Query("key")
+	if key == "" {
+		return errs.WriteError(fctx, errs.NewBadRequestError("key is required", &errs.ErrorOpts{Ctx: ctx}))
+	}
+
+	entry, err := this.cacheAdmin.GetCacheEntry(ctx, key)
+	if err != nil {
+		return errs.WriteError(fctx, err)
+	}
+	if entry == nil {
+		return fctx.SendStatus(fiber.StatusNotFound)
+	}
+
+	return fctx.JSON(entry)
+}
+
+func (this *ExcelParserHttpHandler) purgeCacheKey(fctx fiber.Ctx) error {
+	var ctx = nova_fiber.ToNovaCtx(fctx)
+
+	var key = fctx.Query("key")
+	if key == "" {
+		return errs.WriteError(fctx, errs.NewBadRequestError("key is required", &errs.ErrorOpts{Ctx: ctx}))
+	}
+
+	if err := this.cacheAdmin.PurgeCacheKey(ctx, key); err != nil {
+		return errs.WriteError(fctx, err)
+	}
+
+	return fctx.SendStatus(fiber.StatusNoContent)
+}
+
+func (this *ExcelParserHttpHandler) purgeCacheSupplier(fctx fiber.Ctx) error {
+	var ctx = nova_fiber.ToNovaCtx(fctx)
+
+	supplierID, e := strconv.ParseUint(fctx.Params("supplier_id"), 10, 64)
+	if e != nil {
+		return errs.WriteError(fctx, errs.NewBadRequestError("invalid supplier_id", &errs.ErrorOpts{Ctx: ctx}))
+	}
+
+	purged, err := this.cacheAdmin.PurgeCacheSupplier(ctx, supplierID)
+	if err != nil {
+		return errs.WriteError(fctx, err)
+	}
+
+	return fctx.JSON(fiber.Map{"purged": purged})
+}
+
+// invalidateCache removes stale entries by default, scope=all clears the whole parser cache
+func (this *ExcelParserHttpHandler) invalidateCache(fctx fiber.Ctx) error {
+	var ctx = nova_fiber.ToNovaCtx(fctx)
+
+	purged, err := this.cacheAdmin.InvalidateCache(ctx, app.ParserCacheScope(fctx.Query("scope", string(app.ParserCacheScopeStale))))
+	if err != nil {
+		return errs.WriteError(fctx, err)
+	}
+
+	return fctx.JSON(fiber.Map{"purged": purged})
+}
+
+func (this *ExcelParserHttpHandler) getTemplate(fctx fiber.Ctx) error {
+	var ctx = nova_fiber.ToNovaCtx(fctx)
+
+	supplierID, e := strconv.ParseUint(fctx.Params("supplier_id"), 10, 64)
+	if e != nil {
+		return errs.WriteError(fctx, errs.NewBadRequestError("invalid supplier_id", &errs.ErrorOpts{Ctx: ctx}))
+	}
+
+	tmpl, err := this.templates.GetTemplate(ctx, supplierID)
+	if err != nil {
+		return errs.WriteError(fctx, err)
+	}
+	if tmpl == nil {
+		return fctx.SendStatus(fiber.StatusNotFound)
+	}
+
+	return fctx.JSON(tmpl)
+}
+
+// deleteTemplate forgets the layout of a supplier, its next upload is analyzed by the model again
+func (this *ExcelParserHttpHandler) deleteTemplate(fctx fiber.Ctx) error {
+	var ctx = nova_fiber.ToNovaCtx(fctx)
+
+	supplierID, e := strconv.ParseUint(fctx.Params("supplier_id"), 10, 64)
+	if e != nil {
+		return errs.WriteError(fctx, errs.NewBadRequestError("invalid supplier_id", &errs.ErrorOpts{Ctx: ctx}))
+	}
+
+	if err := this.templates.DeleteTemplate(ctx, supplierID); err != nil {
+		return errs.WriteError(fctx, err)
+	}
+
+	return fctx.SendStatus(fiber.StatusNoContent)
 }
@@ -1,7 +1,9 @@
 package mapping_service
 
 import (
-	"fmt"
+	"context"
+	"log/slog"
+	"maps"
 
 	"github.com/init-pkg/nova-template/domain/app"
 	header_mapping_service "github.com/init-pkg/nova-template/internal/app/mapping/header"
@@ -16,14 +18,16 @@ type Service struct {
 	laravelClient        *laravel_client.LaravelClient
 	openaiClient         *openai.Client
 	opensearchClient     *opensearchapi.Client
+	log                  *slog.Logger
 }
 
-func New(headerMappingService *header_mapping_service.HeaderMappingService, laravelClient *laravel_client.LaravelClient, openaiClient *openai.Client, opensearchClient *opensearchapi.Client) *Service {
+func New(headerMappingService *header_mapping_service.HeaderMappingService, laravelClient *laravel_client.LaravelClient, openaiClient *openai.Client, opensearchClient *opensearchapi.Client, log *slog.Logger) *Service {
 	return &Service{
 		headerMappingService: headerMappingService,
 		laravelClient:        laravelClient,
 		openaiClient:         openaiClient,
 		opensearchClient:     opensearchClient,
+		log:                  log,
 	}
 }
 
@@ -37,37 +41,51 @@ GO TODO:
 
   - для category и brand полей тоже предзагружать и создавать маппинги
 
-  - в парсинге excel сделать
-    1. чтобы в header писалось не самое нижнее поле, а чтобы писались все значения начиная с самого верхнего в виде массива.
-    т.е. теперь headers [][]string: [[цена, usd], [цена, kz]].
-    2. сплитить вертикально объединенные ячейки внутри таблицы (body) c дублированием значения.
-
-  - было бы неплохо реализовать категорию через единичное значение в row.
-
 LARAVEL TODO:
   - реализовать unknown поле если его нет
   - реализовать прием готового json файла.
   - реализовать meta поле для товара. GO будет писать туда unknown заголовки для каждого supplier_id {supplier_id: {unknownHeader1: string}} (в конце)
 */
 func (this *Service) MapProductFields(
+	ctx context.Context,
 	supplierId *uint64,
 	r *app.ParseExcelResult,
 	existingSupplierMappings []laravel_client.ProductMappingResponse,
 	existingGeneralMappings []laravel_client.ProductMappingResponse,
 ) (*app.ParseExcelResult, errs.Error) {
+	// tables matched by a supplier template are mapped with its stored mapping, without the model.
+	// Supplier mappings edited in Laravel win over the template, as in the final mapping below
+	var known = maps.Clone(r.ColumnMapping)
+	for _, m := range existingSupplierMappings {
+		if _, ok := known[m.ExcelHeader]; ok {
+			known[m.ExcelHeader] = m.ProductField
+		}
+	}
+	if coversHeaders(known, r.HeaderTitles()) {
+		this.log.Info("Table mapped by supplier template", "sheet", r.SheetName, "range", r.Range)
+		return this.mapHeaders(r, known), nil
+	}
 
-	skip := make([]string, 0, len(existingSupplierMappings)+len(existingGeneralMappings))
+	skip := make([]string, 0, len(existingSupplierMappings)+len(existingGeneralMappings)+len(r.ColumnMapping))
+	// columns known by a supplier template of a similar layout are not sent to the model again
+	for h := range r.ColumnMapping {
+		skip = append(skip, h)
+	}
 	for _, m := range existingSupplierMappings {
 		skip = append(skip, m.ExcelHeader)
 	}
 	for _, m := range existingGeneralMappings {
 		skip = append(skip, m.ExcelHeader)
 	}
+	// synthetic category column from separator rows is mapped without the model
+	if r.HasCategoryColumn() {
+		skip = append(skip, app.CategoryColumnHeader)
+	}
 
 	// build mapping skipping already known headers
-	result, e := this.headerMappingService.BuildProductFieldsMappingExcept(r, skip)
+	result, e := this.headerMappingService.BuildProductFieldsMappingExcept(ctx, r, skip)
 	if e != nil {
-		return nil, errs.WrapAppError(e, &errs.ErrorOpts{})
+		return nil, errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 
 	// create laravel mappings
@@ -85,19 +103,27 @@ func (this *Service) MapProductFields(
 			})
 		}
 
-		var err = this.laravelClient.CreateProductMappings(mappingsToCreate, supplierId)
-		fmt.Println("Created mappings: ", mappingsToCreate)
+		var err = this.laravelClient.CreateProductMappings(ctx, mappingsToCreate, supplierId)
 		if err != nil {
 			return nil, err
 		}
+		this.log.Debug("Product mappings created", "sheet", r.SheetName, "mappings", mappingsToCreate)
 	}
 
 	// build final mapping
 	var mapping = make(map[string]string, len(existingSupplierMappings)+len(existingGeneralMappings)+len(result.Mappings))
+	if r.HasCategoryColumn() {
+		mapping[app.CategoryColumnHeader] = laravel_client.ProductFieldCategoryID.String()
+	}
+
 	for _, m := range existingGeneralMappings {
 		mapping[m.ExcelHeader] = m.ProductField
 	}
 
+	for h, field := range r.ColumnMapping {
+		mapping[h] = field
+	}
+
 	for _, m := range existingSupplierMappings {
 		mapping[m.ExcelHeader] = m.ProductField
 	}
@@ -106,23 +132,56 @@ func (this *Service) MapProductFields(
 		mapping[m.ExcelHeader] = m.ProductField
 	}
 
-	// build result with mapped headers
+	return this.mapHeaders(r, mapping), nil
+}
+
+// coversHeaders reports whether the mapping has every header title
+func coversHeaders(mapping map[string]string, titles []string) bool {
+	if len(mapping) == 0 {
+		return false
+	}
+	for _, title := range titles {
+		if _, ok := mapping[title]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// mapHeaders builds the result with headers replaced by product fields. ColumnMapping of the result
+// is the mapping of every column, unmapped ones included, to be stored in the supplier template
+func (this *Service) mapHeaders(r *app.ParseExcelResult, mapping map[string]string) *app.ParseExcelResult {
 	var newR = &app.ParseExcelResult{
-		Rows:      r.Rows,
-		SheetName: r.SheetName,
+		HeaderPath:    r.HeaderPath,
+		Rows:          r.Rows,
+		RowMerges:     r.RowMerges,
+		Values:        r.Values,
+		SheetName:     r.SheetName,
+		Range:         r.Range,
+		CategoryPath:  r.CategoryPath,
+		SourceRows:    r.SourceRows,
+		SourceColumns: r.SourceColumns,
+		HeaderCells:   r.HeaderCells,
+		Profiles:      r.Profiles,
+		Layout:        r.Layout,
+		ColumnMapping: make(map[string]string, len(r.Header)),
 	}
 
 	var newHeaders = make([]string, 0, len(r.Header))
-	for _, h := range r.Header {
+	for _, h := range r.HeaderTitles() {
 		if v, ok := mapping[h]; ok {
 			newHeaders = append(newHeaders, v)
 		} else {
-			fmt.Println("Header not mapped: ", h)
+			// keep headers aligned with row cells
+			newHeaders = append(newHeaders, laravel_client.ProductFieldUnknown.String())
+			this.log.Debug("Header not mapped", "sheet", r.SheetName, "header", h)
 		}
+		newR.ColumnMapping[h] = newHeaders[len(newHeaders)-1]
 	}
 
-	fmt.Println("Final headers: ", newHeaders)
+	this.log.Debug("Headers mapped", "sheet", r.SheetName, "range", r.Range, "headers", newHeaders)
 
 	newR.Header = newHeaders
-	return newR, nil
+	return newR
 }
@@ -10,8 +10,8 @@ import (
 	"time"
 
 	"github.com/init-pkg/nova-template/domain/app"
+	"github.com/init-pkg/nova-template/internal/config"
 	"github.com/invopop/jsonschema"
-	"github.com/openai/openai-go/v2"
 )
 
 // ----- DOMAIN TYPES -----
@@ -41,49 +41,50 @@ func GenerateSchema[T any]() interface{} {
 
 var ProductMappingResponseSchema = GenerateSchema[ProductMappingResponse]()
 
-// OpenAI v2: параметр схемы для response_format
-var schemaParam = openai.ResponseFormatJSONSchemaJSONSchemaParam{
-	Name:        "product_mapping",
-	Description: openai.String("Excel headers to product fields mapping"),
-	Schema:      ProductMappingResponseSchema,
-	Strict:      openai.Bool(true),
-}
-
 // ----- REQUEST SHAPE ДЛЯ ВХОДА В ПОДСКАЗКУ -----
 
 // То, что пошлём модели как компактный INPUT_JSON,
 // чтобы не плодить «болтовню» в промпте.
 type mappingInput struct {
-	Headers       []string            `json:"headers"`
-	ExampleValues map[string][]string `json:"example_values,omitempty"` // header -> sample values
+	Headers  []string                      `json:"headers"`
+	Profiles map[string]columnProfileInput `json:"profiles,omitempty"` // header -> профиль колонки
+}
+
+// Профиль колонки для модели: тип и статистика значений вместо пары сырых примеров
+type columnProfileInput struct {
+	Type     app.ColumnType `json:"type"`
+	FillRate float64        `json:"fill_rate"`
+	Distinct int            `json:"distinct"`
+	Min      *float64       `json:"min,omitempty"`
+	Max      *float64       `json:"max,omitempty"`
+	Samples  []string       `json:"samples,omitempty"`
 }
 
 // ----- SERVICE -----
 
 type HeaderMappingService struct {
-	openaiClient *openai.Client
+	llm app.StructuredCompleter
 	// Можно тюнить при инициализации при желании:
 	maxExamplesPerHeader int
-	exampleTruncateLen   int
 	ctxTimeout           time.Duration
 	batchSize            int // если заголовков очень много — режем на батчи
 }
 
-func New(openaiClient *openai.Client) *HeaderMappingService {
+func New(llm app.StructuredCompleter, cfg *config.Config) *HeaderMappingService {
 	return &HeaderMappingService{
-		openaiClient:         openaiClient,
-		maxExamplesPerHeader: 2,
-		exampleTruncateLen:   140,
-		ctxTimeout:           25 * time.Second,
+		llm:                  llm,
+		maxExamplesPerHeader: 3,
+		ctxTimeout:           config.Timeout(cfg.Internal.Timeouts.HeaderMapping, 25*time.Second),
 		batchSize:            120, // безопасный размер контекста
 	}
 }
 
 // Обратная совместимость: поведение как раньше (без исключений).
 func (s *HeaderMappingService) BuildProductFieldsMapping(
+	ctx context.Context,
 	r *app.ParseExcelResult,
 ) (ProductMappingResponse, error) {
-	return s.BuildProductFieldsMappingExcept(r, nil)
+	return s.BuildProductFieldsMappingExcept(ctx, r, nil)
 }
 
 func normalizeHeader(s string) string {
@@ -92,6 +93,7 @@ func normalizeHeader(s string) string {
 
 // Новый метод: скипаем уже известные заголовки (регистронезависимо).
 func (s *HeaderMappingService) BuildProductFieldsMappingExcept(
+	ctx context.Context,
 	r *app.ParseExcelResult,
 	skipHeaders []string,
 ) (ProductMappingResponse, error) {
@@ -107,9 +109,12 @@ func (s *HeaderMappingService) BuildProductFieldsMappingExcept(
 		}
 	}
 
+	// Заголовки с полным путем уровней ("Цена / USD"), а не только нижний уровень
+	headers := r.HeaderTitles()
+
 	// Список глобальных индексов колонок, которые надо маппить
-	candidates := make([]int, 0, len(r.Header))
-	for idx, h := range r.Header {
+	candidates := make([]int, 0, len(headers))
+	for idx, h := range headers {
 		if _, ok := skip[normalizeHeader(h)]; ok {
 			continue
 		}
@@ -129,12 +134,12 @@ func (s *HeaderMappingService) BuildProductFieldsMappingExcept(
 		}
 		batchIdx := candidates[start:end]
 
-		inputJSON, err := s.buildInputJSONByIndices(r.Header, r.Rows, batchIdx)
+		inputJSON, err := s.buildInputJSONByIndices(headers, r.Profiles, batchIdx)
 		if err != nil {
 			return ProductMappingResponse{}, fmt.Errorf("build input json: %w", err)
 		}
 
-		part, err := s.callModel(inputJSON)
+		part, err := s.callModel(ctx, inputJSON)
 		if err != nil {
 			return ProductMappingResponse{}, err
 		}
@@ -145,9 +150,10 @@ func (s *HeaderMappingService) BuildProductFieldsMappingExcept(
 }
 
 // Формирует INPUT_JSON только для выбранных колонок (по их глобальным индексам).
+// Профили берутся из результата парсинга, колонки без профиля отправляются только заголовком.
 func (s *HeaderMappingService) buildInputJSONByIndices(
 	headers []string,
-	rows [][]string,
+	profiles []app.ColumnProfile,
 	indices []int,
 ) (string, error) {
 	seen := make(map[string]struct{}, len(indices))
@@ -172,45 +178,30 @@ func (s *HeaderMappingService) buildInputJSONByIndices(
 		uniqHeaders = append(uniqHeaders, h)
 	}
 
-	examples := make(map[string][]string, len(uniqIdx))
-	for i := range uniqIdx {
-		col := uniqIdx[i]
-		header := uniqHeaders[i]
-
-		samples := make([]string, 0, s.maxExamplesPerHeader)
-		for _, row := range rows {
-			if len(samples) >= s.maxExamplesPerHeader {
-				break
-			}
-			if col >= len(row) {
-				continue
-			}
-			val := strings.TrimSpace(row[col])
-			if val == "" {
-				continue
-			}
-			if len(val) > s.exampleTruncateLen {
-				val = val[:s.exampleTruncateLen] + fmt.Sprintf("…(+%d)", len(val)-s.exampleTruncateLen)
-			}
-			dup := false
-			for _, ex := range samples {
-				if ex == val {
-					dup = true
-					break
-				}
-			}
-			if !dup {
-				samples = append(samples, val)
-			}
+	inputProfiles := make(map[string]columnProfileInput, len(uniqIdx))
+	for i, col := range uniqIdx {
+		if col >= len(profiles) || profiles[col].Type == app.ColumnTypeEmpty {
+			continue
+		}
+
+		p := profiles[col]
+		samples := p.Samples
+		if len(samples) > s.maxExamplesPerHeader {
+			samples = samples[:s.maxExamplesPerHeader]
 		}
-		if len(samples) > 0 {
-			examples[header] = samples
+		inputProfiles[uniqHeaders[i]] = columnProfileInput{
+			Type:     p.Type,
+			FillRate: p.FillRate,
+			Distinct: p.Distinct,
+			Min:      p.Min,
+			Max:      p.Max,
+			Samples:  samples,
 		}
 	}
 
 	payload := mappingInput{
-		Headers:       uniqHeaders,
-		ExampleValues: examples,
+		Headers:  uniqHeaders,
+		Profiles: inputProfiles,
 	}
 	b, err := json.Marshal(payload)
 	if err != nil {
@@ -220,47 +211,31 @@ func (s *HeaderMappingService) buildInputJSONByIndices(
 }
 
 // Один вызов модели на батч.
-func (s *HeaderMappingService) callModel(inputJSON string) (ProductMappingResponse, error) {
+func (s *HeaderMappingService) callModel(ctx context.Context, inputJSON string) (ProductMappingResponse, error) {
 	// Сверхкраткая роль + правила. Не «перегибаем» с текстом.
-	system := "You map Excel headers to product fields from a fixed enum. Use examples to disambiguate. If unsure, use \"unknown\". Return ONLY the JSON required by the schema."
+	system := "You map Excel headers to product fields from a fixed enum. Use column profiles (inferred type, fill rate, distinct count, numeric range, samples) to disambiguate. If unsure, use \"unknown\". Return ONLY the JSON required by the schema."
 
 	// Пользовательское сообщение содержит только инструкцию и INPUT_JSON
-	user := fmt.Sprintf("Map headers using the examples.\nINPUT_JSON:\n%s", inputJSON)
+	user := fmt.Sprintf("Map headers using the column profiles.\nINPUT_JSON:\n%s", inputJSON)
 
-	// Контекст с таймаутом
-	ctx, cancel := context.WithTimeout(context.Background(), s.ctxTimeout)
+	// Таймаут на вызов, отмена запроса прерывает его раньше
+	ctx, cancel := context.WithTimeout(ctx, s.ctxTimeout)
 	defer cancel()
 
-	chat, err := s.openaiClient.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Messages: []openai.ChatCompletionMessageParamUnion{
-			openai.SystemMessage(system),
-			openai.UserMessage(user),
-		},
+	var mappingResponse ProductMappingResponse
+	err := s.llm.Complete(ctx, app.CompletionRequest{
+		Task:   app.LLMTaskHeaderMapping,
+		System: system,
+		Prompt: user,
 		// Строгое соответствие нашей JSON Schema (Structured Outputs)
-		ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{
-			OfJSONSchema: &openai.ResponseFormatJSONSchemaParam{
-				JSONSchema: schemaParam,
-			},
-		},
+		SchemaName:        "product_mapping",
+		SchemaDescription: "Excel headers to product fields mapping",
+		Schema:            ProductMappingResponseSchema,
 		// Семя — больше повторяемости (детерминизм не гарантируется, но помогает)
-		Seed:  openai.Int(42), // см. README SDK
-		Model: openai.ChatModelGPT5Nano,
-		// temperature можно опустить; если критично — поставить очень маленькое значение.
-		// В некоторых клиентах "0" может быть опущено сериализатором, поэтому минимум > 0:
-		// Temperature: openai.Float64(math.SmallestNonzeroFloat64),
-	})
+		Seed: 42,
+	}, &mappingResponse)
 	if err != nil {
-		return ProductMappingResponse{}, fmt.Errorf("openai chat completion: %w", err)
-	}
-
-	if len(chat.Choices) == 0 {
-		return ProductMappingResponse{}, errors.New("openai: empty choices")
-	}
-
-	var mappingResponse ProductMappingResponse
-	if uerr := json.Unmarshal([]byte(chat.Choices[0].Message.Content), &mappingResponse); uerr != nil {
-		// На всякий случай: когда strict=false/сбой, модель могла вернуть текст.
-		return ProductMappingResponse{}, fmt.Errorf("unmarshal model output: %w", uerr)
+		return ProductMappingResponse{}, err
 	}
 
 	// Нормализация: гарантия допустимых значений на случай будущих расширений модели
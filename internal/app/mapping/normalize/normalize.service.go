@@ -0,0 +1,172 @@
+package normalize_service
+
+import (
+	"strings"
+	"time"
+
+	"github.com/init-pkg/nova-template/domain/app"
+	excel_parser_service "github.com/init-pkg/nova-template/internal/app/excel-parser/service"
+	laravel_client "github.com/init-pkg/nova-template/internal/clients/laravel"
+	"github.com/init-pkg/nova-template/internal/config"
+)
+
+// priceFields are product fields normalized as prices
+var priceFields = []laravel_client.ProductField{laravel_client.ProductFieldPrice, laravel_client.ProductFieldDiscount}
+
+// Service turns cells of a mapped table into typed product values
+type Service struct {
+	lowStock       int
+	stockScale     stockScale
+	supplierScales map[uint64]stockScale // stock scales of suppliers with overrides
+	now            func() time.Time
+}
+
+func New(cfg *config.Config) *Service {
+	var lowStock = cfg.Internal.Normalize.LowStock
+	if lowStock <= 0 {
+		lowStock = defaultLowStock
+	}
+	global, suppliers := stockScalesFromConfig(cfg.Internal.Normalize)
+
+	return &Service{
+		lowStock:       lowStock,
+		stockScale:     global,
+		supplierScales: suppliers,
+		now:            time.Now,
+	}
+}
+
+// Normalize normalizes the columns of a table whose header is mapped to product fields.
+// supplierID selects supplier overrides, 0 uses the global ones.
+// Cells that cannot be normalized are reported as issues of their rows
+func (this *Service) Normalize(r *app.ParseExcelResult, supplierID uint64) *app.NormalizedValues {
+	res := &app.NormalizedValues{Prices: make(map[string][]*app.Price)}
+
+	for _, field := range priceFields {
+		cols := columnsOf(r, field)
+		if len(cols) == 0 {
+			continue
+		}
+
+		prices := make([]*app.Price, len(r.Rows))
+		for row := range r.Rows {
+			prices[row] = this.normalizePrice(r, row, cols, field, res)
+		}
+		res.Prices[field.String()] = prices
+	}
+
+	if cols := columnsOf(r, laravel_client.ProductFieldQuantity); len(cols) > 0 {
+		scale, ok := this.supplierScales[supplierID]
+		if !ok {
+			scale = this.stockScale
+		}
+
+		res.Quantities = make([]*app.Quantity, len(r.Rows))
+		for row := range r.Rows {
+			res.Quantities[row] = this.normalizeQuantity(r, row, cols, scale, res)
+		}
+	}
+
+	return res
+}
+
+// normalizePrice takes the first price of the row from the columns mapped to the field.
+// Invalid cells are reported only when no column of the field has a valid price.
+// Prices without a currency take it from a neighboring currency cell, then from the header path: "Цена / USD"
+func (this *Service) normalizePrice(r *app.ParseExcelResult, row int, cols []int, field laravel_client.ProductField, res *app.NormalizedValues) *app.Price {
+	var issues []app.RowIssue
+	for _, col := range cols {
+		text := cellText(r, row, col)
+		price, err := parsePrice(text, cellValue(r, row, col))
+		if err != nil {
+			issues = append(issues, newRowIssue(r, row, col, field, err))
+			continue
+		}
+		if price == nil {
+			continue
+		}
+
+		if price.Currency == "" && price.Qualifier != app.PriceQualifierOnRequest && !price.Percent {
+			price.Currency = neighborCurrency(r, row, col)
+			if price.Currency == "" && col < len(r.HeaderPath) {
+				price.Currency = excel_parser_service.DetectCurrency(strings.Join(r.HeaderPath[col], " "))
+			}
+		}
+		return price
+	}
+
+	res.Issues = append(res.Issues, issues...)
+	return nil
+}
+
+// normalizeQuantity takes the first quantity of the row from the quantity columns.
+// Invalid cells are reported only when no quantity column has a valid value
+func (this *Service) normalizeQuantity(r *app.ParseExcelResult, row int, cols []int, scale stockScale, res *app.NormalizedValues) *app.Quantity {
+	var issues []app.RowIssue
+	for _, col := range cols {
+		text := cellText(r, row, col)
+		quantity, err := parseQuantity(text, cellValue(r, row, col), scale, this.lowStock, this.now())
+		if err != nil {
+			issues = append(issues, newRowIssue(r, row, col, laravel_client.ProductFieldQuantity, err))
+			continue
+		}
+		if quantity != nil {
+			return quantity
+		}
+	}
+
+	res.Issues = append(res.Issues, issues...)
+	return nil
+}
+
+// neighborCurrency returns the currency of the cell next to the price: right first, then left
+func neighborCurrency(r *app.ParseExcelResult, row, col int) string {
+	if cur := currencyOfCell(cellText(r, row, col+1)); cur != "" {
+		return cur
+	}
+
+	return currencyOfCell(cellText(r, row, col-1))
+}
+
+// columnsOf returns the columns mapped to the field, left to right
+func columnsOf(r *app.ParseExcelResult, field laravel_client.ProductField) []int {
+	var cols []int
+	for c, h := range r.Header {
+		if h == field.String() {
+			cols = append(cols, c)
+		}
+	}
+
+	return cols
+}
+
+// IssueRuleType is the rule of cells that cannot be normalized into their field type
+const IssueRuleType = "type"
+
+func newRowIssue(r *app.ParseExcelResult, row, col int, field laravel_client.ProductField, err error) app.RowIssue {
+	return app.RowIssue{
+		Row:      row,
+		Cell:     r.CellRef(row, col),
+		Field:    field.String(),
+		Value:    cellText(r, row, col),
+		Rule:     IssueRuleType,
+		Severity: app.IssueSeverityError,
+		Message:  err.Error(),
+	}
+}
+
+func cellText(r *app.ParseExcelResult, row, col int) string {
+	if row < 0 || row >= len(r.Rows) || col < 0 || col >= len(r.Rows[row]) {
+		return ""
+	}
+
+	return r.Rows[row][col]
+}
+
+func cellValue(r *app.ParseExcelResult, row, col int) app.CellValue {
+	if row < 0 || row >= len(r.Values) || col < 0 || col >= len(r.Values[row]) {
+		return app.CellValue{}
+	}
+
+	return r.Values[row][col]
+}
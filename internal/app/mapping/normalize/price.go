@@ -0,0 +1,151 @@
+package normalize_service
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/init-pkg/nova-template/domain/app"
+	excel_parser_service "github.com/init-pkg/nova-template/internal/app/excel-parser/service"
+)
+
+// onRequestMarkers are texts of price cells without an amount
+var onRequestMarkers = []string{"запрос", "договор", "звоните", "уточня", "on request", "call"}
+
+// fromPrefixes mark a lower bound price: "от 1500"
+var fromPrefixes = []string{"от", "from"}
+
+// rangeSeparators split a price range. Dash comes last so that "1 500 – 1 800" is split by the long dash
+var rangeSeparators = []string{"...", "…", "–", "—", "-"}
+
+// amountMultipliers are abbreviated orders of magnitude: "12,5 тыс."
+var amountMultipliers = []struct {
+	marker string
+	factor float64
+}{
+	{"млн", 1e6}, {"тыс", 1e3},
+}
+
+// currencyCellMaxLen is the max length of a cell holding only a currency, like "USD" or "тенге"
+const currencyCellMaxLen = 8
+
+var (
+	errNotPrice      = errors.New("not a price")
+	errNegativePrice = errors.New("negative price")
+	errInvertedRange = errors.New("price range upper bound is below the lower bound")
+)
+
+// parsePrice normalizes a price cell. Typed numeric cells are taken as is, texts are parsed
+// with qualifiers, ranges and multipliers. Returns nil for an empty cell
+func parsePrice(text string, value app.CellValue) (*app.Price, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, nil
+	}
+	percent := strings.Contains(text, "%")
+
+	switch value.Type {
+	case app.CellTypeNumber, app.CellTypeInteger, app.CellTypeCurrency:
+		return checkPrice(&app.Price{Amount: value.Number, Currency: value.Currency, Qualifier: app.PriceQualifierExact, Percent: percent})
+	}
+
+	lower := strings.ToLower(text)
+	if !strings.ContainsFunc(lower, unicode.IsDigit) {
+		for _, marker := range onRequestMarkers {
+			if strings.Contains(lower, marker) {
+				return &app.Price{Qualifier: app.PriceQualifierOnRequest}, nil
+			}
+		}
+		return nil, errNotPrice
+	}
+
+	price := &app.Price{Qualifier: app.PriceQualifierExact, Percent: percent}
+	for _, prefix := range fromPrefixes {
+		if rest, ok := strings.CutPrefix(lower, prefix); ok && rest != "" && !unicode.IsLetter([]rune(rest)[0]) {
+			lower = strings.TrimLeft(rest, " .:")
+			price.Qualifier = app.PriceQualifierFrom
+			break
+		}
+	}
+	if rest, ok := strings.CutSuffix(lower, "+"); ok {
+		lower = strings.TrimSpace(rest)
+		price.Qualifier = app.PriceQualifierFrom
+	}
+
+	factor := 1.0
+	for _, m := range amountMultipliers {
+		if i := strings.Index(lower, m.marker); i >= 0 {
+			factor = m.factor
+			// rest of the word: "тыс.", "тысяч"
+			lower = lower[:i] + strings.TrimLeftFunc(lower[i+len(m.marker):], func(r rune) bool {
+				return unicode.IsLetter(r) || r == '.'
+			})
+			break
+		}
+	}
+
+	price.Currency = excel_parser_service.DetectCurrency(lower)
+
+	if price.Qualifier == app.PriceQualifierExact {
+		for _, sep := range rangeSeparators {
+			left, right, found := strings.Cut(lower, sep)
+			if !found || strings.TrimSpace(left) == "" {
+				continue
+			}
+
+			from, ok := parseAmount(left)
+			if !ok {
+				continue
+			}
+			to, ok := parseAmount(right)
+			if !ok {
+				continue
+			}
+			if to < from {
+				return nil, errInvertedRange
+			}
+
+			price.Qualifier = app.PriceQualifierRange
+			price.Amount, price.MaxAmount = from*factor, to*factor
+			return checkPrice(price)
+		}
+	}
+
+	amount, ok := parseAmount(lower)
+	if !ok {
+		return nil, errNotPrice
+	}
+	price.Amount = amount * factor
+
+	return checkPrice(price)
+}
+
+func checkPrice(price *app.Price) (*app.Price, error) {
+	if price.Amount < 0 {
+		return nil, errNegativePrice
+	}
+
+	return price, nil
+}
+
+// parseAmount parses a number with optional currency markers
+func parseAmount(text string) (float64, bool) {
+	value := excel_parser_service.InferCellValue(text)
+	switch value.Type {
+	case app.CellTypeNumber, app.CellTypeInteger, app.CellTypeCurrency:
+		return value.Number, true
+	default:
+		return 0, false
+	}
+}
+
+// currencyOfCell returns the currency of a cell that holds nothing but a currency, like a "Валюта" column
+func currencyOfCell(text string) string {
+	text = strings.TrimSpace(text)
+	if text == "" || utf8.RuneCountInString(text) > currencyCellMaxLen || strings.ContainsFunc(text, unicode.IsDigit) {
+		return ""
+	}
+
+	return excel_parser_service.DetectCurrency(text)
+}
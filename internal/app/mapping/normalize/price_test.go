@@ -0,0 +1,47 @@
+package normalize_service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/init-pkg/nova-template/domain/app"
+)
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		text  string
+		value app.CellValue
+		want  *app.Price
+		err   error
+	}{
+		{text: "", want: nil},
+		{text: "1500", value: app.CellValue{Type: app.CellTypeInteger, Number: 1500}, want: &app.Price{Amount: 1500, Qualifier: app.PriceQualifierExact}},
+		{text: "от 1500", want: &app.Price{Amount: 1500, Qualifier: app.PriceQualifierFrom}},
+		{text: "1500+", want: &app.Price{Amount: 1500, Qualifier: app.PriceQualifierFrom}},
+		{text: "1500-1800", want: &app.Price{Amount: 1500, MaxAmount: 1800, Qualifier: app.PriceQualifierRange}},
+		{text: "1 500 – 1 800", want: &app.Price{Amount: 1500, MaxAmount: 1800, Qualifier: app.PriceQualifierRange}},
+		{text: "12,5 тыс.", want: &app.Price{Amount: 12500, Qualifier: app.PriceQualifierExact}},
+		{text: "1,2 млн", want: &app.Price{Amount: 1.2e6, Qualifier: app.PriceQualifierExact}},
+		{text: "по запросу", want: &app.Price{Qualifier: app.PriceQualifierOnRequest}},
+		{text: "Звоните", want: &app.Price{Qualifier: app.PriceQualifierOnRequest}},
+		{text: "1800-1500", err: errInvertedRange},
+		{text: "-5", err: errNegativePrice},
+		{text: "нет", err: errNotPrice},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := parsePrice(tt.text, tt.value)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			switch {
+			case got == nil && tt.want == nil:
+			case got == nil || tt.want == nil:
+				t.Errorf("price = %+v, want %+v", got, tt.want)
+			case got.Amount != tt.want.Amount || got.MaxAmount != tt.want.MaxAmount || got.Qualifier != tt.want.Qualifier:
+				t.Errorf("price = %+v, want %+v", *got, *tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package normalize_service
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/init-pkg/nova-template/domain/app"
+	excel_parser_service "github.com/init-pkg/nova-template/internal/app/excel-parser/service"
+	"github.com/init-pkg/nova-template/internal/config"
+)
+
+const defaultLowStock = 3
+
+// stockSymbol is the meaning of a symbolic stock value like "++"
+type stockSymbol struct {
+	availability app.Availability
+	min, max     int // quantity range, both 0 if unknown
+}
+
+// stockScale maps symbolic stock values to their meaning
+type stockScale map[string]stockSymbol
+
+var defaultStockScale = stockScale{
+	"+":   {availability: app.AvailabilityLow},
+	"++":  {availability: app.AvailabilityInStock},
+	"+++": {availability: app.AvailabilityInStock},
+}
+
+// availabilityMarkers are words of stock cells, checked in order. A marker matches at the start of a word,
+// a marker with a trailing space matches a whole word only
+var availabilityMarkers = []struct {
+	availability app.Availability
+	markers      []string
+}{
+	{app.AvailabilityOnOrder, []string{"под заказ", "заказ", "ожида", "в пути", "поступ", "on order", "backorder"}},
+	{app.AvailabilityOut, []string{"нет ", "отсутств", "законч", "out of stock", "no "}},
+	{app.AvailabilityLow, []string{"мало", "заканчива", "low "}},
+	{app.AvailabilityInStock, []string{"много", "есть ", "наличи", "да ", "yes ", "in stock", "available"}},
+}
+
+// quantityBounds are prefixes of open ranges: ">10", "более 10", "до 5".
+// strict bounds exclude the number itself
+var quantityBounds = []struct {
+	prefix  string
+	isLower bool
+	strict  bool
+}{
+	{">=", true, false}, {"≥", true, false}, {"<=", false, false}, {"≤", false, false},
+	{">", true, true}, {"<", false, true},
+	{"более", true, true}, {"больше", true, true}, {"свыше", true, true}, {"over", true, true}, {"more than", true, true},
+	{"менее", false, true}, {"меньше", false, true}, {"less than", false, true},
+	{"от", true, false}, {"до", false, false},
+}
+
+var (
+	// Month of two digits, "12.5" is not a date. The date is a separate word: "1.000.000" has no date in it
+	quantityDatePattern   = regexp.MustCompile(`(?:^|[^\d.,/])((\d{1,2})[./](\d{2})(?:[./](\d{4}|\d{2}))?)(?:$|[^\d.,/]|[.,](?:$|\D))`)
+	quantityNumberPattern = regexp.MustCompile(`\d+`)
+	quantityRangePattern  = regexp.MustCompile(`^\D*(\d+)\s*[-–—]\s*(\d+)\D*$`)
+)
+
+var (
+	errNotQuantity        = errors.New("not a quantity")
+	errNegativeQuantity   = errors.New("negative quantity")
+	errFractionalQuantity = errors.New("fractional quantity")
+	errInvertedStockRange = errors.New("quantity range upper bound is below the lower bound")
+)
+
+// stockScalesFromConfig builds the global scale and the scales of suppliers with overrides.
+// Entries with an unknown availability are ignored
+func stockScalesFromConfig(cfg config.NormalizeConfig) (stockScale, map[uint64]stockScale) {
+	global := defaultStockScale.merge(cfg.StockScales)
+
+	suppliers := make(map[uint64]stockScale, len(cfg.Suppliers))
+	for id, supplier := range cfg.Suppliers {
+		suppliers[id] = global.merge(supplier.StockScales)
+	}
+
+	return global, suppliers
+}
+
+// merge returns a copy of the scale with the configured symbols added or replaced
+func (this stockScale) merge(entries map[string]config.StockScaleConfig) stockScale {
+	merged := make(stockScale, len(this)+len(entries))
+	for symbol, s := range this {
+		merged[symbol] = s
+	}
+	for symbol, entry := range entries {
+		availability := app.Availability(entry.Availability)
+		if !availability.IsValid() {
+			continue
+		}
+		merged[strings.ToLower(strings.TrimSpace(symbol))] = stockSymbol{availability: availability, min: entry.Min, max: entry.Max}
+	}
+
+	return merged
+}
+
+// parseQuantity normalizes a stock cell into an amount or a range, an availability and an expected date.
+// Returns nil for an empty cell
+func parseQuantity(text string, value app.CellValue, scale stockScale, lowStock int, now time.Time) (*app.Quantity, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, nil
+	}
+
+	if value.Type == app.CellTypeString || value.Type == app.CellTypeEmpty {
+		// Stock exported as text: "1 000", "1.000"
+		if inferred := excel_parser_service.InferCellValue(text); inferred.Type == app.CellTypeInteger {
+			value = inferred
+		}
+	}
+
+	switch value.Type {
+	case app.CellTypeNumber, app.CellTypeInteger:
+		if value.Number < 0 {
+			return nil, errNegativeQuantity
+		}
+		if value.Number != math.Trunc(value.Number) {
+			return nil, errFractionalQuantity
+		}
+		q := &app.Quantity{Amount: int(value.Number), Qualifier: app.QuantityQualifierExact}
+		q.Availability = availabilityOf(q, lowStock)
+		return q, nil
+	case app.CellTypeDate:
+		return &app.Quantity{Qualifier: app.QuantityQualifierUnknown, Availability: app.AvailabilityOnOrder, ExpectedAt: value.Time}, nil
+	}
+
+	lower := strings.ToLower(text)
+	if s, ok := scale[lower]; ok {
+		return quantityOfSymbol(s), nil
+	}
+	if strings.HasPrefix(lower, "-") && strings.ContainsFunc(lower, unicode.IsDigit) {
+		return nil, errNegativeQuantity
+	}
+
+	q := &app.Quantity{Qualifier: app.QuantityQualifierUnknown}
+	if m := quantityDatePattern.FindStringSubmatchIndex(lower); m != nil {
+		q.ExpectedAt = expectedDate(lower, m, now)
+		lower = lower[:m[2]] + " " + lower[m[3]:]
+	}
+
+	numbers := quantityNumberPattern.FindAllString(lower, -1)
+	switch {
+	case len(numbers) == 0:
+	case len(numbers) == 2:
+		m := quantityRangePattern.FindStringSubmatch(lower)
+		if m == nil {
+			return nil, errNotQuantity
+		}
+		q.Amount, _ = strconv.Atoi(m[1])
+		q.MaxAmount, _ = strconv.Atoi(m[2])
+		if q.MaxAmount < q.Amount {
+			return nil, errInvertedStockRange
+		}
+		q.Qualifier = app.QuantityQualifierRange
+	case len(numbers) == 1:
+		n, _ := strconv.Atoi(numbers[0])
+		q.Amount, q.Qualifier = n, app.QuantityQualifierExact
+		applyQuantityBound(q, lower, n)
+	default:
+		return nil, errNotQuantity
+	}
+
+	// Words decide when there is no amount, otherwise the amount does: "2 (ожидается 12.11)" is in stock
+	marked := markedAvailability(lower)
+	switch {
+	case q.Qualifier == app.QuantityQualifierUnknown && marked != "":
+		q.Availability = marked
+	case q.Qualifier == app.QuantityQualifierUnknown && q.ExpectedAt != nil:
+		q.Availability = app.AvailabilityOnOrder
+	case q.Qualifier == app.QuantityQualifierUnknown:
+		return nil, errNotQuantity
+	case q.Amount == 0 && q.MaxAmount == 0 && marked == app.AvailabilityOnOrder:
+		q.Availability = app.AvailabilityOnOrder
+	default:
+		q.Availability = availabilityOf(q, lowStock)
+	}
+
+	return q, nil
+}
+
+// applyQuantityBound turns an exact amount into an open range when the text starts with a bound
+// or the number is followed by a plus: "10+"
+func applyQuantityBound(q *app.Quantity, text string, n int) {
+	text = strings.TrimSpace(text)
+	if strings.HasSuffix(text, "+") {
+		q.Qualifier = app.QuantityQualifierRange
+		return
+	}
+
+	for _, b := range quantityBounds {
+		rest, ok := strings.CutPrefix(text, b.prefix)
+		if !ok || (rest != "" && unicode.IsLetter([]rune(rest)[0])) {
+			// "доступно 5" is not "до 5"
+			continue
+		}
+
+		q.Qualifier = app.QuantityQualifierRange
+		switch {
+		case b.isLower && b.strict:
+			q.Amount = n + 1
+		case b.isLower:
+			q.Amount = n
+		case b.strict:
+			q.Amount, q.MaxAmount = min(1, n-1), n-1
+		default:
+			q.Amount, q.MaxAmount = min(1, n), n
+		}
+		return
+	}
+}
+
+// availabilityOf derives the availability from the amount. Nothing in stock with an expected date is on order
+func availabilityOf(q *app.Quantity, lowStock int) app.Availability {
+	if q.Amount == 0 && q.MaxAmount == 0 {
+		if q.ExpectedAt != nil {
+			return app.AvailabilityOnOrder
+		}
+		return app.AvailabilityOut
+	}
+
+	// Open ranges have no upper bound and are never low
+	upper := q.Amount
+	if q.Qualifier == app.QuantityQualifierRange {
+		upper = q.MaxAmount
+	}
+	if upper > 0 && upper <= lowStock {
+		return app.AvailabilityLow
+	}
+
+	return app.AvailabilityInStock
+}
+
+func quantityOfSymbol(s stockSymbol) *app.Quantity {
+	q := &app.Quantity{Qualifier: app.QuantityQualifierUnknown, Availability: s.availability}
+	if s.min > 0 || s.max > 0 {
+		q.Qualifier, q.Amount, q.MaxAmount = app.QuantityQualifierRange, s.min, s.max
+		if s.min == s.max {
+			q.Qualifier, q.MaxAmount = app.QuantityQualifierExact, 0
+		}
+	}
+
+	return q
+}
+
+// markedAvailability finds an availability word in the text, empty if none
+func markedAvailability(text string) app.Availability {
+	words := " " + strings.Join(strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ") + " "
+
+	for _, group := range availabilityMarkers {
+		for _, marker := range group.markers {
+			if strings.Contains(words, " "+marker) {
+				return group.availability
+			}
+		}
+	}
+
+	return ""
+}
+
+// expectedDate builds the date of a dd.mm[.yyyy] match. Dates without a year are the next such date,
+// allowing a month in the past for late deliveries
+func expectedDate(text string, m []int, now time.Time) *time.Time {
+	day, _ := strconv.Atoi(text[m[4]:m[5]])
+	month, _ := strconv.Atoi(text[m[6]:m[7]])
+	if day < 1 || day > 31 || month < 1 || month > 12 {
+		return nil
+	}
+
+	year := now.Year()
+	if m[8] >= 0 {
+		year, _ = strconv.Atoi(text[m[8]:m[9]])
+		if year < 100 {
+			year += 2000
+		}
+	}
+
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if m[8] < 0 && date.Before(now.AddDate(0, -1, 0)) {
+		date = date.AddDate(1, 0, 0)
+	}
+
+	return &date
+}
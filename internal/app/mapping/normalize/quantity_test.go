@@ -0,0 +1,57 @@
+package normalize_service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/init-pkg/nova-template/domain/app"
+)
+
+func TestParseQuantity(t *testing.T) {
+	now := time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC)
+	expected := time.Date(2026, time.November, 12, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		text  string
+		value app.CellValue
+		want  *app.Quantity
+		err   error
+	}{
+		{text: "", want: nil},
+		{text: "20", value: app.CellValue{Type: app.CellTypeInteger, Number: 20}, want: &app.Quantity{Amount: 20, Qualifier: app.QuantityQualifierExact, Availability: app.AvailabilityInStock}},
+		{text: "2", value: app.CellValue{Type: app.CellTypeInteger, Number: 2}, want: &app.Quantity{Amount: 2, Qualifier: app.QuantityQualifierExact, Availability: app.AvailabilityLow}},
+		{text: "1.000", want: &app.Quantity{Amount: 1000, Qualifier: app.QuantityQualifierExact, Availability: app.AvailabilityInStock}},
+		{text: ">10", want: &app.Quantity{Amount: 11, Qualifier: app.QuantityQualifierRange, Availability: app.AvailabilityInStock}},
+		{text: "до 5", want: &app.Quantity{Amount: 1, MaxAmount: 5, Qualifier: app.QuantityQualifierRange, Availability: app.AvailabilityInStock}},
+		{text: "5-10", want: &app.Quantity{Amount: 5, MaxAmount: 10, Qualifier: app.QuantityQualifierRange, Availability: app.AvailabilityInStock}},
+		{text: "++", want: &app.Quantity{Qualifier: app.QuantityQualifierUnknown, Availability: app.AvailabilityInStock}},
+		{text: "0 (ожидается 12.11)", want: &app.Quantity{Qualifier: app.QuantityQualifierExact, Availability: app.AvailabilityOnOrder, ExpectedAt: &expected}},
+		{text: "под заказ", want: &app.Quantity{Qualifier: app.QuantityQualifierUnknown, Availability: app.AvailabilityOnOrder}},
+		{text: "нет", want: &app.Quantity{Qualifier: app.QuantityQualifierUnknown, Availability: app.AvailabilityOut}},
+		{text: "-3", err: errNegativeQuantity},
+		{text: "2.5", value: app.CellValue{Type: app.CellTypeNumber, Number: 2.5}, err: errFractionalQuantity},
+		{text: "10-5", err: errInvertedStockRange},
+		{text: "уточнить", err: errNotQuantity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := parseQuantity(tt.text, tt.value, defaultStockScale, defaultLowStock, now)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			switch {
+			case got == nil && tt.want == nil:
+			case got == nil || tt.want == nil:
+				t.Errorf("quantity = %+v, want %+v", got, tt.want)
+			case got.Amount != tt.want.Amount || got.MaxAmount != tt.want.MaxAmount ||
+				got.Qualifier != tt.want.Qualifier || got.Availability != tt.want.Availability:
+				t.Errorf("quantity = %+v, want %+v", *got, *tt.want)
+			case (got.ExpectedAt == nil) != (tt.want.ExpectedAt == nil) ||
+				got.ExpectedAt != nil && !got.ExpectedAt.Equal(*tt.want.ExpectedAt):
+				t.Errorf("expected at = %v, want %v", got.ExpectedAt, tt.want.ExpectedAt)
+			}
+		})
+	}
+}
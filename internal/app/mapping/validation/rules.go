@@ -0,0 +1,156 @@
+package validation_service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/init-pkg/nova-template/domain/app"
+	normalize_service "github.com/init-pkg/nova-template/internal/app/mapping/normalize"
+	laravel_client "github.com/init-pkg/nova-template/internal/clients/laravel"
+)
+
+// Validation rules reported in row issues
+const (
+	RuleRequired     = "required"
+	RuleType         = normalize_service.IssueRuleType // also cells that cannot be normalized
+	RuleRange        = "range"
+	RuleFormat       = "format"
+	RuleLength       = "length"
+	RuleUnique       = "unique"
+	RuleDuplicateRow = "duplicate_row"
+)
+
+// Value limits
+const (
+	maxTextLen        = 255
+	maxDescriptionLen = 10000
+	maxSKULen         = 64
+	maxPlausiblePrice = 1e9
+	maxPlausibleStock = 1_000_000
+)
+
+var (
+	skuPattern  = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{N}\-_./#+]*$`)
+	slugPattern = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+)
+
+// boolValues are accepted texts of flag fields
+var boolValues = map[string]struct{}{
+	"1": {}, "0": {}, "+": {}, "-": {}, "да": {}, "нет": {}, "yes": {}, "no": {}, "true": {}, "false": {}, "истина": {}, "ложь": {},
+}
+
+// fieldValue is a non-empty cell of a row with its normalized value, if the field has one
+type fieldValue struct {
+	col      int
+	text     string
+	price    *app.Price
+	quantity *app.Quantity
+	row      rowValues // all fields of the row
+}
+
+// rowValues are the first non-empty values of every field of a row
+type rowValues map[laravel_client.ProductField]fieldValue
+
+// fieldCheck checks a value of a field. Returns nil if the value passes
+type fieldCheck func(v fieldValue) *app.RowIssue
+
+// fieldChecks are the value checks of every product field. Fields without checks accept any value
+var fieldChecks = map[laravel_client.ProductField][]fieldCheck{
+	laravel_client.ProductFieldName:        {maxLength(maxTextLen)},
+	laravel_client.ProductFieldSKU:         {checkSKU},
+	laravel_client.ProductFieldPrice:       {checkPrice},
+	laravel_client.ProductFieldDiscount:    {checkDiscount},
+	laravel_client.ProductFieldQuantity:    {checkQuantity},
+	laravel_client.ProductFieldSlug:        {checkSlug},
+	laravel_client.ProductFieldDescription: {maxLength(maxDescriptionLen)},
+	laravel_client.ProductFieldBrandID:     {maxLength(maxTextLen)},
+	laravel_client.ProductFieldCategoryID:  {maxLength(maxTextLen)},
+	laravel_client.ProductFieldIsPopular:   {checkBool},
+}
+
+func issue(rule string, severity app.IssueSeverity, format string, args ...any) *app.RowIssue {
+	return &app.RowIssue{Rule: rule, Severity: severity, Message: fmt.Sprintf(format, args...)}
+}
+
+func maxLength(limit int) fieldCheck {
+	return func(v fieldValue) *app.RowIssue {
+		if n := utf8.RuneCountInString(v.text); n > limit {
+			return issue(RuleLength, app.IssueSeverityWarning, "value of %d characters is longer than %d and may be cut", n, limit)
+		}
+		return nil
+	}
+}
+
+func checkSKU(v fieldValue) *app.RowIssue {
+	if utf8.RuneCountInString(v.text) > maxSKULen {
+		return issue(RuleLength, app.IssueSeverityError, "SKU is longer than %d characters", maxSKULen)
+	}
+	if !skuPattern.MatchString(v.text) {
+		return issue(RuleFormat, app.IssueSeverityError, "SKU must be a single token of letters, digits and -_./#+")
+	}
+
+	return nil
+}
+
+func checkPrice(v fieldValue) *app.RowIssue {
+	switch p := v.price; {
+	case p == nil:
+		return nil
+	case p.Qualifier == app.PriceQualifierOnRequest:
+		return issue(RuleRange, app.IssueSeverityWarning, "price on request, the product is imported without a price")
+	case p.Percent:
+		return issue(RuleType, app.IssueSeverityError, "price is a percentage")
+	case p.Amount == 0:
+		return issue(RuleRange, app.IssueSeverityError, "zero price")
+	case p.Amount > maxPlausiblePrice || p.MaxAmount > maxPlausiblePrice:
+		return issue(RuleRange, app.IssueSeverityWarning, "price above %.0f is suspicious", maxPlausiblePrice)
+	}
+
+	return nil
+}
+
+func checkDiscount(v fieldValue) *app.RowIssue {
+	d := v.price
+	if d == nil {
+		return nil
+	}
+	if d.Percent {
+		if d.Amount > 1 {
+			return issue(RuleRange, app.IssueSeverityError, "discount above 100%%")
+		}
+		return nil
+	}
+
+	p := v.row[laravel_client.ProductFieldPrice].price
+	if p != nil && p.Qualifier == app.PriceQualifierExact && (d.Currency == "" || p.Currency == "" || d.Currency == p.Currency) && d.Amount > p.Amount {
+		return issue(RuleRange, app.IssueSeverityError, "discount %.2f is above the price %.2f", d.Amount, p.Amount)
+	}
+
+	return nil
+}
+
+func checkQuantity(v fieldValue) *app.RowIssue {
+	if q := v.quantity; q != nil && max(q.Amount, q.MaxAmount) > maxPlausibleStock {
+		return issue(RuleRange, app.IssueSeverityWarning, "quantity above %d is suspicious", maxPlausibleStock)
+	}
+
+	return nil
+}
+
+func checkSlug(v fieldValue) *app.RowIssue {
+	if !slugPattern.MatchString(v.text) {
+		return issue(RuleFormat, app.IssueSeverityWarning, "slug must be lowercase latin letters and digits separated by dashes, it will be regenerated")
+	}
+
+	return nil
+}
+
+func checkBool(v fieldValue) *app.RowIssue {
+	if _, ok := boolValues[strings.ToLower(v.text)]; !ok {
+		return issue(RuleType, app.IssueSeverityWarning, "not a yes/no value, the flag is left unset")
+	}
+
+	return nil
+}
@@ -0,0 +1,263 @@
+package validation_service
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/init-pkg/nova-template/domain/app"
+	laravel_client "github.com/init-pkg/nova-template/internal/clients/laravel"
+	"github.com/init-pkg/nova-template/internal/config"
+)
+
+const defaultMaxInvalidShare = 0.5
+
+var defaultRequiredFields = []laravel_client.ProductField{
+	laravel_client.ProductFieldName,
+	laravel_client.ProductFieldSKU,
+	laravel_client.ProductFieldPrice,
+}
+
+// Service checks the rows of mapped tables against the rules of their product fields
+type Service struct {
+	required        []laravel_client.ProductField
+	maxInvalidShare float64
+}
+
+func New(cfg *config.Config) *Service {
+	return &Service{
+		required:        requiredFieldsFromConfig(cfg.Internal.Validation.Required),
+		maxInvalidShare: maxInvalidShareFromConfig(cfg.Internal.Validation.MaxInvalidShare),
+	}
+}
+
+// requiredFieldsFromConfig keeps the known product fields, falling back to the default ones
+func requiredFieldsFromConfig(values []string) []laravel_client.ProductField {
+	var fields []laravel_client.ProductField
+	for _, value := range values {
+		if field := laravel_client.ProductField(value); field.IsValid() && field != laravel_client.ProductFieldUnknown {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) == 0 {
+		return defaultRequiredFields
+	}
+
+	return fields
+}
+
+func maxInvalidShareFromConfig(value float64) float64 {
+	if value <= 0 || value > 1 {
+		return defaultMaxInvalidShare
+	}
+
+	return value
+}
+
+// Validate checks every row of a table whose header is mapped to product fields.
+// values are the normalized values of the table, their issues are reported as row errors
+func (this *Service) Validate(r *app.ParseExcelResult, values *app.NormalizedValues) *app.RowValidation {
+	res := &app.RowValidation{Rows: make([]app.RowCheck, len(r.Rows))}
+	for i := range res.Rows {
+		res.Rows[i].Row = i
+		if i < len(r.SourceRows) {
+			res.Rows[i].SourceRow = r.SourceRows[i]
+		}
+	}
+
+	var missing []string
+	for _, field := range this.required {
+		if !slices.Contains(r.Header, field.String()) {
+			missing = append(missing, field.String())
+		}
+	}
+
+	if values != nil {
+		for _, issue := range values.Issues {
+			if issue.Row >= 0 && issue.Row < len(res.Rows) {
+				addIssue(&res.Rows[issue.Row], issue)
+			}
+		}
+	}
+
+	skus := make(map[string]int)
+	seen := make(map[string]int)
+	for i := range r.Rows {
+		check := &res.Rows[i]
+		row := rowValuesOf(r, values, i)
+
+		for _, field := range this.required {
+			if _, ok := row[field]; ok || slices.Contains(missing, field.String()) || hasIssue(check, field) {
+				continue
+			}
+			addIssue(check, app.RowIssue{
+				Row:      i,
+				Cell:     firstCellRef(r, i, field),
+				Field:    field.String(),
+				Rule:     RuleRequired,
+				Severity: app.IssueSeverityError,
+				Message:  fmt.Sprintf("%s is required", field),
+			})
+		}
+
+		for _, field := range laravel_client.AllProductFields() {
+			v, ok := row[field]
+			if !ok {
+				continue
+			}
+			for _, fieldCheck := range fieldChecks[field] {
+				if issue := fieldCheck(v); issue != nil {
+					issue.Row, issue.Cell, issue.Field, issue.Value = i, r.CellRef(i, v.col), field.String(), v.text
+					addIssue(check, *issue)
+				}
+			}
+		}
+
+		if v, ok := row[laravel_client.ProductFieldSKU]; ok {
+			key := strings.ToLower(v.text)
+			if first, dup := skus[key]; dup {
+				addIssue(check, app.RowIssue{
+					Row:      i,
+					Cell:     r.CellRef(i, v.col),
+					Field:    laravel_client.ProductFieldSKU.String(),
+					Value:    v.text,
+					Rule:     RuleUnique,
+					Severity: app.IssueSeverityError,
+					Message:  fmt.Sprintf("SKU is already used by row %s", rowRef(r, first)),
+				})
+			} else {
+				skus[key] = i
+			}
+		}
+
+		key := strings.Join(r.Rows[i], "\x1f")
+		if first, dup := seen[key]; dup {
+			addIssue(check, app.RowIssue{
+				Row:      i,
+				Rule:     RuleDuplicateRow,
+				Severity: app.IssueSeverityWarning,
+				Message:  fmt.Sprintf("same as row %s", rowRef(r, first)),
+			})
+		} else {
+			seen[key] = i
+		}
+	}
+
+	res.Summary = this.summarize([]*app.RowValidation{res}, missing)
+	return res
+}
+
+// Summarize counts the validations of all tables of a job and decides whether to import the file
+func (this *Service) Summarize(validations []*app.RowValidation) app.ValidationSummary {
+	var missing []string
+	for _, v := range validations {
+		for _, field := range v.Summary.MissingFields {
+			if !slices.Contains(missing, field) {
+				missing = append(missing, field)
+			}
+		}
+	}
+
+	return this.summarize(validations, missing)
+}
+
+func (this *Service) summarize(validations []*app.RowValidation, missing []string) app.ValidationSummary {
+	summary := app.ValidationSummary{Tables: len(validations), ByRule: make(map[string]int), MissingFields: missing}
+	for _, v := range validations {
+		for _, check := range v.Rows {
+			summary.Rows++
+			if check.IsValid() {
+				summary.ValidRows++
+			} else {
+				summary.InvalidRows++
+			}
+			summary.Errors += len(check.Errors)
+			summary.Warnings += len(check.Warnings)
+			for _, issue := range check.Errors {
+				summary.ByRule[issue.Rule]++
+			}
+			for _, issue := range check.Warnings {
+				summary.ByRule[issue.Rule]++
+			}
+		}
+	}
+
+	switch {
+	case len(missing) > 0 || summary.ValidRows == 0:
+		summary.Decision = app.ImportDecisionReject
+	case float64(summary.InvalidRows)/float64(summary.Rows) > this.maxInvalidShare:
+		summary.Decision = app.ImportDecisionReject
+	case summary.InvalidRows > 0:
+		summary.Decision = app.ImportDecisionPartial
+	default:
+		summary.Decision = app.ImportDecisionAccept
+	}
+
+	return summary
+}
+
+// rowValuesOf collects the first non-empty value of every mapped field of a row
+func rowValuesOf(r *app.ParseExcelResult, values *app.NormalizedValues, row int) rowValues {
+	res := make(rowValues)
+	for col, header := range r.Header {
+		field := laravel_client.ProductField(header)
+		if _, ok := res[field]; ok || col >= len(r.Rows[row]) {
+			continue
+		}
+
+		v := fieldValue{col: col, text: strings.TrimSpace(r.Rows[row][col]), row: res}
+		if values != nil {
+			if prices := values.Prices[header]; row < len(prices) {
+				v.price = prices[row]
+			}
+			if field == laravel_client.ProductFieldQuantity && row < len(values.Quantities) {
+				v.quantity = values.Quantities[row]
+			}
+		}
+		// Normalized fields count only with a normalized value, invalid cells are reported by the normalizer
+		if v.text == "" || (values != nil && isNormalized(field) && v.price == nil && v.quantity == nil) {
+			continue
+		}
+		res[field] = v
+	}
+
+	return res
+}
+
+func isNormalized(field laravel_client.ProductField) bool {
+	switch field {
+	case laravel_client.ProductFieldPrice, laravel_client.ProductFieldDiscount, laravel_client.ProductFieldQuantity:
+		return true
+	default:
+		return false
+	}
+}
+
+func addIssue(check *app.RowCheck, issue app.RowIssue) {
+	if issue.Severity == app.IssueSeverityWarning {
+		check.Warnings = append(check.Warnings, issue)
+	} else {
+		check.Errors = append(check.Errors, issue)
+	}
+}
+
+func hasIssue(check *app.RowCheck, field laravel_client.ProductField) bool {
+	return slices.ContainsFunc(check.Errors, func(issue app.RowIssue) bool {
+		return issue.Field == field.String()
+	})
+}
+
+// firstCellRef references the first column of the field in the row
+func firstCellRef(r *app.ParseExcelResult, row int, field laravel_client.ProductField) string {
+	return r.CellRef(row, slices.Index(r.Header, field.String()))
+}
+
+// rowRef references a row by its sheet row number, or by its index when the source is unknown
+func rowRef(r *app.ParseExcelResult, row int) string {
+	if row < len(r.SourceRows) {
+		return strconv.Itoa(r.SourceRows[row])
+	}
+
+	return fmt.Sprintf("#%d", row+1)
+}
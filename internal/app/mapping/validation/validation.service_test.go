@@ -0,0 +1,125 @@
+package validation_service
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/init-pkg/nova-template/domain/app"
+	laravel_client "github.com/init-pkg/nova-template/internal/clients/laravel"
+	"github.com/init-pkg/nova-template/internal/config"
+)
+
+var (
+	name  = laravel_client.ProductFieldName.String()
+	sku   = laravel_client.ProductFieldSKU.String()
+	price = laravel_client.ProductFieldPrice.String()
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      []string
+		rows        [][]string
+		decision    app.ImportDecision
+		invalidRows int
+		missing     []string
+		rules       map[string]int
+	}{
+		{
+			name:     "valid rows",
+			header:   []string{name, sku, price},
+			rows:     [][]string{{"Болт", "A1", "10"}, {"Гайка", "A2", "20"}},
+			decision: app.ImportDecisionAccept,
+		},
+		{
+			name:     "missing required column",
+			header:   []string{name, sku},
+			rows:     [][]string{{"Болт", "A1"}, {"Гайка", "A2"}},
+			decision: app.ImportDecisionReject,
+			missing:  []string{price},
+		},
+		{
+			name:        "few invalid rows",
+			header:      []string{name, sku, price},
+			rows:        [][]string{{"Болт", "A1", "10"}, {"Гайка", "", "20"}, {"Шайба", "A3", "3"}},
+			decision:    app.ImportDecisionPartial,
+			invalidRows: 1,
+			rules:       map[string]int{RuleRequired: 1},
+		},
+		{
+			name:        "mostly invalid rows",
+			header:      []string{name, sku, price},
+			rows:        [][]string{{"Болт", "A1", "10"}, {"Гайка", "A1", "20"}, {"Шайба", "A 3", "3"}},
+			decision:    app.ImportDecisionReject,
+			invalidRows: 2,
+			rules:       map[string]int{RuleUnique: 1, RuleFormat: 1},
+		},
+		{
+			name:     "duplicate row is a warning",
+			header:   []string{name, sku, price},
+			rows:     [][]string{{"Болт", "A1", "10"}, {"Гайка", "A2", "20"}, {"Гайка", "A2", "20"}},
+			decision: app.ImportDecisionPartial,
+			// the repeated SKU is an error of the same row
+			invalidRows: 1,
+			rules:       map[string]int{RuleUnique: 1, RuleDuplicateRow: 1},
+		},
+	}
+
+	s := New(&config.Config{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := s.Validate(&app.ParseExcelResult{Header: tt.header, Rows: tt.rows}, nil)
+			summary := res.Summary
+
+			if summary.Decision != tt.decision {
+				t.Errorf("decision = %s, want %s", summary.Decision, tt.decision)
+			}
+			if summary.Rows != len(tt.rows) || summary.InvalidRows != tt.invalidRows {
+				t.Errorf("invalid rows = %d of %d, want %d of %d", summary.InvalidRows, summary.Rows, tt.invalidRows, len(tt.rows))
+			}
+			if !slices.Equal(summary.MissingFields, tt.missing) {
+				t.Errorf("missing fields = %v, want %v", summary.MissingFields, tt.missing)
+			}
+			for rule, n := range tt.rules {
+				if summary.ByRule[rule] != n {
+					t.Errorf("%s issues = %d, want %d", rule, summary.ByRule[rule], n)
+				}
+			}
+		})
+	}
+}
+
+// rowChecks builds a validation of valid and invalid rows
+func rowChecks(valid, invalid int) *app.RowValidation {
+	v := &app.RowValidation{Rows: make([]app.RowCheck, valid+invalid)}
+	for i := valid; i < len(v.Rows); i++ {
+		v.Rows[i].Errors = []app.RowIssue{{Row: i, Rule: RuleRequired, Severity: app.IssueSeverityError}}
+	}
+
+	return v
+}
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		name        string
+		validations []*app.RowValidation
+		missing     []string
+		want        app.ImportDecision
+	}{
+		{name: "all valid", validations: []*app.RowValidation{rowChecks(3, 0), rowChecks(2, 0)}, want: app.ImportDecisionAccept},
+		{name: "invalid share at the limit", validations: []*app.RowValidation{rowChecks(2, 0), rowChecks(0, 2)}, want: app.ImportDecisionPartial},
+		{name: "invalid share above the limit", validations: []*app.RowValidation{rowChecks(1, 0), rowChecks(0, 2)}, want: app.ImportDecisionReject},
+		{name: "missing field", validations: []*app.RowValidation{rowChecks(3, 0)}, missing: []string{price}, want: app.ImportDecisionReject},
+		{name: "no valid rows", validations: []*app.RowValidation{rowChecks(0, 1)}, want: app.ImportDecisionReject},
+		{name: "no rows", validations: nil, want: app.ImportDecisionReject},
+	}
+
+	s := New(&config.Config{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.summarize(tt.validations, tt.missing).Decision; got != tt.want {
+				t.Errorf("decision = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/init-pkg/nova-template/internal/config"
 	"github.com/openai/openai-go/v2"
 	"github.com/opensearch-project/opensearch-go/v4/opensearchapi"
 )
@@ -25,12 +27,14 @@ type Service struct {
 	categoryIndex    string
 	brandIndex       string
 	embeddingModel   string
+	timeout          time.Duration // на один поиск: эмбеддинг и запрос к индексу
 }
 
 // NewService создает новый экземпляр Service
 func New(
 	openaiClient *openai.Client,
 	opensearchClient *opensearchapi.Client,
+	cfg *config.Config,
 ) *Service {
 	return &Service{
 		openaiClient:     openaiClient,
@@ -38,6 +42,7 @@ func New(
 		categoryIndex:    "categories",
 		brandIndex:       "brands",
 		embeddingModel:   openai.EmbeddingModelTextEmbedding3Small,
+		timeout:          config.Timeout(cfg.Internal.Timeouts.SemanticSearch, 10*time.Second),
 	}
 }
 
@@ -120,6 +125,9 @@ func (s *Service) FindBestCategory(ctx context.Context, name string) (*SearchRes
 		return nil, errors.New("category name cannot be empty")
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
 	// Генерируем эмбеддинг
 	embedding, err := s.generateEmbedding(ctx, name)
 	if err != nil {
@@ -146,6 +154,9 @@ func (s *Service) FindBestBrand(ctx context.Context, name string) (*SearchResult
 		return nil, errors.New("brand name cannot be empty")
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
 	// Генерируем эмбеддинг
 	embedding, err := s.generateEmbedding(ctx, name)
 	if err != nil {
@@ -172,6 +183,9 @@ func (s *Service) FindMultipleCategories(ctx context.Context, name string, limit
 		return nil, errors.New("category name cannot be empty")
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
 	embedding, err := s.generateEmbedding(ctx, name)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate embedding for category '%s': %w", name, err)
@@ -191,6 +205,9 @@ func (s *Service) FindMultipleBrands(ctx context.Context, name string, limit int
 		return nil, errors.New("brand name cannot be empty")
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
 	embedding, err := s.generateEmbedding(ctx, name)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate embedding for brand '%s': %w", name, err)
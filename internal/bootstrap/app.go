@@ -4,6 +4,8 @@ import (
 	excel_parser_module "github.com/init-pkg/nova-template/internal/app/excel-parser"
 	mapping_service "github.com/init-pkg/nova-template/internal/app/mapping/general"
 	header_mapping_service "github.com/init-pkg/nova-template/internal/app/mapping/header"
+	normalize_service "github.com/init-pkg/nova-template/internal/app/mapping/normalize"
+	validation_service "github.com/init-pkg/nova-template/internal/app/mapping/validation"
 	semantic_search_service "github.com/init-pkg/nova-template/internal/app/semantic-search"
 	"go.uber.org/fx"
 )
@@ -16,6 +18,8 @@ func appOptions() fx.Option {
 			semantic_search_service.New,
 			mapping_service.New,
 			header_mapping_service.New,
+			normalize_service.New,
+			validation_service.New,
 		),
 
 		// test
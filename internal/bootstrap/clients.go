@@ -2,6 +2,7 @@ package bootstrap
 
 import (
 	laravel_client "github.com/init-pkg/nova-template/internal/clients/laravel"
+	llm_client "github.com/init-pkg/nova-template/internal/clients/llm"
 	openai_client "github.com/init-pkg/nova-template/internal/clients/openai"
 	opensearch_client "github.com/init-pkg/nova-template/internal/clients/opensearch"
 	"go.uber.org/fx"
@@ -11,6 +12,7 @@ func clientsOptions() fx.Option {
 	return fx.Options(
 		fx.Provide(
 			openai_client.New,
+			llm_client.New,
 			opensearch_client.New,
 			laravel_client.New,
 		),
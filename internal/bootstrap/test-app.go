@@ -3,7 +3,6 @@ package bootstrap
 import (
 	"encoding/json"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
@@ -31,28 +30,15 @@ func (this *suite) run(filename string) {
 		return
 	}
 
+	// .xls читается парсером нативно, конвертация не нужна
 	inputPath := filepath.Join(".", "resources", "test-data", "excel", filename)
 
-	// Автоматическая конвертация .xls -> .xlsx
-	if strings.HasSuffix(strings.ToLower(filename), ".xls") {
-		xlsxName := strings.TrimSuffix(filename, filepath.Ext(filename)) + ".xlsx"
-		xlsxPath := filepath.Join(".", "resources", "test-data", "excel", xlsxName)
-		// Если xlsx уже существует, не конвертируем
-		if _, err := os.Stat(xlsxPath); os.IsNotExist(err) {
-			cmd := exec.Command("libreoffice", "--headless", "--convert-to", "xlsx", inputPath, "--outdir", filepath.Dir(inputPath))
-			if err := cmd.Run(); err != nil {
-				panic("LibreOffice conversion failed: " + err.Error())
-			}
-		}
-		inputPath = xlsxPath
-	}
-
 	f, err := os.ReadFile(inputPath)
 	if err != nil {
 		panic(err)
 	}
 
-	res, err := this.parseExcelService.Parse(nova_ctx.New(), f)
+	res, err := this.parseExcelService.Parse(nova_ctx.New(), f, app.ParseOptions{})
 	if err != nil {
 		panic(err)
 	}
@@ -2,6 +2,7 @@ package laravel_client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -110,7 +111,7 @@ type QueryParams struct {
 
 func New(cfg *config.Config) *LaravelClient {
 	client := &http.Client{
-		Timeout: 30 * time.Second,
+		Timeout: config.Timeout(cfg.Internal.Timeouts.Laravel, 30*time.Second),
 	}
 
 	return &LaravelClient{
@@ -120,7 +121,7 @@ func New(cfg *config.Config) *LaravelClient {
 }
 
 // MarkJobSuccess - отмечает задачу как успешно выполненную
-func (this *LaravelClient) MarkJobSuccess(jobID uint64, notes string, resultData map[string]string) errs.Error {
+func (this *LaravelClient) MarkJobSuccess(ctx context.Context, jobID uint64, notes string, resultData map[string]string) errs.Error {
 	url := fmt.Sprintf("%s/api/excel-jobs/mark-success", this.url)
 
 	payload := SuccessRequest{
@@ -131,32 +132,32 @@ func (this *LaravelClient) MarkJobSuccess(jobID uint64, notes string, resultData
 
 	jsonData, e := json.Marshal(payload)
 	if e != nil {
-		return errs.WrapAppError(e, &errs.ErrorOpts{})
+		return errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 
-	req, e := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, e := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if e != nil {
-		return errs.WrapAppError(e, &errs.ErrorOpts{})
+		return errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 
 	res, e := this.client.Do(req)
 	if e != nil {
-		return errs.WrapAppError(e, &errs.ErrorOpts{})
+		return errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != 200 {
 		body, _ := io.ReadAll(res.Body)
-		return errs.WrapAppError(fmt.Errorf("API error %d: %s", res.StatusCode, string(body)), &errs.ErrorOpts{})
+		return errs.WrapAppError(fmt.Errorf("API error %d: %s", res.StatusCode, string(body)), &errs.ErrorOpts{Ctx: ctx})
 	}
 
 	return nil
 }
 
 // MarkJobFailed - отмечает задачу как неудачную
-func (this *LaravelClient) MarkJobFailed(jobID uint64, errorMessage string) errs.Error {
+func (this *LaravelClient) MarkJobFailed(ctx context.Context, jobID uint64, errorMessage string) errs.Error {
 	url := fmt.Sprintf("%s/api/excel-jobs/mark-error", this.url)
 
 	payload := ErrorRequest{
@@ -166,32 +167,32 @@ func (this *LaravelClient) MarkJobFailed(jobID uint64, errorMessage string) errs
 
 	js, e := json.Marshal(payload)
 	if e != nil {
-		return errs.WrapAppError(e, &errs.ErrorOpts{})
+		return errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 
-	req, e := http.NewRequest("POST", url, bytes.NewBuffer(js))
+	req, e := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(js))
 	if e != nil {
-		return errs.WrapAppError(e, &errs.ErrorOpts{})
+		return errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 
 	res, e := this.client.Do(req)
 	if e != nil {
-		return errs.WrapAppError(e, &errs.ErrorOpts{})
+		return errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != 200 {
 		body, _ := io.ReadAll(res.Body)
-		return errs.WrapAppError(fmt.Errorf("API error %d: %s", res.StatusCode, string(body)), &errs.ErrorOpts{})
+		return errs.WrapAppError(fmt.Errorf("API error %d: %s", res.StatusCode, string(body)), &errs.ErrorOpts{Ctx: ctx})
 	}
 
 	return nil
 }
 
 // UpdateJobStatus - обновляет статус задачи в очереди
-func (this *LaravelClient) UpdateJobStatus(jobID uint64, status string) errs.Error {
+func (this *LaravelClient) UpdateJobStatus(ctx context.Context, jobID uint64, status string) errs.Error {
 	url := fmt.Sprintf("%s/api/excel-jobs/update-status", this.url)
 
 	payload := UpdateStatusRequest{
@@ -201,50 +202,50 @@ func (this *LaravelClient) UpdateJobStatus(jobID uint64, status string) errs.Err
 
 	jsonData, e := json.Marshal(payload)
 	if e != nil {
-		return errs.WrapAppError(e, &errs.ErrorOpts{})
+		return errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 
-	req, e := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, e := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if e != nil {
-		return errs.WrapAppError(e, &errs.ErrorOpts{})
+		return errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 
 	res, e := this.client.Do(req)
 	if e != nil {
-		return errs.WrapAppError(e, &errs.ErrorOpts{})
+		return errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != 200 {
 		body, _ := io.ReadAll(res.Body)
-		return errs.WrapAppError(fmt.Errorf("API error %d: %s", res.StatusCode, string(body)), &errs.ErrorOpts{})
+		return errs.WrapAppError(fmt.Errorf("API error %d: %s", res.StatusCode, string(body)), &errs.ErrorOpts{Ctx: ctx})
 	}
 
 	return nil
 }
 
 // GetProductMappings - получает маппинги товаров с query параметрами
-func (this *LaravelClient) GetProductMappings(params *QueryParams) ([]ProductMappingResponse, errs.Error) {
+func (this *LaravelClient) GetProductMappings(ctx context.Context, params *QueryParams) ([]ProductMappingResponse, errs.Error) {
 	url := fmt.Sprintf("%s/api/excel-mappings/products", this.url)
-	return this.getProductMappingsWithParams(url, params)
+	return this.getProductMappingsWithParams(ctx, url, params)
 }
 
 // GetCategoryMappings - получает маппинги категорий с query параметрами
-func (this *LaravelClient) GetCategoryMappings(params *QueryParams) ([]CategoryMappingResponse, errs.Error) {
+func (this *LaravelClient) GetCategoryMappings(ctx context.Context, params *QueryParams) ([]CategoryMappingResponse, errs.Error) {
 	url := fmt.Sprintf("%s/api/excel-mappings/categories", this.url)
-	return this.getCategoryMappingsWithParams(url, params)
+	return this.getCategoryMappingsWithParams(ctx, url, params)
 }
 
 // GetBrandMappings - получает маппинги брендов с query параметрами
-func (this *LaravelClient) GetBrandMappings(params *QueryParams) ([]BrandMappingResponse, errs.Error) {
+func (this *LaravelClient) GetBrandMappings(ctx context.Context, params *QueryParams) ([]BrandMappingResponse, errs.Error) {
 	url := fmt.Sprintf("%s/api/excel-mappings/brands", this.url)
-	return this.getBrandMappingsWithParams(url, params)
+	return this.getBrandMappingsWithParams(ctx, url, params)
 }
 
 // CreateProductMappings - создает маппинги товаров
-func (this *LaravelClient) CreateProductMappings(mappings []ProductMapping, supplierID *uint64) errs.Error {
+func (this *LaravelClient) CreateProductMappings(ctx context.Context, mappings []ProductMapping, supplierID *uint64) errs.Error {
 	url := fmt.Sprintf("%s/api/excel-mappings/products", this.url)
 
 	payload := CreateProductMappingsRequest{
@@ -252,11 +253,11 @@ func (this *LaravelClient) CreateProductMappings(mappings []ProductMapping, supp
 		SupplierID: supplierID,
 	}
 
-	return this.createMappings(url, payload)
+	return this.createMappings(ctx, url, payload)
 }
 
 // CreateCategoryMappings - создает маппинги категорий
-func (this *LaravelClient) CreateCategoryMappings(mappings []CategoryMapping, supplierID *uint64) errs.Error {
+func (this *LaravelClient) CreateCategoryMappings(ctx context.Context, mappings []CategoryMapping, supplierID *uint64) errs.Error {
 	url := fmt.Sprintf("%s/api/excel-mappings/categories", this.url)
 
 	payload := CreateCategoryMappingsRequest{
@@ -264,11 +265,11 @@ func (this *LaravelClient) CreateCategoryMappings(mappings []CategoryMapping, su
 		SupplierID: supplierID,
 	}
 
-	return this.createMappings(url, payload)
+	return this.createMappings(ctx, url, payload)
 }
 
 // CreateBrandMappings - создает маппинги брендов
-func (this *LaravelClient) CreateBrandMappings(mappings []BrandMapping, supplierID *uint64) errs.Error {
+func (this *LaravelClient) CreateBrandMappings(ctx context.Context, mappings []BrandMapping, supplierID *uint64) errs.Error {
 	url := fmt.Sprintf("%s/api/excel-mappings/brands", this.url)
 
 	payload := CreateBrandMappingsRequest{
@@ -276,14 +277,14 @@ func (this *LaravelClient) CreateBrandMappings(mappings []BrandMapping, supplier
 		SupplierID: supplierID,
 	}
 
-	return this.createMappings(url, payload)
+	return this.createMappings(ctx, url, payload)
 }
 
 // Вспомогательные методы
-func (this *LaravelClient) getProductMappingsWithParams(baseURL string, params *QueryParams) ([]ProductMappingResponse, errs.Error) {
+func (this *LaravelClient) getProductMappingsWithParams(ctx context.Context, baseURL string, params *QueryParams) ([]ProductMappingResponse, errs.Error) {
 	parsedURL, e := url.Parse(baseURL)
 	if e != nil {
-		return nil, errs.WrapAppError(e, &errs.ErrorOpts{})
+		return nil, errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 
 	query := parsedURL.Query()
@@ -302,36 +303,36 @@ func (this *LaravelClient) getProductMappingsWithParams(baseURL string, params *
 
 	parsedURL.RawQuery = query.Encode()
 
-	req, e := http.NewRequest("GET", parsedURL.String(), nil)
+	req, e := http.NewRequestWithContext(ctx, "GET", parsedURL.String(), nil)
 	if e != nil {
-		return nil, errs.WrapAppError(e, &errs.ErrorOpts{})
+		return nil, errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 
 	req.Header.Set("Accept", "application/json")
 
 	res, e := this.client.Do(req)
 	if e != nil {
-		return nil, errs.WrapAppError(e, &errs.ErrorOpts{})
+		return nil, errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != 200 {
 		body, _ := io.ReadAll(res.Body)
-		return nil, errs.WrapAppError(fmt.Errorf("API error %d: %s", res.StatusCode, string(body)), &errs.ErrorOpts{})
+		return nil, errs.WrapAppError(fmt.Errorf("API error %d: %s", res.StatusCode, string(body)), &errs.ErrorOpts{Ctx: ctx})
 	}
 
 	var apiResp APIResponse[[]ProductMappingResponse]
 	if e := json.NewDecoder(res.Body).Decode(&apiResp); e != nil {
-		return nil, errs.WrapAppError(e, &errs.ErrorOpts{})
+		return nil, errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 
 	return apiResp.Data, nil
 }
 
-func (this *LaravelClient) getCategoryMappingsWithParams(baseURL string, params *QueryParams) ([]CategoryMappingResponse, errs.Error) {
+func (this *LaravelClient) getCategoryMappingsWithParams(ctx context.Context, baseURL string, params *QueryParams) ([]CategoryMappingResponse, errs.Error) {
 	parsedURL, e := url.Parse(baseURL)
 	if e != nil {
-		return nil, errs.WrapAppError(e, &errs.ErrorOpts{})
+		return nil, errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 
 	query := parsedURL.Query()
@@ -350,36 +351,36 @@ func (this *LaravelClient) getCategoryMappingsWithParams(baseURL string, params
 
 	parsedURL.RawQuery = query.Encode()
 
-	req, e := http.NewRequest("GET", parsedURL.String(), nil)
+	req, e := http.NewRequestWithContext(ctx, "GET", parsedURL.String(), nil)
 	if e != nil {
-		return nil, errs.WrapAppError(e, &errs.ErrorOpts{})
+		return nil, errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 
 	req.Header.Set("Accept", "application/json")
 
 	res, e := this.client.Do(req)
 	if e != nil {
-		return nil, errs.WrapAppError(e, &errs.ErrorOpts{})
+		return nil, errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != 200 {
 		body, _ := io.ReadAll(res.Body)
-		return nil, errs.WrapAppError(fmt.Errorf("API error %d: %s", res.StatusCode, string(body)), &errs.ErrorOpts{})
+		return nil, errs.WrapAppError(fmt.Errorf("API error %d: %s", res.StatusCode, string(body)), &errs.ErrorOpts{Ctx: ctx})
 	}
 
 	var apiResp APIResponse[[]CategoryMappingResponse]
 	if e := json.NewDecoder(res.Body).Decode(&apiResp); e != nil {
-		return nil, errs.WrapAppError(e, &errs.ErrorOpts{})
+		return nil, errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 
 	return apiResp.Data, nil
 }
 
-func (this *LaravelClient) getBrandMappingsWithParams(baseURL string, params *QueryParams) ([]BrandMappingResponse, errs.Error) {
+func (this *LaravelClient) getBrandMappingsWithParams(ctx context.Context, baseURL string, params *QueryParams) ([]BrandMappingResponse, errs.Error) {
 	parsedURL, e := url.Parse(baseURL)
 	if e != nil {
-		return nil, errs.WrapAppError(e, &errs.ErrorOpts{})
+		return nil, errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 
 	query := parsedURL.Query()
@@ -398,54 +399,54 @@ func (this *LaravelClient) getBrandMappingsWithParams(baseURL string, params *Qu
 
 	parsedURL.RawQuery = query.Encode()
 
-	req, e := http.NewRequest("GET", parsedURL.String(), nil)
+	req, e := http.NewRequestWithContext(ctx, "GET", parsedURL.String(), nil)
 	if e != nil {
-		return nil, errs.WrapAppError(e, &errs.ErrorOpts{})
+		return nil, errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 
 	req.Header.Set("Accept", "application/json")
 
 	res, e := this.client.Do(req)
 	if e != nil {
-		return nil, errs.WrapAppError(e, &errs.ErrorOpts{})
+		return nil, errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != 200 {
 		body, _ := io.ReadAll(res.Body)
-		return nil, errs.WrapAppError(fmt.Errorf("API error %d: %s", res.StatusCode, string(body)), &errs.ErrorOpts{})
+		return nil, errs.WrapAppError(fmt.Errorf("API error %d: %s", res.StatusCode, string(body)), &errs.ErrorOpts{Ctx: ctx})
 	}
 
 	var apiResp APIResponse[[]BrandMappingResponse]
 	if e := json.NewDecoder(res.Body).Decode(&apiResp); e != nil {
-		return nil, errs.WrapAppError(e, &errs.ErrorOpts{})
+		return nil, errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 
 	return apiResp.Data, nil
 }
 
-func (this *LaravelClient) createMappings(url string, payload interface{}) errs.Error {
+func (this *LaravelClient) createMappings(ctx context.Context, url string, payload interface{}) errs.Error {
 	jsonData, e := json.Marshal(payload)
 	if e != nil {
-		return errs.WrapAppError(e, &errs.ErrorOpts{})
+		return errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 
-	req, e := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, e := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if e != nil {
-		return errs.WrapAppError(e, &errs.ErrorOpts{})
+		return errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 
 	res, e := this.client.Do(req)
 	if e != nil {
-		return errs.WrapAppError(e, &errs.ErrorOpts{})
+		return errs.WrapAppError(e, &errs.ErrorOpts{Ctx: ctx})
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != 201 {
 		body, _ := io.ReadAll(res.Body)
-		return errs.WrapAppError(fmt.Errorf("API error %d: %s", res.StatusCode, string(body)), &errs.ErrorOpts{})
+		return errs.WrapAppError(fmt.Errorf("API error %d: %s", res.StatusCode, string(body)), &errs.ErrorOpts{Ctx: ctx})
 	}
 
 	return nil
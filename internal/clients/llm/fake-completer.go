@@ -0,0 +1,73 @@
+package llm_client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/init-pkg/nova-template/domain/app"
+)
+
+var ErrNoFakeResponse = errors.New("no fake response for the task")
+
+// FakeCompleter answers every task with a fixed JSON response and records requests.
+// It is deterministic and needs no network, tasks without a response fail with ErrNoFakeResponse
+// so that callers take their fallback paths
+type FakeCompleter struct {
+	mu        sync.Mutex
+	responses map[app.LLMTask]string
+	requests  []app.CompletionRequest
+}
+
+var _ app.StructuredCompleter = &FakeCompleter{}
+
+func NewFake(responses map[app.LLMTask]string) *FakeCompleter {
+	var fake = &FakeCompleter{responses: make(map[app.LLMTask]string, len(responses))}
+	for task, resp := range responses {
+		fake.responses[task] = resp
+	}
+
+	return fake
+}
+
+// Respond sets the JSON response of the task
+func (this *FakeCompleter) Respond(task app.LLMTask, response string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.responses[task] = response
+}
+
+// Requests returns the requests received so far
+func (this *FakeCompleter) Requests() []app.CompletionRequest {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	return append([]app.CompletionRequest(nil), this.requests...)
+}
+
+func (this *FakeCompleter) Complete(ctx context.Context, req app.CompletionRequest, out any) error {
+	this.mu.Lock()
+	this.requests = append(this.requests, req)
+	resp, ok := this.responses[req.Task]
+	this.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("llm %s: %w", req.Task, ErrNoFakeResponse)
+	}
+
+	if err := json.Unmarshal([]byte(resp), out); err != nil {
+		return fmt.Errorf("llm %s: unmarshal fake response: %w", req.Task, err)
+	}
+
+	return nil
+}
+
+func (this *FakeCompleter) Model(task app.LLMTask) string {
+	return ProviderFake
+}
@@ -0,0 +1,42 @@
+package llm_client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/init-pkg/nova-template/domain/app"
+)
+
+const defaultMaxConcurrency = 4
+
+// LimitedCompleter caps the number of completions in flight, whatever service or goroutine asks.
+// Waiting for a free slot ends with the request context
+type LimitedCompleter struct {
+	next  app.StructuredCompleter
+	slots chan struct{}
+}
+
+var _ app.StructuredCompleter = &LimitedCompleter{}
+
+func NewLimited(next app.StructuredCompleter, limit int) *LimitedCompleter {
+	if limit <= 0 {
+		limit = defaultMaxConcurrency
+	}
+
+	return &LimitedCompleter{next: next, slots: make(chan struct{}, limit)}
+}
+
+func (this *LimitedCompleter) Complete(ctx context.Context, req app.CompletionRequest, out any) error {
+	select {
+	case this.slots <- struct{}{}:
+	case <-ctx.Done():
+		return fmt.Errorf("llm %s: waiting for a free slot: %w", req.Task, ctx.Err())
+	}
+	defer func() { <-this.slots }()
+
+	return this.next.Complete(ctx, req, out)
+}
+
+func (this *LimitedCompleter) Model(task app.LLMTask) string {
+	return this.next.Model(task)
+}
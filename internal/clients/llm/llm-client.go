@@ -0,0 +1,62 @@
+package llm_client
+
+import (
+	"fmt"
+
+	"github.com/init-pkg/nova-template/domain/app"
+	"github.com/init-pkg/nova-template/internal/config"
+	"github.com/openai/openai-go/v2"
+	"github.com/openai/openai-go/v2/option"
+)
+
+const (
+	ProviderOpenAI           = "openai"
+	ProviderOpenAICompatible = "openai_compatible"
+	ProviderFake             = "fake"
+)
+
+// New builds the structured completer of the configured provider, limited to llm.max_concurrency
+// completions in flight. An unknown provider fails the application start
+func New(cfg *config.Config, openaiClient *openai.Client) (app.StructuredCompleter, error) {
+	var llm = cfg.Clients.LLM
+
+	var completer app.StructuredCompleter
+	switch llm.Provider {
+	case "", ProviderOpenAI:
+		completer = NewOpenAI(openaiClient, llm.Models)
+	case ProviderOpenAICompatible:
+		var cl = openai.NewClient(
+			option.WithBaseURL(llm.BaseURL),
+			option.WithAPIKey(llm.ApiKey),
+		)
+		completer = NewOpenAI(&cl, llm.Models)
+	case ProviderFake:
+		completer = NewFake(nil)
+	default:
+		return nil, fmt.Errorf("unknown llm provider %q", llm.Provider)
+	}
+
+	return NewLimited(completer, llm.MaxConcurrency), nil
+}
+
+// modelFor returns the configured model of the task
+func modelFor(models config.LLMModelsConfig, task app.LLMTask) string {
+	var model string
+	switch task {
+	case app.LLMTaskHeaderAnalysis:
+		model = models.HeaderAnalysis
+	case app.LLMTaskTableValidation:
+		model = models.TableValidation
+	case app.LLMTaskHeaderMapping:
+		model = models.HeaderMapping
+	}
+
+	if model == "" {
+		model = models.Default
+	}
+	if model == "" {
+		model = openai.ChatModelGPT5Nano
+	}
+
+	return model
+}
@@ -0,0 +1,86 @@
+package llm_client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/init-pkg/nova-template/domain/app"
+	"github.com/init-pkg/nova-template/internal/config"
+	"github.com/openai/openai-go/v2"
+)
+
+// OpenAICompleter uses Chat Completions with Structured Outputs.
+// Works with OpenAI and any endpoint that implements the same API
+type OpenAICompleter struct {
+	client *openai.Client
+	models config.LLMModelsConfig
+}
+
+var _ app.StructuredCompleter = &OpenAICompleter{}
+
+func NewOpenAI(client *openai.Client, models config.LLMModelsConfig) *OpenAICompleter {
+	return &OpenAICompleter{
+		client: client,
+		models: models,
+	}
+}
+
+func (this *OpenAICompleter) Complete(ctx context.Context, req app.CompletionRequest, out any) error {
+	var messages []openai.ChatCompletionMessageParamUnion
+	if req.System != "" {
+		messages = append(messages, openai.SystemMessage(req.System))
+	}
+	messages = append(messages, openai.UserMessage(req.Prompt))
+
+	var params = openai.ChatCompletionNewParams{
+		Model:    modelFor(this.models, req.Task),
+		Messages: messages,
+		ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONSchema: &openai.ResponseFormatJSONSchemaParam{
+				JSONSchema: openai.ResponseFormatJSONSchemaJSONSchemaParam{
+					Name:        req.SchemaName,
+					Description: openai.String(req.SchemaDescription),
+					Schema:      req.Schema,
+					Strict:      openai.Bool(true),
+				},
+			},
+		},
+	}
+	if req.Seed != 0 {
+		params.Seed = openai.Int(req.Seed)
+	}
+
+	resp, err := this.client.Chat.Completions.New(ctx, params)
+	if err != nil {
+		return fmt.Errorf("llm %s: chat completion: %w", req.Task, err)
+	}
+	if len(resp.Choices) == 0 {
+		return fmt.Errorf("llm %s: empty choices", req.Task)
+	}
+
+	if err := json.Unmarshal([]byte(trimJSONFence(resp.Choices[0].Message.Content)), out); err != nil {
+		return fmt.Errorf("llm %s: unmarshal model output: %w", req.Task, err)
+	}
+
+	return nil
+}
+
+func (this *OpenAICompleter) Model(task app.LLMTask) string {
+	return modelFor(this.models, task)
+}
+
+// trimJSONFence removes a markdown code fence that local models often put around JSON
+func trimJSONFence(content string) string {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "```") {
+		return content
+	}
+
+	content = strings.TrimPrefix(content, "```")
+	content = strings.TrimPrefix(content, "json")
+	content = strings.TrimSuffix(strings.TrimSpace(content), "```")
+
+	return strings.TrimSpace(content)
+}
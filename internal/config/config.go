@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	nova_amqp "github.com/init-pkg/nova/clients/amqp"
 	nova_minio "github.com/init-pkg/nova/clients/minio"
 	nova_minio_storage "github.com/init-pkg/nova/clients/minio/storage"
@@ -59,6 +61,7 @@ type MinioConfig struct {
 // Clients to external APIs, SDKs
 type Clients struct {
 	OpenAI     OpenAIConfig        `yaml:"openai"`
+	LLM        LLMConfig           `yaml:"llm"`
 	Laravel    LaravelClientConfig `yaml:"laravel"`
 	Opensearch OpensearchConfig    `yaml:"opensearch"`
 }
@@ -67,6 +70,23 @@ type OpenAIConfig struct {
 	ApiKey string `yaml:"api_key"`
 }
 
+// Structured completions used by the excel parser and header mapping
+type LLMConfig struct {
+	Provider       string          `yaml:"provider"` // "openai" | "openai_compatible" | "fake", default "openai"
+	BaseURL        string          `yaml:"base_url"` // openai_compatible only, e.g. "http://localhost:11434/v1"
+	ApiKey         string          `yaml:"api_key"`  // openai_compatible only, openai uses clients.openai.api_key
+	Models         LLMModelsConfig `yaml:"models"`
+	MaxConcurrency int             `yaml:"max_concurrency"` // completions in flight across the whole service, default 4
+}
+
+// Model per task. Empty uses the default model
+type LLMModelsConfig struct {
+	Default         string `yaml:"default"` // default "gpt-5-nano"
+	HeaderAnalysis  string `yaml:"header_analysis"`
+	TableValidation string `yaml:"table_validation"`
+	HeaderMapping   string `yaml:"header_mapping"`
+}
+
 type LaravelClientConfig struct {
 	Url string `yaml:"url"`
 }
@@ -79,7 +99,80 @@ type OpensearchConfig struct {
 
 // Internal microservices or internal modules
 type Internal struct {
-	// Example: UserServiceConfig, EmailServiceConfig, etc.
+	ExcelParser ExcelParserConfig   `yaml:"excel_parser"`
+	Timeouts    StageTimeoutsConfig `yaml:"timeouts"`
+	Normalize   NormalizeConfig     `yaml:"normalize"`
+	Validation  ValidationConfig    `yaml:"validation"`
+}
+
+// Deadlines of pipeline stages as durations, e.g. "90s". Empty or invalid values use the stage default.
+// A stage is cut short earlier when the request context is cancelled
+type StageTimeoutsConfig struct {
+	Parse           string `yaml:"parse"`            // whole parse of a file, default "5m"
+	HeaderAnalysis  string `yaml:"header_analysis"`  // one header analysis model call, default "60s"
+	TableValidation string `yaml:"table_validation"` // one table validation model call, default "60s"
+	HeaderMapping   string `yaml:"header_mapping"`   // one header mapping model call, default "25s"
+	SemanticSearch  string `yaml:"semantic_search"`  // one embedding and index search, default "10s"
+	Laravel         string `yaml:"laravel"`          // one Laravel API request, default "30s"
+}
+
+// Timeout parses a stage timeout, falling back to def
+func Timeout(value string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return d
+	}
+
+	return def
+}
+
+type ExcelParserConfig struct {
+	MergePolicy MergePolicyConfig `yaml:"merge_policy"`
+	Detection   string            `yaml:"detection"` // "llm" | "heuristic", default "llm" with heuristic fallback
+	Cache       HeaderCacheConfig `yaml:"cache"`
+	Workers     int               `yaml:"workers"` // sheets of a workbook analyzed concurrently, default 4
+	// min similarity from 0 to 1 of a known table layout to reuse its decisions, default 0.85
+	LayoutSimilarity float64 `yaml:"layout_similarity"`
+	// registers the cache and template admin endpoints. They purge shared state without auth, keep off on public routers
+	AdminEndpoints bool `yaml:"admin_endpoints"`
+}
+
+// Header analysis and table validation cache
+type HeaderCacheConfig struct {
+	Backend    string `yaml:"backend"`     // "memory" | "redis" | "two_tier", default "redis"
+	MemorySize int    `yaml:"memory_size"` // max entries of the in-process cache, default 10000
+	MemoryTTL  string `yaml:"memory_ttl"`  // max lifetime of in-process entries, e.g. "30m", default "1h"
+}
+
+// Merge expansion per region: "duplicate" | "span" | "mark". Empty uses the default
+type MergePolicyConfig struct {
+	Vertical     string `yaml:"vertical"`      // default "duplicate"
+	Horizontal   string `yaml:"horizontal"`    // default "duplicate"
+	HeaderGroup  string `yaml:"header_group"`  // default "span"
+	SectionTitle string `yaml:"section_title"` // default "mark"
+}
+
+// Normalization of mapped product values
+type NormalizeConfig struct {
+	LowStock    int                                `yaml:"low_stock"`    // max quantity reported as low stock, default 3
+	StockScales map[string]StockScaleConfig        `yaml:"stock_scales"` // symbolic stock values, merged over the default "+", "++", "+++" scale
+	Suppliers   map[uint64]SupplierNormalizeConfig `yaml:"suppliers"`    // overrides by supplier id
+}
+
+type SupplierNormalizeConfig struct {
+	StockScales map[string]StockScaleConfig `yaml:"stock_scales"` // merged over the global scale
+}
+
+// Meaning of a symbolic stock value, e.g. "++": {availability: "in_stock", min: 10, max: 50}
+type StockScaleConfig struct {
+	Availability string `yaml:"availability"` // "in_stock" | "low" | "out" | "on_order"
+	Min          int    `yaml:"min"`          // quantity range of the symbol, both 0 if unknown
+	Max          int    `yaml:"max"`          // 0 for no upper bound
+}
+
+// Row validation of mapped product tables
+type ValidationConfig struct {
+	Required        []string `yaml:"required"`          // product fields every row must have, default ["name", "sku", "price"]
+	MaxInvalidShare float64  `yaml:"max_invalid_share"` // share of invalid rows above which a file is rejected, default 0.5
 }
 
 // Security configuration